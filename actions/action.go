@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -14,8 +16,8 @@ type Action interface {
 	Do(context.Context, interface{}, map[string]interface{}) (interface{}, error)
 
 	WithLogger(*log.Logger)
-	WithProcessors(map[string]map[string]interface{})
-	WithOutputs(map[string]map[string]interface{})
+	WithProcessors(map[string]processors.Processor)
+	WithOutputs(map[string]outputs.Output)
 }
 
 type Initializer func() Action
@@ -34,13 +36,13 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
-func WithProcessors(procs map[string]map[string]interface{}) Option {
+func WithProcessors(procs map[string]processors.Processor) Option {
 	return func(i Action) {
 		i.WithProcessors(procs)
 	}
 }
 
-func WithOutputs(outs map[string]map[string]interface{}) Option {
+func WithOutputs(outs map[string]outputs.Output) Option {
 	return func(i Action) {
 		i.WithOutputs(outs)
 	}
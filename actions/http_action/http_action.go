@@ -1,16 +1,40 @@
 package http_action
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	"github.com/karimra/ouroboros/utils"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	actionType = "http"
+	actionType     = "http"
+	defaultMethod  = http.MethodPost
+	defaultTimeout = 10 * time.Second
+	// response bodies are truncated to this size in errors
+	maxErrorBody = 512
 )
 
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
 func init() {
 	actions.Register(actionType, func() actions.Action {
 		return &httpAction{
@@ -20,23 +44,164 @@ func init() {
 	})
 }
 
+// httpAction sends a request for each event and returns the response body,
+// decoded if it is JSON.
+// The request continues the event trace and carries its context in the traceparent header.
 type httpAction struct {
 	cfg    *cfg
 	logger *log.Logger
 	name   string
+
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+	client  *http.Client
+}
+
+type cfg struct {
+	// Go templates executed against the event as .Input and the previous actions results as .Env
+	URL     string            `mapstructure:"url,omitempty"`
+	Method  string            `mapstructure:"method,omitempty"`
+	Headers map[string]string `mapstructure:"headers,omitempty"`
+	// the event is sent as JSON if not set
+	Body    string           `mapstructure:"body,omitempty"`
+	TLS     *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	Timeout time.Duration    `mapstructure:"timeout,omitempty"`
+}
+
+func (a *httpAction) Init(name string, cfg interface{}, opts ...actions.Option) error {
+	err := utils.DecodeConfig(cfg, a.cfg)
+	if err != nil {
+		return err
+	}
+	a.name = name
+	for _, opt := range opts {
+		opt(a)
+	}
+	err = a.setDefaults()
+	if err != nil {
+		return err
+	}
+	a.url, err = template.New("url").Funcs(templateFuncs).Parse(a.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("url: %v", err)
+	}
+	if a.cfg.Body != "" {
+		a.body, err = template.New("body").Funcs(templateFuncs).Parse(a.cfg.Body)
+		if err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+	}
+	a.headers = make(map[string]*template.Template, len(a.cfg.Headers))
+	for k, v := range a.cfg.Headers {
+		a.headers[k], err = template.New(k).Funcs(templateFuncs).Parse(v)
+		if err != nil {
+			return fmt.Errorf("header %q: %v", k, err)
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if a.cfg.TLS != nil {
+		tr.TLSClientConfig, err = a.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	a.client = &http.Client{Transport: tr, Timeout: a.cfg.Timeout}
+	return nil
 }
 
-type cfg struct{}
+func (a *httpAction) setDefaults() error {
+	if a.cfg.URL == "" {
+		return errors.New("missing url")
+	}
+	if a.cfg.Method == "" {
+		a.cfg.Method = defaultMethod
+	}
+	a.cfg.Method = strings.ToUpper(a.cfg.Method)
+	if a.cfg.Timeout <= 0 {
+		a.cfg.Timeout = defaultTimeout
+	}
+	return nil
+}
 
-func (a *httpAction) Init(string, interface{}, ...actions.Option) error { return nil }
-func (a *httpAction) Do(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
-	return nil, nil
+func (a *httpAction) Do(ctx context.Context, in interface{}, env map[string]interface{}) (interface{}, error) {
+	input := in
+	if b, ok := in.([]byte); ok {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err == nil {
+			input = v
+		} else {
+			input = string(b)
+		}
+	}
+	data := map[string]interface{}{"Input": input, "Env": env}
+	url, err := execute(a.url, data)
+	if err != nil {
+		return nil, fmt.Errorf("url: %v", err)
+	}
+	var body []byte
+	if a.body != nil {
+		s, err := execute(a.body, data)
+		if err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+		body = []byte(s)
+	} else {
+		body, err = json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, a.cfg.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if a.body == nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, tpl := range a.headers {
+		v, err := execute(tpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %v", k, err)
+		}
+		req.Header.Set(k, v)
+	}
+	rsp, err := tracing.Do(ctx, a.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	rb, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode >= 300 {
+		if len(rb) > maxErrorBody {
+			rb = rb[:maxErrorBody]
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", a.cfg.Method, url, rsp.Status, rb)
+	}
+	var rs interface{}
+	if err := json.Unmarshal(rb, &rs); err == nil {
+		return rs, nil
+	}
+	return string(rb), nil
 }
+
 func (a *httpAction) Name() string { return a.name }
 func (a *httpAction) WithLogger(logger *log.Logger) {
 	if a.logger == nil {
 		a.logger = logger
 	}
 }
-func (a *httpAction) WithProcessors(map[string]map[string]interface{}) {}
-func (a *httpAction) WithOutputs(map[string]map[string]interface{})    {}
+func (a *httpAction) WithProcessors(map[string]processors.Processor) {}
+func (a *httpAction) WithOutputs(map[string]outputs.Output)          {}
+
+func execute(tpl *template.Template, data interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := tpl.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,97 @@
+package http_action
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/karimra/ouroboros/actions"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newAction(t *testing.T, cfg map[string]interface{}) actions.Action {
+	t.Helper()
+	a := actions.Actions[actionType]()
+	err := a.Init("test", cfg, actions.WithLogger(log.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestDo(t *testing.T) {
+	var gotPath, gotBody, gotHeader, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		gotPath, gotBody = r.URL.Path, string(b)
+		gotHeader, gotType = r.Header.Get("X-Device"), r.Header.Get("Content-Type")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	a := newAction(t, map[string]interface{}{
+		"url":     srv.URL + "/devices/{{ .Input.device }}",
+		"headers": map[string]interface{}{"X-Device": "{{ .Input.device }}"},
+	})
+	rs, err := a.Do(context.Background(), []byte(`{"device":"r1"}`), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/devices/r1" || gotHeader != "r1" {
+		t.Errorf("request path %q, header %q", gotPath, gotHeader)
+	}
+	if gotBody != `{"device":"r1"}` || gotType != "application/json" {
+		t.Errorf("request body %q, content type %q", gotBody, gotType)
+	}
+	if want := map[string]interface{}{"status": "ok"}; !reflect.DeepEqual(rs, want) {
+		t.Errorf("result = %v, want %v", rs, want)
+	}
+}
+
+func TestDoStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such device", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	a := newAction(t, map[string]interface{}{
+		"url":  srv.URL,
+		"body": `{"env":{{ json .Env }}}`,
+	})
+	_, err := a.Do(context.Background(), "event", map[string]interface{}{"prev": 1})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such device") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDoPropagatesTrace(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer srv.Close()
+
+	a := newAction(t, map[string]interface{}{"url": srv.URL})
+	ctx, span := otel.Tracer("test").Start(context.Background(), "action")
+	defer span.End()
+	_, err := a.Do(ctx, "event", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := span.SpanContext().TraceID().String()
+	if !strings.Contains(traceparent, tid) {
+		t.Errorf("traceparent %q does not carry trace %s", traceparent, tid)
+	}
+}
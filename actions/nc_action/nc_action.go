@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -38,5 +40,5 @@ func (a *ncAction) WithLogger(logger *log.Logger) {
 		a.logger = logger
 	}
 }
-func (a *ncAction) WithProcessors(map[string]map[string]interface{}) {}
-func (a *ncAction) WithOutputs(map[string]map[string]interface{})    {}
+func (a *ncAction) WithProcessors(map[string]processors.Processor) {}
+func (a *ncAction) WithOutputs(map[string]outputs.Output)          {}
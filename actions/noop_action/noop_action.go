@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
 	"github.com/karimra/ouroboros/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -52,5 +54,5 @@ func (a *noopAction) WithLogger(logger *log.Logger) {
 		a.logger = logger.WithField("plugin", "action_"+actionType)
 	}
 }
-func (a *noopAction) WithProcessors(map[string]map[string]interface{}) {}
-func (a *noopAction) WithOutputs(map[string]map[string]interface{})    {}
+func (a *noopAction) WithProcessors(map[string]processors.Processor) {}
+func (a *noopAction) WithOutputs(map[string]outputs.Output)          {}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -38,5 +40,5 @@ func (a *sshAction) WithLogger(logger *log.Logger) {
 		a.logger = logger
 	}
 }
-func (a *sshAction) WithProcessors(map[string]map[string]interface{}) {}
-func (a *sshAction) WithOutputs(map[string]map[string]interface{})    {}
+func (a *sshAction) WithProcessors(map[string]processors.Processor) {}
+func (a *sshAction) WithOutputs(map[string]outputs.Output)          {}
@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package ingestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// IngestClient is the client API for Ingest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IngestClient interface {
+	// Ingest sends a single event, the Ack is returned once the event
+	// went through the trigger pipeline, unless the trigger acks on receipt.
+	Ingest(ctx context.Context, in *Event, opts ...grpc.CallOption) (*Ack, error)
+	// IngestStream sends a stream of events, the StreamAck is returned
+	// once the client closes the stream and all the events are acknowledged.
+	IngestStream(ctx context.Context, opts ...grpc.CallOption) (Ingest_IngestStreamClient, error)
+}
+
+type ingestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestClient(cc grpc.ClientConnInterface) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) Ingest(ctx context.Context, in *Event, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/orbrs.ingest.v1.Ingest/Ingest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestClient) IngestStream(ctx context.Context, opts ...grpc.CallOption) (Ingest_IngestStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[0], "/orbrs.ingest.v1.Ingest/IngestStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestIngestStreamClient{stream}
+	return x, nil
+}
+
+type Ingest_IngestStreamClient interface {
+	Send(*Event) error
+	CloseAndRecv() (*StreamAck, error)
+	grpc.ClientStream
+}
+
+type ingestIngestStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestIngestStreamClient) Send(m *Event) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestIngestStreamClient) CloseAndRecv() (*StreamAck, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StreamAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IngestServer is the server API for Ingest service.
+// All implementations must embed UnimplementedIngestServer
+// for forward compatibility
+type IngestServer interface {
+	// Ingest sends a single event, the Ack is returned once the event
+	// went through the trigger pipeline, unless the trigger acks on receipt.
+	Ingest(context.Context, *Event) (*Ack, error)
+	// IngestStream sends a stream of events, the StreamAck is returned
+	// once the client closes the stream and all the events are acknowledged.
+	IngestStream(Ingest_IngestStreamServer) error
+	mustEmbedUnimplementedIngestServer()
+}
+
+// UnimplementedIngestServer must be embedded to have forward compatible implementations.
+type UnimplementedIngestServer struct {
+}
+
+func (UnimplementedIngestServer) Ingest(context.Context, *Event) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedIngestServer) IngestStream(Ingest_IngestStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method IngestStream not implemented")
+}
+func (UnimplementedIngestServer) mustEmbedUnimplementedIngestServer() {}
+
+// UnsafeIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServer will
+// result in compilation errors.
+type UnsafeIngestServer interface {
+	mustEmbedUnimplementedIngestServer()
+}
+
+func RegisterIngestServer(s grpc.ServiceRegistrar, srv IngestServer) {
+	s.RegisterService(&Ingest_ServiceDesc, srv)
+}
+
+func _Ingest_Ingest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Event)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServer).Ingest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orbrs.ingest.v1.Ingest/Ingest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServer).Ingest(ctx, req.(*Event))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ingest_IngestStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).IngestStream(&ingestIngestStreamServer{stream})
+}
+
+type Ingest_IngestStreamServer interface {
+	SendAndClose(*StreamAck) error
+	Recv() (*Event, error)
+	grpc.ServerStream
+}
+
+type ingestIngestStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestIngestStreamServer) SendAndClose(m *StreamAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestIngestStreamServer) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Ingest_ServiceDesc is the grpc.ServiceDesc for Ingest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ingest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "orbrs.ingest.v1.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ingest",
+			Handler:    _Ingest_Ingest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestStream",
+			Handler:       _Ingest_IngestStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
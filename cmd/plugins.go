@@ -0,0 +1,115 @@
+/*
+Copyright © 2021 Karim Radhouani <medkarimrdi@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/karimra/ouroboros/plugins"
+	"github.com/spf13/cobra"
+)
+
+func newPluginsCmd() *cobra.Command {
+	var format string
+	var schema bool
+	cmd := &cobra.Command{
+		Use:   "plugins [kind [type...]]",
+		Short: "list the plugin types and their configuration fields",
+		Long: `plugins lists the registered trigger, processor, action and output types with their configuration fields,
+optionally filtered by kind and types.
+With --schema, it prints the JSON Schema of the configuration file instead,
+usable by editors to validate and auto-complete .orbrs.yaml.`,
+		Annotations:  map[string]string{annotationSkipConfig: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if schema {
+				return printJSON(plugins.Schema())
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format %q", format)
+			}
+			var kind string
+			if len(args) > 0 {
+				var err error
+				kind, err = plugins.Kind(args[0])
+				if err != nil {
+					return err
+				}
+			}
+			ps := plugins.List(kind)
+			if len(args) > 1 {
+				ps = filterPlugins(ps, args[1:])
+				if len(ps) == 0 {
+					return fmt.Errorf("unknown %s type(s): %s", kind, strings.Join(args[1:], ", "))
+				}
+			}
+			if format == "json" {
+				return printJSON(ps)
+			}
+			printPlugins(ps)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "text", "output format, text or json")
+	cmd.Flags().BoolVar(&schema, "schema", false, "print the configuration file JSON Schema")
+	return cmd
+}
+
+func filterPlugins(ps []*plugins.Plugin, types []string) []*plugins.Plugin {
+	keep := make(map[string]bool, len(types))
+	for _, t := range types {
+		keep[t] = true
+	}
+	filtered := make([]*plugins.Plugin, 0, len(types))
+	for _, p := range ps {
+		if keep[p.Type] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func printPlugins(ps []*plugins.Plugin) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, p := range ps {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s %s\n", strings.ToUpper(p.Kind), p.Type)
+		if len(p.Fields) == 0 {
+			fmt.Fprintln(w, "  no configuration fields")
+			continue
+		}
+		fmt.Fprintln(w, "  NAME\tTYPE\tDEFAULT\tDESCRIPTION")
+		for _, f := range p.Fields {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", f.Name, f.Type, f.Default, f.Description)
+		}
+	}
+	w.Flush()
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
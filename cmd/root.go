@@ -26,6 +26,9 @@ import (
 
 var oApp = orbrs.New()
 
+// annotationSkipConfig marks the commands not using the config file.
+const annotationSkipConfig = "skip-config"
+
 func newRootCmd() *cobra.Command {
 	oApp.RootCmd = &cobra.Command{
 		Use:     "ouroboros",
@@ -51,6 +54,9 @@ func newRootCmd() *cobra.Command {
 		},
 	}
 	oApp.InitFlags()
+	oApp.RootCmd.AddCommand(newValidateCmd())
+	oApp.RootCmd.AddCommand(newTestCmd())
+	oApp.RootCmd.AddCommand(newPluginsCmd())
 	return oApp.RootCmd
 }
 
@@ -66,6 +72,9 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	if cmd, _, err := oApp.RootCmd.Find(os.Args[1:]); err == nil && cmd.Annotations[annotationSkipConfig] != "" {
+		return
+	}
 	err := oApp.Config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed loading config file: %v\n", err)
@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Karim Radhouani <medkarimrdi@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/karimra/ouroboros/orbrs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newTestCmd() *cobra.Command {
+	var run string
+	cmd := &cobra.Command{
+		Use:   "test [file or directory]...",
+		Short: "run test cases through the triggers pipelines",
+		Long: `test runs the events of the test case files through the pipeline of their trigger,
+with the actions mocked and the outputs recording the events written to them,
+and compares the processors output, the actions result and the outputs events to the expected ones.
+Nothing is connected to. It exits with status 1 if a test fails.
+
+A test case file holds a list of tests:
+
+tests:
+  - name: interface down
+    trigger: nats-in
+    event: {"interface": "ethernet-1/1", "state": "down"}
+    actions:
+      get-config:
+        result: {"admin-state": "enable"}
+      open-ticket:
+        error: "service unavailable"
+    expect:
+      processors: {...}
+      dropped: false
+      result: {...}
+      error: "open-ticket"
+      outputs:
+        slack: [{...}]`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !oApp.Config.Flags.Debug && !oApp.Config.FileConfig.GetBool("debug") {
+				oApp.SetLogLevel(log.WarnLevel)
+			}
+			tcs, err := orbrs.LoadTestCases(args...)
+			if err != nil {
+				return err
+			}
+			var selected []*orbrs.TestCase
+			for _, tc := range tcs {
+				if run == "" || strings.Contains(tc.Name, run) {
+					selected = append(selected, tc)
+				}
+			}
+			if len(selected) == 0 {
+				return fmt.Errorf("no test cases found")
+			}
+			var failed int
+			for _, r := range oApp.RunTests(context.Background(), selected) {
+				if r.Passed() {
+					fmt.Printf("PASS  %s: %s (%s)\n", r.File, r.Name, r.Duration)
+					continue
+				}
+				failed++
+				fmt.Printf("FAIL  %s: %s (%s)\n", r.File, r.Name, r.Duration)
+				for _, f := range r.Failures {
+					fmt.Println("    " + strings.ReplaceAll(f, "\n", "\n    "))
+				}
+			}
+			fmt.Printf("%d passed, %d failed\n", len(selected)-failed, failed)
+			if failed > 0 {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&run, "run", "", "only run the test cases whose name contains this string")
+	return cmd
+}
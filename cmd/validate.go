@@ -0,0 +1,82 @@
+/*
+Copyright © 2021 Karim Radhouani <medkarimrdi@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/karimra/ouroboros/orbrs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd() *cobra.Command {
+	var strict bool
+	var format string
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "validate the configuration file",
+		Long: `validate checks the plugin types and the references between triggers, processors, actions and outputs,
+and initializes the processors and actions without connecting to anything.
+It exits with status 1 if errors are found, or warnings in strict mode.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format %q", format)
+			}
+			if !oApp.Config.Flags.Debug && !oApp.Config.FileConfig.GetBool("debug") {
+				oApp.SetLogLevel(log.WarnLevel)
+			}
+			problems := oApp.Validate()
+			var errs, warns int
+			for _, p := range problems {
+				if p.Severity == orbrs.SeverityError {
+					errs++
+				} else {
+					warns++
+				}
+			}
+			if format == "json" {
+				if problems == nil {
+					problems = []*orbrs.Problem{}
+				}
+				b, err := json.MarshalIndent(problems, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+			} else {
+				for _, p := range problems {
+					fmt.Println(p)
+				}
+				if errs == 0 && warns == 0 {
+					fmt.Println("configuration is valid")
+				} else {
+					fmt.Printf("%d error(s), %d warning(s)\n", errs, warns)
+				}
+			}
+			if errs > 0 || (strict && warns > 0) {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail on warnings")
+	cmd.Flags().StringVar(&format, "format", "text", "output format, text or json")
+	return cmd
+}
@@ -3,12 +3,15 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"time"
 
 	"github.com/adrg/xdg"
 	_ "github.com/karimra/ouroboros/actions/all"
 	_ "github.com/karimra/ouroboros/outputs/all"
 	_ "github.com/karimra/ouroboros/processors/all"
+	"github.com/karimra/ouroboros/tracing"
 	_ "github.com/karimra/ouroboros/triggers/all"
+	"github.com/karimra/ouroboros/utils"
 	"github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -28,6 +31,12 @@ type Config struct {
 	Actions    map[string]map[string]interface{} `mapstructure:"actions,omitempty" json:"actions,omitempty"`
 	Outputs    map[string]map[string]interface{} `mapstructure:"outputs,omitempty" json:"outputs,omitempty"`
 	Processors map[string]map[string]interface{} `mapstructure:"processors,omitempty" json:"processors,omitempty"`
+	// management REST API, disabled if not set
+	APIServer *APIServer `mapstructure:"api-server,omitempty" json:"api-server,omitempty"`
+	// prometheus self-metrics, disabled if not set
+	MetricsServer *MetricsServer `mapstructure:"metrics-server,omitempty" json:"metrics-server,omitempty"`
+	// OpenTelemetry traces export, disabled if not set
+	Tracing *tracing.Config `mapstructure:"tracing,omitempty" json:"tracing,omitempty"`
 
 	logger *log.Entry
 }
@@ -38,6 +47,21 @@ type Flags struct {
 	Debug   bool   `mapstructure:"debug,omitempty" json:"debug,omitempty"`
 }
 
+type APIServer struct {
+	Address string           `mapstructure:"address,omitempty" json:"address,omitempty"`
+	TLS     *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+	// max duration of a request, including the injected events pipeline runs
+	Timeout time.Duration `mapstructure:"timeout,omitempty" json:"timeout,omitempty"`
+	// number of recent pipeline runs kept per trigger
+	History int `mapstructure:"history,omitempty" json:"history,omitempty"`
+}
+
+type MetricsServer struct {
+	Address string           `mapstructure:"address,omitempty" json:"address,omitempty"`
+	Path    string           `mapstructure:"path,omitempty" json:"path,omitempty"`
+	TLS     *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+}
+
 func New() *Config {
 	return &Config{
 		FileConfig: viper.New(),
@@ -95,17 +119,16 @@ func (c *Config) validate() error {
 
 func (c *Config) setLogger() {
 	stdLogger := log.StandardLogger()
+	c.logger = stdLogger.WithField("module", configModule)
 	if c.Flags.LogFile != "" {
 		f, err := os.OpenFile(c.Flags.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
+			c.logger.Errorf("failed to open log file: %v", err)
 			return
 		}
 		stdLogger.SetOutput(f)
-		c.logger = stdLogger.WithField("module", configModule)
-
 	} else if c.Flags.Debug || c.FileConfig.GetBool("debug") {
 		stdLogger.SetLevel(log.DebugLevel)
 		stdLogger.SetOutput(os.Stderr)
-		c.logger = stdLogger.WithField("module", configModule)
 	}
 }
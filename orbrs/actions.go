@@ -0,0 +1,28 @@
+package orbrs
+
+import "github.com/karimra/ouroboros/actions"
+
+func (a *App) initActions() {
+	for name, cfg := range a.Config.Actions {
+		a.logger.Infof("initializing action %q", name)
+		act, err := actions.CreateAction(cfg)
+		if err != nil {
+			a.logger.Errorf("failed to create action %q: %v", name, err)
+			continue
+		}
+		err = act.Init(name, cfg,
+			actions.WithLogger(a.logger),
+			actions.WithProcessors(a.processors),
+			actions.WithOutputs(a.outputs),
+		)
+		if err != nil {
+			a.logger.Errorf("failed to init action %q: %v", name, err)
+			continue
+		}
+		if a.metrics != nil {
+			typ, _ := cfg["type"].(string)
+			act = a.metrics.trackAction(name, typ, act)
+		}
+		a.actions[name] = act
+	}
+}
@@ -0,0 +1,442 @@
+package orbrs
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+)
+
+const (
+	defaultAPIAddress = "127.0.0.1:7890"
+	defaultAPITimeout = 10 * time.Second
+	defaultAPIHistory = 100
+	apiPrefix         = "/api/v1/"
+	maxInjectSize     = 4 * 1024 * 1024
+	redacted          = "****"
+)
+
+// config keys holding a secret, matched case insensitively
+var secretKeys = []string{"password", "passwd", "secret", "token", "api-key", "apikey", "authorization", "dsn", "webhook"}
+
+// config keys holding URLs which may carry a secret in their path or query,
+// such as chat webhooks, only their scheme and host are kept.
+var urlKeys = []string{"url", "urls"}
+
+type apiError struct {
+	Error string `json:"error,omitempty"`
+}
+
+type injectResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// startAPIServer serves the management API if it is configured.
+func (a *App) startAPIServer() {
+	if a.Config.APIServer == nil {
+		return
+	}
+	c := a.Config.APIServer
+	if c.Address == "" {
+		c.Address = defaultAPIAddress
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultAPITimeout
+	}
+	if c.History == 0 {
+		c.History = defaultAPIHistory
+	}
+	if c.History < 0 {
+		c.History = 0
+	}
+	l, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		a.logger.Errorf("failed to start API server: %v", err)
+		return
+	}
+	if c.TLS != nil {
+		tlsCfg, err := c.TLS.NewServerTLS()
+		if err != nil {
+			l.Close()
+			a.logger.Errorf("failed to start API server: %v", err)
+			return
+		}
+		l = tls.NewListener(l, tlsCfg)
+	} else if !isLoopback(c.Address) {
+		a.logger.Warnf("API server listening on %s without TLS, its pause, resume and inject endpoints are not authenticated", c.Address)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"config", a.handleConfig)
+	mux.HandleFunc(apiPrefix+"plugins", a.handlePlugins)
+	mux.HandleFunc(apiPrefix+"triggers", a.handleTriggers)
+	mux.HandleFunc(apiPrefix+"triggers/", a.handleTrigger)
+	mux.HandleFunc(apiPrefix+"outputs", a.handleOutputs)
+	mux.HandleFunc(apiPrefix+"outputs/", a.handleOutput)
+	a.apiSrv = &http.Server{
+		Handler:      http.TimeoutHandler(mux, c.Timeout, `{"error":"request timeout"}`),
+		ReadTimeout:  c.Timeout,
+		WriteTimeout: c.Timeout + time.Second,
+	}
+	a.logger.Infof("starting API server on %s", c.Address)
+	go func() {
+		err := a.apiSrv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Errorf("API server stopped: %v", err)
+		}
+	}()
+}
+
+func (a *App) stopAPIServer() {
+	if a.apiSrv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := a.apiSrv.Shutdown(ctx)
+	if err != nil {
+		a.logger.Errorf("failed to stop API server: %v", err)
+	}
+}
+
+// GET /api/v1/config
+func (a *App) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	c := *a.Config
+	c.Triggers = redactConfigs(c.Triggers)
+	c.Actions = redactConfigs(c.Actions)
+	c.Outputs = redactConfigs(c.Outputs)
+	c.Processors = redactConfigs(c.Processors)
+	if c.Tracing != nil {
+		t := *c.Tracing
+		t.Headers = make(map[string]string, len(c.Tracing.Headers))
+		for k := range c.Tracing.Headers {
+			t.Headers[k] = redacted
+		}
+		c.Tracing = &t
+	}
+	writeJSON(w, http.StatusOK, &c)
+}
+
+// GET /api/v1/plugins
+func (a *App) handlePlugins(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	rsp := map[string][]string{
+		"triggers":   make([]string, 0, len(triggers.Triggers)),
+		"actions":    make([]string, 0, len(actions.Actions)),
+		"outputs":    make([]string, 0, len(outputs.Outputs)),
+		"processors": make([]string, 0, len(processors.Processors)),
+	}
+	for name := range triggers.Triggers {
+		rsp["triggers"] = append(rsp["triggers"], name)
+	}
+	for name := range actions.Actions {
+		rsp["actions"] = append(rsp["actions"], name)
+	}
+	for name := range outputs.Outputs {
+		rsp["outputs"] = append(rsp["outputs"], name)
+	}
+	for name := range processors.Processors {
+		rsp["processors"] = append(rsp["processors"], name)
+	}
+	for _, names := range rsp {
+		sort.Strings(names)
+	}
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// GET /api/v1/triggers
+func (a *App) handleTriggers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	names := make([]string, 0, len(a.Config.Triggers))
+	for name := range a.Config.Triggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rsp := make([]*triggerStatus, 0, len(names))
+	for _, name := range names {
+		rsp = append(rsp, a.triggerStatus(name))
+	}
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// GET  /api/v1/triggers/{name}
+// GET  /api/v1/triggers/{name}/history
+// POST /api/v1/triggers/{name}/pause
+// POST /api/v1/triggers/{name}/resume
+// POST /api/v1/triggers/{name}/inject
+func (a *App) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	name, op := splitPath(strings.TrimPrefix(r.URL.Path, apiPrefix+"triggers/"))
+	if _, ok := a.Config.Triggers[name]; !ok {
+		writeJSON(w, http.StatusNotFound, &apiError{Error: "unknown trigger " + name})
+		return
+	}
+	if op == "" {
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.triggerStatus(name))
+		}
+		return
+	}
+	a.m.Lock()
+	t, ok := a.triggers[name]
+	a.m.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusConflict, &apiError{Error: "trigger " + name + " is not running"})
+		return
+	}
+	pt, ok := t.(pipelineTrigger)
+	if !ok {
+		writeJSON(w, http.StatusNotImplemented, &apiError{Error: "trigger " + name + " does not support " + op})
+		return
+	}
+	switch op {
+	case "history":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, pt.History())
+		}
+	case "pause":
+		if allowMethod(w, r, http.MethodPost) {
+			a.logger.Infof("pausing trigger %q", name)
+			pt.Pause()
+			writeJSON(w, http.StatusOK, a.triggerStatus(name))
+		}
+	case "resume":
+		if allowMethod(w, r, http.MethodPost) {
+			a.logger.Infof("resuming trigger %q", name)
+			pt.Resume()
+			writeJSON(w, http.StatusOK, a.triggerStatus(name))
+		}
+	case "inject":
+		if allowMethod(w, r, http.MethodPost) {
+			a.injectEvent(w, r, pt)
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, &apiError{Error: "unknown operation " + op})
+	}
+}
+
+// injectEvent runs the request body through the trigger pipeline
+// and responds with the actions result or the error that interrupted it.
+func (a *App) injectEvent(w http.ResponseWriter, r *http.Request, pt pipelineTrigger) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxInjectSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, &apiError{Error: err.Error()})
+		return
+	}
+	if len(b) == 0 {
+		writeJSON(w, http.StatusBadRequest, &apiError{Error: "empty event"})
+		return
+	}
+	rs, err := pt.Inject(r.Context(), b)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, &injectResponse{Error: err.Error()})
+		return
+	}
+	rsp := new(injectResponse)
+	switch rs := rs.(type) {
+	case []byte:
+		if json.Valid(rs) {
+			rsp.Result = rs
+			break
+		}
+		rsp.Result, err = json.Marshal(string(rs))
+	default:
+		rsp.Result, err = json.Marshal(rs)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &apiError{Error: "failed to marshal result: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// GET /api/v1/outputs
+func (a *App) handleOutputs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	rsp := make([]*outputStatus, 0, len(a.outputsOrder))
+	for _, name := range a.outputsOrder {
+		if t, ok := a.outputs[name].(*trackedOutput); ok {
+			rsp = append(rsp, t.status())
+		}
+	}
+	sort.Slice(rsp, func(i, j int) bool { return rsp[i].Name < rsp[j].Name })
+	writeJSON(w, http.StatusOK, rsp)
+}
+
+// GET /api/v1/outputs/{name}
+func (a *App) handleOutput(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	name, _ := splitPath(strings.TrimPrefix(r.URL.Path, apiPrefix+"outputs/"))
+	t, ok := a.outputs[name].(*trackedOutput)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, &apiError{Error: "unknown or failed output " + name})
+		return
+	}
+	writeJSON(w, http.StatusOK, t.status())
+}
+
+// helpers
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, &apiError{Error: "method not allowed"})
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		b, _ = json.Marshal(&apiError{Error: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func splitPath(p string) (string, string) {
+	p = strings.Trim(p, "/")
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i+1:]
+}
+
+func redactConfigs(cfgs map[string]map[string]interface{}) map[string]map[string]interface{} {
+	rcfgs := make(map[string]map[string]interface{}, len(cfgs))
+	for name, cfg := range cfgs {
+		rcfgs[name] = redact(cfg).(map[string]interface{})
+	}
+	return rcfgs
+}
+
+// redact returns a copy of v with the values of secret keys,
+// the path and query of the URLs under URL keys and the passwords of other URLs replaced.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[k] = redactKey(k, vv)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			ks, _ := k.(string)
+			m[ks] = redactKey(ks, vv)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, vv := range v {
+			l = append(l, redact(vv))
+		}
+		return l
+	case string:
+		if !strings.Contains(v, "://") {
+			return v
+		}
+		u, err := url.Parse(v)
+		if err != nil {
+			return redacted
+		}
+		return u.Redacted()
+	}
+	return v
+}
+
+func redactKey(k string, v interface{}) interface{} {
+	if isSecretKey(k) {
+		return redacted
+	}
+	if !isURLKey(k) {
+		return redact(v)
+	}
+	switch v := v.(type) {
+	case string:
+		return redactURL(v)
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, vv := range v {
+			if s, ok := vv.(string); ok {
+				l = append(l, redactURL(s))
+				continue
+			}
+			l = append(l, redact(vv))
+		}
+		return l
+	}
+	return redact(v)
+}
+
+// redactURL keeps the scheme and host of s.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	r := u.Scheme + "://" + u.Host
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		r += "/" + redacted
+	}
+	return r
+}
+
+func isURLKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range urlKeys {
+		if k == s || strings.HasSuffix(k, "-"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range secretKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
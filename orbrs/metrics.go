@@ -0,0 +1,277 @@
+package orbrs
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultMetricsAddress = ":9805"
+	defaultMetricsPath    = "/metrics"
+	metricsNamespace      = "orbrs"
+)
+
+// appMetrics holds the self-metrics updated by the tracked processors, actions and outputs,
+// the triggers and outputs counters are collected from their status on scrape.
+type appMetrics struct {
+	reg *prometheus.Registry
+	srv *http.Server
+
+	processorDrops  *prometheus.CounterVec
+	processorErrors *prometheus.CounterVec
+	actionDuration  *prometheus.HistogramVec
+	actionResults   *prometheus.CounterVec
+	outputLatency   *prometheus.HistogramVec
+}
+
+// initMetrics creates the self-metrics if the metrics server is configured,
+// it runs before the processors, actions and outputs are initialized so that they are tracked.
+func (a *App) initMetrics() {
+	if a.Config.MetricsServer == nil {
+		return
+	}
+	m := &appMetrics{
+		reg: prometheus.NewRegistry(),
+		processorDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "processor",
+			Name:      "events_dropped_total",
+			Help:      "Number of events a processor returned an empty result for",
+		}, []string{"processor", "type"}),
+		processorErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "processor",
+			Name:      "errors_total",
+			Help:      "Number of events a processor failed to apply to",
+		}, []string{"processor", "type"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "action",
+			Name:      "duration_seconds",
+			Help:      "Duration of the action executions",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"action", "type"}),
+		actionResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "action",
+			Name:      "executions_total",
+			Help:      "Number of action executions by status, success or failure",
+		}, []string{"action", "type", "status"}),
+		outputLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "output",
+			Name:      "write_duration_seconds",
+			Help:      "Duration of the output writes, including the wait for a free output worker",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"output", "type"}),
+	}
+	m.reg.MustRegister(
+		m.processorDrops,
+		m.processorErrors,
+		m.actionDuration,
+		m.actionResults,
+		m.outputLatency,
+		&appCollector{a: a},
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	a.metrics = m
+}
+
+// startMetricsServer serves the self-metrics if they are configured.
+func (a *App) startMetricsServer() {
+	if a.metrics == nil {
+		return
+	}
+	c := a.Config.MetricsServer
+	if c.Address == "" {
+		c.Address = defaultMetricsAddress
+	}
+	if c.Path == "" {
+		c.Path = defaultMetricsPath
+	}
+	l, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		a.logger.Errorf("failed to start metrics server: %v", err)
+		return
+	}
+	if c.TLS != nil {
+		tlsCfg, err := c.TLS.NewServerTLS()
+		if err != nil {
+			l.Close()
+			a.logger.Errorf("failed to start metrics server: %v", err)
+			return
+		}
+		l = tls.NewListener(l, tlsCfg)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(c.Path, promhttp.HandlerFor(a.metrics.reg, promhttp.HandlerOpts{}))
+	a.metrics.srv = &http.Server{Handler: mux}
+	a.logger.Infof("starting metrics server on %s%s", c.Address, c.Path)
+	go func() {
+		err := a.metrics.srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+}
+
+func (a *App) stopMetricsServer() {
+	if a.metrics == nil || a.metrics.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := a.metrics.srv.Shutdown(ctx)
+	if err != nil {
+		a.logger.Errorf("failed to stop metrics server: %v", err)
+	}
+}
+
+// trackedProcessor counts the empty results of a processor and its failures.
+type trackedProcessor struct {
+	processors.Processor
+	drops  prometheus.Counter
+	errors prometheus.Counter
+}
+
+func (m *appMetrics) trackProcessor(name, typ string, p processors.Processor) processors.Processor {
+	return &trackedProcessor{
+		Processor: p,
+		drops:     m.processorDrops.WithLabelValues(name, typ),
+		errors:    m.processorErrors.WithLabelValues(name, typ),
+	}
+}
+
+func (t *trackedProcessor) Apply(in interface{}) (interface{}, error) {
+	out, err := t.Processor.Apply(in)
+	if err != nil {
+		t.errors.Inc()
+		return out, err
+	}
+	if processors.Dropped(out) {
+		t.drops.Inc()
+	}
+	return out, nil
+}
+
+// trackedAction measures the duration and counts the results of an action executions.
+type trackedAction struct {
+	actions.Action
+	duration prometheus.Observer
+	success  prometheus.Counter
+	failure  prometheus.Counter
+}
+
+func (m *appMetrics) trackAction(name, typ string, act actions.Action) actions.Action {
+	return &trackedAction{
+		Action:   act,
+		duration: m.actionDuration.WithLabelValues(name, typ),
+		success:  m.actionResults.WithLabelValues(name, typ, "success"),
+		failure:  m.actionResults.WithLabelValues(name, typ, "failure"),
+	}
+}
+
+func (t *trackedAction) Do(ctx context.Context, in interface{}, env map[string]interface{}) (interface{}, error) {
+	start := time.Now()
+	rs, err := t.Action.Do(ctx, in, env)
+	t.duration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		t.failure.Inc()
+		return rs, err
+	}
+	t.success.Inc()
+	return rs, nil
+}
+
+// appCollector collects the triggers and outputs counters from their status.
+type appCollector struct {
+	a *App
+}
+
+var (
+	triggerLabels = []string{"trigger", "type"}
+	outputLabels  = []string{"output", "type"}
+
+	triggerReceivedDesc   = newDesc("trigger", "events_received_total", "Number of events received by a trigger", triggerLabels)
+	triggerProcessedDesc  = newDesc("trigger", "events_processed_total", "Number of events run through a trigger pipeline", triggerLabels)
+	triggerFailedDesc     = newDesc("trigger", "events_failed_total", "Number of events failing a trigger processor or action", triggerLabels)
+	triggerDroppedDesc    = newDesc("trigger", "events_dropped_total", "Number of events a trigger processor returned an empty result for", triggerLabels)
+	triggerBufferDesc     = newDesc("trigger", "buffer_occupancy", "Number of events waiting for a trigger pipeline worker", triggerLabels)
+	triggerBufferSizeDesc = newDesc("trigger", "buffer_size", "Size of a trigger events buffer", triggerLabels)
+	triggerPausedDesc     = newDesc("trigger", "paused", "Whether a trigger pipeline is paused", triggerLabels)
+	triggerConnsDesc      = newDesc("trigger", "connections", "Number of open intake connections of a trigger", triggerLabels)
+	triggerReconnectsDesc = newDesc("trigger", "reconnects_total", "Number of restored intake connections of a trigger", triggerLabels)
+
+	outputWritesDesc     = newDesc("output", "writes_total", "Number of writes to an output", outputLabels)
+	outputFailuresDesc   = newDesc("output", "write_failures_total", "Number of failed writes to an output", outputLabels)
+	outputTimeoutsDesc   = newDesc("output", "write_timeouts_total", "Number of writes to an output timing out waiting for a free worker", outputLabels)
+	outputPendingDesc    = newDesc("output", "pending_writes", "Number of writes waiting for an output worker", outputLabels)
+	outputReconnectsDesc = newDesc("output", "reconnects_total", "Number of restored connections of an output", outputLabels)
+)
+
+func newDesc(subsystem, name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, subsystem, name), help, labels, nil)
+}
+
+func (c *appCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		triggerReceivedDesc, triggerProcessedDesc, triggerFailedDesc, triggerDroppedDesc,
+		triggerBufferDesc, triggerBufferSizeDesc, triggerPausedDesc, triggerConnsDesc, triggerReconnectsDesc,
+		outputWritesDesc, outputFailuresDesc, outputTimeoutsDesc, outputPendingDesc, outputReconnectsDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c *appCollector) Collect(ch chan<- prometheus.Metric) {
+	for name := range c.a.Config.Triggers {
+		st := c.a.triggerStatus(name)
+		if st.Status == nil {
+			continue
+		}
+		lvs := []string{st.Name, st.Type}
+		ch <- prometheus.MustNewConstMetric(triggerReceivedDesc, prometheus.CounterValue, float64(st.Received), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerProcessedDesc, prometheus.CounterValue, float64(st.Processed), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerFailedDesc, prometheus.CounterValue, float64(st.Failed), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerDroppedDesc, prometheus.CounterValue, float64(st.Dropped), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerBufferDesc, prometheus.GaugeValue, float64(st.QueueDepth), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerBufferSizeDesc, prometheus.GaugeValue, float64(st.BufferSize), lvs...)
+		ch <- prometheus.MustNewConstMetric(triggerPausedDesc, prometheus.GaugeValue, boolToFloat(st.Paused), lvs...)
+		if st.Connected != nil {
+			ch <- prometheus.MustNewConstMetric(triggerConnsDesc, prometheus.GaugeValue, float64(st.Connections), lvs...)
+			ch <- prometheus.MustNewConstMetric(triggerReconnectsDesc, prometheus.CounterValue, float64(st.Reconnects), lvs...)
+		}
+	}
+	for _, name := range c.a.outputsOrder {
+		t, ok := c.a.outputs[name].(*trackedOutput)
+		if !ok {
+			continue
+		}
+		st := t.status()
+		lvs := []string{st.Name, st.Type}
+		ch <- prometheus.MustNewConstMetric(outputWritesDesc, prometheus.CounterValue, float64(st.Writes), lvs...)
+		ch <- prometheus.MustNewConstMetric(outputFailuresDesc, prometheus.CounterValue, float64(st.Failures), lvs...)
+		ch <- prometheus.MustNewConstMetric(outputTimeoutsDesc, prometheus.CounterValue, float64(st.Timeouts), lvs...)
+		ch <- prometheus.MustNewConstMetric(outputPendingDesc, prometheus.GaugeValue, float64(st.QueueDepth), lvs...)
+		if st.Reconnects != nil {
+			ch <- prometheus.MustNewConstMetric(outputReconnectsDesc, prometheus.CounterValue, float64(*st.Reconnects), lvs...)
+		}
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -3,7 +3,11 @@ package orbrs
 import (
 	"context"
 	"io"
+	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/karimra/ouroboros/actions"
 	"github.com/karimra/ouroboros/config"
@@ -27,6 +31,13 @@ type App struct {
 	actions    map[string]actions.Action
 	processors map[string]processors.Processor
 	outputs    map[string]outputs.Output
+	// output names in initialization order
+	outputsOrder []string
+
+	apiSrv  *http.Server
+	metrics *appMetrics
+	// flushes and stops the traces export
+	stopTracing func(context.Context) error
 
 	logger *log.Logger
 }
@@ -57,10 +68,38 @@ func (a *App) InitFlags() {
 	})
 }
 
+// Start initializes the processors, outputs and actions once, starts the triggers using them
+// and runs until an interrupt or terminate signal is received.
 func (a *App) Start() {
 	a.logger.Infoln("starting orbrs...")
+	a.startTracing()
+	a.initMetrics()
+	a.initProcessors()
+	a.initOutputs()
+	a.initActions()
+	a.startMetricsServer()
+	a.startAPIServer()
 	a.startTriggers()
-	<-a.ctx.Done()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	select {
+	case <-a.ctx.Done():
+	case s := <-sig:
+		a.logger.Infof("received %s, shutting down...", s)
+	}
+	a.Stop()
+}
+
+// Stop closes the API and metrics servers and the triggers, then the outputs they write to,
+// and flushes the pending traces.
+func (a *App) Stop() {
+	a.stopAPIServer()
+	a.stopMetricsServer()
+	a.closeTriggers()
+	a.closeOutputs()
+	a.flushTraces()
+	a.cfn()
 }
 
 func (a *App) SetLogOutput(f io.Writer) {
@@ -0,0 +1,67 @@
+package orbrs
+
+import "github.com/karimra/ouroboros/outputs"
+
+func (a *App) initOutputs() {
+	visited := make(map[string]bool)
+	for name := range a.Config.Outputs {
+		a.initOutput(name, visited)
+	}
+}
+
+// initOutput initializes the output called name after its dead-letter output, if any.
+// It returns nil if the output is not available.
+func (a *App) initOutput(name string, visited map[string]bool) outputs.Output {
+	if visited[name] {
+		return a.outputs[name]
+	}
+	visited[name] = true
+	cfg, ok := a.Config.Outputs[name]
+	if !ok {
+		a.logger.Warnf("output %q not found", name)
+		return nil
+	}
+	o, err := outputs.CreateOutput(cfg)
+	if err != nil {
+		a.logger.Errorf("failed to create output %q: %v", name, err)
+		return nil
+	}
+	opts := []outputs.Option{
+		outputs.WithLogger(a.logger),
+		outputs.WithProcessors(a.processors),
+	}
+	if dlName, _ := cfg["dead-letter"].(string); dlName != "" {
+		// a dead-letter cycle ends here as the output being initialized is not available yet
+		if dl := a.initOutput(dlName, visited); dl != nil {
+			d := outputs.NewDeadLetter(dl, a.logger.WithField("output", name))
+			opts = append(opts, outputs.WithDeadLetter(d.For(outputs.StageOutput, name)))
+		} else {
+			a.logger.Errorf("output %q: dead-letter output %q is not available", name, dlName)
+		}
+	}
+	a.logger.Infof("initializing output %q", name)
+	err = o.Init(a.ctx, cfg, opts...)
+	if err != nil {
+		a.logger.Errorf("failed to init output %q: %v", name, err)
+		return nil
+	}
+	t := newTrackedOutput(name, cfg, o)
+	if a.metrics != nil {
+		t.latency = a.metrics.outputLatency.WithLabelValues(name, t.typ)
+	}
+	a.outputs[name] = t
+	a.outputsOrder = append(a.outputsOrder, name)
+	return t
+}
+
+// closeOutputs closes the outputs in the reverse order of their initialization,
+// so that dead-letter outputs are closed after the outputs using them.
+func (a *App) closeOutputs() {
+	for i := len(a.outputsOrder) - 1; i >= 0; i-- {
+		name := a.outputsOrder[i]
+		err := a.outputs[name].Close()
+		if err != nil {
+			a.logger.Errorf("failed to close output %q: %v", name, err)
+		}
+	}
+}
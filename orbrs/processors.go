@@ -0,0 +1,24 @@
+package orbrs
+
+import "github.com/karimra/ouroboros/processors"
+
+func (a *App) initProcessors() {
+	for name, cfg := range a.Config.Processors {
+		a.logger.Infof("initializing processor %q", name)
+		p, err := processors.CreateProcessor(cfg)
+		if err != nil {
+			a.logger.Errorf("failed to create processor %q: %v", name, err)
+			continue
+		}
+		err = p.Init(cfg, processors.WithLogger(a.logger))
+		if err != nil {
+			a.logger.Errorf("failed to init processor %q: %v", name, err)
+			continue
+		}
+		if a.metrics != nil {
+			typ, _ := cfg["type"].(string)
+			p = a.metrics.trackProcessor(name, typ, p)
+		}
+		a.processors[name] = p
+	}
+}
@@ -0,0 +1,158 @@
+package orbrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipelineTrigger is implemented by the triggers embedding a triggers.Pipeline.
+type pipelineTrigger interface {
+	triggers.Trigger
+	Status() *triggers.Status
+	Pause()
+	Resume()
+	Inject(context.Context, interface{}) (interface{}, error)
+	KeepHistory(int)
+	History() []*triggers.Run
+}
+
+type triggerStatus struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	// running, paused or failed
+	State string `json:"state"`
+	*triggers.Status
+}
+
+func (a *App) triggerStatus(name string) *triggerStatus {
+	st := &triggerStatus{Name: name, State: "failed"}
+	st.Type, _ = a.Config.Triggers[name]["type"].(string)
+	a.m.Lock()
+	t, ok := a.triggers[name]
+	a.m.Unlock()
+	if !ok {
+		return st
+	}
+	st.State = "running"
+	if pt, ok := t.(pipelineTrigger); ok {
+		st.Status = pt.Status()
+		if st.Paused {
+			st.State = "paused"
+		}
+	}
+	return st
+}
+
+// trackedOutput wraps an initialized output to report its status.
+type trackedOutput struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	pending  int64
+	writes   uint64
+	failures uint64
+	timeouts uint64
+
+	outputs.Output
+	name    string
+	typ     string
+	workers int
+	// set if the self-metrics are enabled
+	latency prometheus.Observer
+
+	m             *sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func newTrackedOutput(name string, cfg map[string]interface{}, o outputs.Output) *trackedOutput {
+	wcfg := &struct {
+		NumWorkers int `mapstructure:"num-workers,omitempty"`
+	}{}
+	utils.DecodeConfig(cfg, wcfg)
+	if wcfg.NumWorkers <= 0 {
+		wcfg.NumWorkers = 1
+	}
+	t := &trackedOutput{
+		Output:  o,
+		name:    name,
+		workers: wcfg.NumWorkers,
+		m:       new(sync.Mutex),
+	}
+	t.typ, _ = cfg["type"].(string)
+	return t
+}
+
+func (t *trackedOutput) Write(ctx context.Context, d interface{}) error {
+	start := time.Now()
+	atomic.AddInt64(&t.pending, 1)
+	err := t.Output.Write(ctx, d)
+	atomic.AddInt64(&t.pending, -1)
+	atomic.AddUint64(&t.writes, 1)
+	if t.latency != nil {
+		t.latency.Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		atomic.AddUint64(&t.failures, 1)
+		// the outputs time out when their workers do not take the event in time
+		if errors.Is(err, context.DeadlineExceeded) {
+			atomic.AddUint64(&t.timeouts, 1)
+		}
+		t.m.Lock()
+		t.lastError = err.Error()
+		t.lastErrorTime = time.Now()
+		t.m.Unlock()
+	}
+	return err
+}
+
+type outputStatus struct {
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Workers int    `json:"workers"`
+	// writes waiting for a worker to take the event
+	QueueDepth int64  `json:"queue-depth"`
+	Writes     uint64 `json:"writes"`
+	Failures   uint64 `json:"failures"`
+	Timeouts   uint64 `json:"timeouts"`
+	// only set for the outputs tracking their connections
+	Connected *bool `json:"connected,omitempty"`
+	// only set for the outputs counting their reconnects
+	Reconnects    *uint64    `json:"reconnects,omitempty"`
+	LastError     string     `json:"last-error,omitempty"`
+	LastErrorTime *time.Time `json:"last-error-time,omitempty"`
+}
+
+func (t *trackedOutput) status() *outputStatus {
+	st := &outputStatus{
+		Name:       t.name,
+		Type:       t.typ,
+		Workers:    t.workers,
+		QueueDepth: atomic.LoadInt64(&t.pending),
+		Writes:     atomic.LoadUint64(&t.writes),
+		Failures:   atomic.LoadUint64(&t.failures),
+		Timeouts:   atomic.LoadUint64(&t.timeouts),
+	}
+	if c, ok := t.Output.(interface{ Connected() bool }); ok {
+		connected := c.Connected()
+		st.Connected = &connected
+	}
+	if rc, ok := t.Output.(interface{ Reconnects() uint64 }); ok {
+		n := rc.Reconnects()
+		st.Reconnects = &n
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.lastError != "" {
+		st.LastError = t.lastError
+		ts := t.lastErrorTime
+		st.LastErrorTime = &ts
+	}
+	return st
+}
@@ -0,0 +1,440 @@
+package orbrs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// testDeadLetter is the dead-letter output of the tested triggers without one.
+const testDeadLetter = "orbrs-test-dead-letter"
+
+// TestCase runs an event through a trigger pipeline with its actions mocked.
+type TestCase struct {
+	Name    string `mapstructure:"name,omitempty"`
+	Trigger string `mapstructure:"trigger,omitempty"`
+	// event fed to the pipeline as JSON, strings are fed as is
+	Event interface{} `mapstructure:"event,omitempty"`
+	// mocked actions by name, the actions not listed return the event they receive
+	Actions map[string]*ActionMock `mapstructure:"actions,omitempty"`
+	// expect keys: processors, dropped, result, error and outputs,
+	// only the listed ones are checked.
+	// dropped is set if a trigger processor returned an empty result.
+	Expect map[string]interface{} `mapstructure:"expect,omitempty"`
+
+	file string
+}
+
+// ActionMock is the response of a mocked action.
+type ActionMock struct {
+	Result interface{} `mapstructure:"result,omitempty"`
+	Error  string      `mapstructure:"error,omitempty"`
+}
+
+type testFile struct {
+	Tests []*TestCase `mapstructure:"tests,omitempty"`
+}
+
+// TestResult is the outcome of a TestCase, Failures is empty if it passed.
+type TestResult struct {
+	File     string
+	Name     string
+	Duration time.Duration
+	Failures []string
+}
+
+func (r *TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadTestCases reads the test cases from files, directories are searched for .yaml, .yml and .json files.
+func LoadTestCases(paths ...string) ([]*TestCase, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			switch filepath.Ext(path) {
+			case ".yaml", ".yml", ".json":
+				if !info.IsDir() {
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var tcs []*TestCase
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var raw interface{}
+		err = yaml.Unmarshal(b, &raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		tf := new(testFile)
+		err = utils.DecodeConfig(normalizeYAML(raw), tf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		for i, tc := range tf.Tests {
+			tc.file = f
+			if tc.Name == "" {
+				tc.Name = fmt.Sprintf("test-%d", i)
+			}
+		}
+		tcs = append(tcs, tf.Tests...)
+	}
+	return tcs, nil
+}
+
+// RunTests initializes the processors then runs each test case in a new pipeline
+// of its trigger, with mocked actions and outputs recording the events written to them.
+func (a *App) RunTests(ctx context.Context, tcs []*TestCase) []*TestResult {
+	a.initProcessors()
+	rs := make([]*TestResult, 0, len(tcs))
+	for _, tc := range tcs {
+		start := time.Now()
+		r := &TestResult{File: tc.file, Name: tc.Name}
+		r.Failures = a.runTest(ctx, tc)
+		r.Duration = time.Since(start)
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func (a *App) runTest(ctx context.Context, tc *TestCase) []string {
+	cfg, ok := a.Config.Triggers[tc.Trigger]
+	if !ok {
+		return []string{fmt.Sprintf("unknown trigger %q", tc.Trigger)}
+	}
+	for k := range tc.Expect {
+		switch k {
+		case "processors", "dropped", "result", "error", "outputs":
+		default:
+			return []string{fmt.Sprintf("unknown expectation %q", k)}
+		}
+	}
+	pcfg := new(triggers.PipelineConfig)
+	err := utils.DecodeConfig(cfg, pcfg)
+	if err != nil {
+		return []string{fmt.Sprintf("trigger %q: %v", tc.Trigger, err)}
+	}
+	event, err := testEvent(tc.Event)
+	if err != nil {
+		return []string{fmt.Sprintf("event: %v", err)}
+	}
+
+	logger := a.logger.WithField("test", tc.Name)
+	acts := make(map[string]actions.Action, len(pcfg.Actions))
+	for _, name := range pcfg.Actions {
+		acts[name] = &mockAction{name: name, mock: tc.Actions[name]}
+	}
+	for name := range tc.Actions {
+		if _, ok := acts[name]; !ok {
+			return []string{fmt.Sprintf("mocked action %q is not an action of trigger %q", name, tc.Trigger)}
+		}
+	}
+	outs := make(map[string]outputs.Output, len(a.Config.Outputs)+1)
+	for name, ocfg := range a.Config.Outputs {
+		outs[name] = newCaptureOutput(ocfg, a.processors, logger)
+	}
+	// the action failures not aborting the pipeline are only written to the dead-letter output
+	dlName := pcfg.DeadLetter
+	if dlName == "" {
+		dlName = testDeadLetter
+		outs[dlName] = newCaptureOutput(nil, nil, logger)
+	}
+	dl := &deadLetterCapture{Output: outs[dlName]}
+	outs[dlName] = dl
+	pcfg.DeadLetter = dlName
+
+	var failures []string
+	check := func(what string, expected, actual interface{}) {
+		ev, av := normalizeJSON(expected), normalizeJSON(actual)
+		if !reflect.DeepEqual(ev, av) {
+			failures = append(failures, fmt.Sprintf("%s:\n%s", what, diff(ev, av)))
+		}
+	}
+
+	if expected, ok := tc.Expect["processors"]; ok {
+		data, err := a.applyProcessors(pcfg.Processors, event)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("processors failed: %v", err))
+		} else {
+			check("processors", expected, data)
+		}
+	}
+
+	p := triggers.NewPipeline(pcfg)
+	p.WithName(tc.Trigger)
+	p.WithProcessors(a.processors)
+	p.WithActions(acts)
+	p.WithOutputs(outs)
+	p.Start(ctx, logger)
+	defer p.Close()
+	rs, err := p.Process(ctx, event)
+	if err == nil {
+		err = dl.err
+	}
+	dropped := p.Status().Dropped > 0
+
+	if expected, ok := tc.Expect["dropped"]; ok {
+		if b, _ := expected.(bool); b != dropped {
+			failures = append(failures, fmt.Sprintf("dropped: expected %v, got %v", b, dropped))
+		}
+	}
+	if expected, ok := tc.Expect["error"]; ok {
+		s := fmt.Sprint(expected)
+		switch {
+		case err == nil:
+			failures = append(failures, fmt.Sprintf("error: expected %q, got none", s))
+		case !strings.Contains(err.Error(), s):
+			failures = append(failures, fmt.Sprintf("error: expected %q, got %q", s, err.Error()))
+		}
+	} else if err != nil {
+		failures = append(failures, fmt.Sprintf("unexpected error: %v", err))
+	}
+	if expected, ok := tc.Expect["result"]; ok {
+		check("result", expected, rs)
+	}
+	if expected, ok := tc.Expect["outputs"]; ok {
+		m, ok := expected.(map[string]interface{})
+		if !ok {
+			return append(failures, "outputs: expected a map of output names to the list of written events")
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			o, ok := outs[name].(*captureOutput)
+			if !ok {
+				failures = append(failures, fmt.Sprintf("unknown output %q", name))
+				continue
+			}
+			if o.err != nil {
+				failures = append(failures, fmt.Sprintf("output %q processors failed: %v", name, o.err))
+				continue
+			}
+			check("outputs."+name, m[name], o.events)
+		}
+	}
+	return failures
+}
+
+func (a *App) applyProcessors(names []string, data interface{}) (interface{}, error) {
+	var err error
+	for _, name := range names {
+		p, ok := a.processors[name]
+		if !ok {
+			return nil, fmt.Errorf("processor %q not found", name)
+		}
+		data, err = p.Apply(data)
+		if err != nil {
+			return nil, fmt.Errorf("processor %q: %v", name, err)
+		}
+	}
+	return data, nil
+}
+
+// testEvent returns ev as a trigger would feed it, raw bytes.
+func testEvent(ev interface{}) ([]byte, error) {
+	switch ev := ev.(type) {
+	case nil:
+		return nil, errors.New("missing event")
+	case string:
+		return []byte(ev), nil
+	default:
+		return json.Marshal(ev)
+	}
+}
+
+type mockAction struct {
+	name string
+	mock *ActionMock
+}
+
+func (m *mockAction) Init(string, interface{}, ...actions.Option) error { return nil }
+func (m *mockAction) Name() string                                      { return m.name }
+func (m *mockAction) Do(_ context.Context, in interface{}, _ map[string]interface{}) (interface{}, error) {
+	if m.mock == nil {
+		return in, nil
+	}
+	if m.mock.Error != "" {
+		return nil, errors.New(m.mock.Error)
+	}
+	return m.mock.Result, nil
+}
+func (m *mockAction) WithLogger(*log.Logger)                         {}
+func (m *mockAction) WithProcessors(map[string]processors.Processor) {}
+func (m *mockAction) WithOutputs(map[string]outputs.Output)          {}
+
+// captureOutput records the events written to an output after applying the output processors.
+type captureOutput struct {
+	procs  []processors.Processor
+	events []interface{}
+	err    error
+}
+
+func newCaptureOutput(cfg map[string]interface{}, procs map[string]processors.Processor, logger *log.Entry) *captureOutput {
+	o := &captureOutput{events: make([]interface{}, 0)}
+	refs := new(references)
+	utils.DecodeConfig(cfg, refs)
+	for _, name := range refs.Processors {
+		if p, ok := procs[name]; ok {
+			o.procs = append(o.procs, p)
+			continue
+		}
+		logger.Warnf("processor %q not found", name)
+	}
+	return o
+}
+
+func (o *captureOutput) Init(context.Context, interface{}, ...outputs.Option) error { return nil }
+func (o *captureOutput) Write(_ context.Context, d interface{}) error {
+	var err error
+	for _, p := range o.procs {
+		d, err = p.Apply(d)
+		if err != nil {
+			o.err = err
+			return err
+		}
+	}
+	o.events = append(o.events, d)
+	return nil
+}
+func (o *captureOutput) Close() error                                   { return nil }
+func (o *captureOutput) WithLogger(*log.Logger)                         {}
+func (o *captureOutput) WithProcessors(map[string]processors.Processor) {}
+func (o *captureOutput) WithDeadLetter(*outputs.DeadLetter)             {}
+
+// deadLetterCapture records the first action failure written to the dead-letter output,
+// then passes the failure to Output.
+type deadLetterCapture struct {
+	outputs.Output
+	err error
+}
+
+func (d *deadLetterCapture) Write(ctx context.Context, data interface{}) error {
+	f := new(outputs.Failure)
+	b, _ := data.([]byte)
+	if json.Unmarshal(b, f) == nil && f.Stage == outputs.StageAction && d.err == nil {
+		d.err = &triggers.StageError{Stage: f.Stage, Name: f.Name, Err: errors.New(f.Error)}
+	}
+	return d.Output.Write(ctx, data)
+}
+
+// normalizeYAML converts the maps decoded by yaml.v2 to map[string]interface{}.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(vv)
+		}
+		return m
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = normalizeYAML(vv)
+		}
+	}
+	return v
+}
+
+// normalizeJSON converts v to the generic JSON types so that values of different types compare,
+// bytes holding JSON are decoded.
+func normalizeJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		var n interface{}
+		if json.Unmarshal(v, &n) != nil {
+			return string(v)
+		}
+		return n
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			l = append(l, normalizeJSON(e))
+		}
+		return l
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var n interface{}
+	json.Unmarshal(b, &n)
+	return n
+}
+
+// diff returns the line diff of the indented JSON of expected and actual.
+func diff(expected, actual interface{}) string {
+	eb, _ := json.MarshalIndent(expected, "", "  ")
+	ab, _ := json.MarshalIndent(actual, "", "  ")
+	el := strings.Split(string(eb), "\n")
+	al := strings.Split(string(ab), "\n")
+	// longest common subsequence table
+	lcs := make([][]int, len(el)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(al)+1)
+	}
+	for i := len(el) - 1; i >= 0; i-- {
+		for j := len(al) - 1; j >= 0; j-- {
+			if el[i] == al[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	sb := new(strings.Builder)
+	i, j := 0, 0
+	for i < len(el) || j < len(al) {
+		switch {
+		case i < len(el) && j < len(al) && el[i] == al[j]:
+			sb.WriteString("    " + el[i] + "\n")
+			i++
+			j++
+		case i < len(el) && (j == len(al) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("  - " + el[i] + "\n")
+			i++
+		default:
+			sb.WriteString("  + " + al[j] + "\n")
+			j++
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
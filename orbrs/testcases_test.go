@@ -0,0 +1,122 @@
+package orbrs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/karimra/ouroboros/processors/jq_proc"
+	log "github.com/sirupsen/logrus"
+)
+
+const testConfig = `
+tests:
+  - name: pass
+    trigger: in
+    event: {"interface": "ethernet-1/1", "state": "down"}
+    actions:
+      get-config:
+        result: {"admin-state": "enable"}
+    expect:
+      processors: {"if": "ethernet-1/1"}
+      dropped: false
+      result: {"admin-state": "enable"}
+      outputs:
+        out: [{"admin": "enable"}]
+  - name: action error
+    trigger: in
+    event: {"interface": "ethernet-1/1", "state": "down"}
+    actions:
+      get-config:
+        error: service unavailable
+    expect:
+      error: service unavailable
+  - name: dropped
+    trigger: in
+    event: {"interface": "ethernet-1/1", "state": "up"}
+    expect:
+      dropped: true
+  - name: wrong result
+    trigger: in
+    event: {"interface": "ethernet-1/1", "state": "down"}
+    expect:
+      result: {"admin-state": "disable"}
+  - name: unknown trigger
+    trigger: nope
+    event: {}
+`
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	a := New()
+	a.logger = log.New()
+	a.logger.SetOutput(ioutil.Discard)
+	a.Config.Triggers = map[string]map[string]interface{}{
+		"in": {
+			"type":       "nats",
+			"processors": []interface{}{"select-down"},
+			"actions":    []interface{}{"get-config"},
+			"outputs":    []interface{}{"out"},
+		},
+	}
+	a.Config.Processors = map[string]map[string]interface{}{
+		"select-down": {"type": "jq", "expression": `select(.state == "down") | {if: .interface}`},
+		"admin":       {"type": "jq", "expression": `{admin: .["admin-state"]}`},
+	}
+	a.Config.Actions = map[string]map[string]interface{}{
+		"get-config": {"type": "noop"},
+	}
+	a.Config.Outputs = map[string]map[string]interface{}{
+		"out": {"type": "file", "processors": []interface{}{"admin"}},
+	}
+	return a
+}
+
+func TestRunTests(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "tests.yaml")
+	err := os.WriteFile(fn, []byte(testConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs, err := LoadTestCases(filepath.Dir(fn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := newTestApp(t).RunTests(context.Background(), tcs)
+	want := map[string]string{
+		"pass":            "",
+		"action error":    "",
+		"dropped":         "",
+		"wrong result":    `"admin-state": "disable"`,
+		"unknown trigger": `unknown trigger "nope"`,
+	}
+	if len(rs) != len(want) {
+		t.Fatalf("got %d results, want %d", len(rs), len(want))
+	}
+	for _, r := range rs {
+		failure, ok := want[r.Name]
+		if !ok {
+			t.Errorf("unexpected test %q", r.Name)
+			continue
+		}
+		if failure == "" {
+			if !r.Passed() {
+				t.Errorf("%s: unexpected failures: %v", r.Name, r.Failures)
+			}
+			continue
+		}
+		if r.Passed() || !strings.Contains(strings.Join(r.Failures, "\n"), failure) {
+			t.Errorf("%s: expected a failure containing %q, got %v", r.Name, failure, r.Failures)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	d := diff(map[string]interface{}{"a": 1, "b": 2}, map[string]interface{}{"a": 1, "b": 3})
+	if !strings.Contains(d, `-   "b": 2`) || !strings.Contains(d, `+   "b": 3`) || strings.Contains(d, `-   "a"`) {
+		t.Errorf("unexpected diff:\n%s", d)
+	}
+}
@@ -0,0 +1,40 @@
+package orbrs
+
+import (
+	"context"
+	"time"
+
+	"github.com/karimra/ouroboros/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+const tracingShutdownTimeout = 5 * time.Second
+
+// startTracing starts the traces export if it is configured.
+func (a *App) startTracing() {
+	if a.Config.Tracing == nil {
+		return
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		a.logger.Errorf("tracing: %v", err)
+	}))
+	stop, err := tracing.Start(a.ctx, a.Config.Tracing)
+	if err != nil {
+		a.logger.Errorf("failed to start tracing: %v", err)
+		return
+	}
+	a.logger.Infof("exporting traces to %s over %s", a.Config.Tracing.Address, a.Config.Tracing.Protocol)
+	a.stopTracing = stop
+}
+
+func (a *App) flushTraces() {
+	if a.stopTracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	err := a.stopTracing(ctx)
+	if err != nil {
+		a.logger.Errorf("failed to flush traces: %v", err)
+	}
+}
@@ -9,10 +9,10 @@ func (a *App) startTriggers() {
 			if in, ok := triggers.Triggers[oType.(string)]; ok {
 				trigger := in()
 				go a.startTrigger(name, cfg, trigger)
-				return
+				continue
 			}
 			a.logger.Infof("unknown trigger type %q", oType)
-			return
+			continue
 		}
 		a.logger.Infof("missing trigger type under %q", name)
 	}
@@ -20,16 +20,33 @@ func (a *App) startTriggers() {
 
 func (a *App) startTrigger(name string, cfg interface{}, trigger triggers.Trigger) {
 	err := trigger.Start(a.ctx, cfg,
+		triggers.WithName(name),
 		triggers.WithLogger(a.logger),
-		triggers.WithOutputs(a.ctx, a.Config.Outputs, a.Config.Processors, a.logger),
-		triggers.WithActions(a.Config.Actions, a.Config.Processors, a.Config.Outputs, a.logger),
-		triggers.WithProcessors(a.Config.Processors, a.logger),
+		triggers.WithOutputs(a.outputs),
+		triggers.WithActions(a.actions),
+		triggers.WithProcessors(a.processors),
 	)
 	if err != nil {
 		a.logger.Errorf("failed to init trigger %q: %v", name, err)
 		return
 	}
+	if a.Config.APIServer != nil {
+		if pt, ok := trigger.(pipelineTrigger); ok {
+			pt.KeepHistory(a.Config.APIServer.History)
+		}
+	}
 	a.m.Lock()
 	a.triggers[name] = trigger
 	a.m.Unlock()
 }
+
+func (a *App) closeTriggers() {
+	a.m.Lock()
+	defer a.m.Unlock()
+	for name, t := range a.triggers {
+		err := t.Close()
+		if err != nil {
+			a.logger.Errorf("failed to close trigger %q: %v", name, err)
+		}
+	}
+}
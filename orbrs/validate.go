@@ -0,0 +1,301 @@
+package orbrs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem is a configuration issue found by Validate.
+type Problem struct {
+	Severity string `json:"severity"`
+	// config section and name, e.g. triggers/nats-in
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Path, p.Message)
+}
+
+// references are the config fields naming other config sections.
+type references struct {
+	Processors []string `mapstructure:"processors,omitempty"`
+	Actions    []string `mapstructure:"actions,omitempty"`
+	Outputs    []string `mapstructure:"outputs,omitempty"`
+	DeadLetter string   `mapstructure:"dead-letter,omitempty"`
+}
+
+type validator struct {
+	a        *App
+	problems []*Problem
+	// names referenced per section
+	used map[string]map[string]bool
+}
+
+// Validate checks the plugin types and the references between the config sections,
+// and initializes the processors and actions, which do not connect to anything.
+// Triggers and outputs are not started, their configuration is checked
+// if they implement triggers.Validator or outputs.Validator.
+// It returns the problems found sorted by path, errors first.
+func (a *App) Validate() []*Problem {
+	v := &validator{
+		a: a,
+		used: map[string]map[string]bool{
+			"processors": {},
+			"actions":    {},
+			"outputs":    {},
+		},
+	}
+	v.checkTypes("processors", a.Config.Processors, func(t string) bool { _, ok := processors.Processors[t]; return ok })
+	v.checkTypes("actions", a.Config.Actions, func(t string) bool { _, ok := actions.Actions[t]; return ok })
+	v.checkTypes("outputs", a.Config.Outputs, func(t string) bool { _, ok := outputs.Outputs[t]; return ok })
+	v.checkTypes("triggers", a.Config.Triggers, func(t string) bool { _, ok := triggers.Triggers[t]; return ok })
+
+	for name, cfg := range a.Config.Triggers {
+		path := "triggers/" + name
+		pcfg := new(triggers.PipelineConfig)
+		err := utils.DecodeConfig(cfg, pcfg)
+		if err != nil {
+			v.errorf(path, "%v", err)
+			continue
+		}
+		v.checkRefs(path, &references{
+			Processors: pcfg.Processors,
+			Actions:    pcfg.Actions,
+			Outputs:    pcfg.Outputs,
+			DeadLetter: pcfg.DeadLetter,
+		})
+		if len(pcfg.Actions) == 0 && len(pcfg.Outputs) == 0 {
+			v.warnf(path, "no actions nor outputs, events are discarded")
+		}
+	}
+	for _, sec := range []struct {
+		name string
+		cfgs map[string]map[string]interface{}
+	}{
+		{"actions", a.Config.Actions},
+		{"outputs", a.Config.Outputs},
+	} {
+		for name, cfg := range sec.cfgs {
+			path := sec.name + "/" + name
+			refs := new(references)
+			err := utils.DecodeConfig(cfg, refs)
+			if err != nil {
+				v.errorf(path, "%v", err)
+				continue
+			}
+			v.checkRefs(path, refs)
+		}
+	}
+	v.checkDeadLetterCycles()
+	v.checkUnused()
+	v.initProcessors()
+	v.initActions()
+	v.validateOutputs()
+	v.validateTriggers()
+	v.checkServers()
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		if v.problems[i].Severity != v.problems[j].Severity {
+			return v.problems[i].Severity == SeverityError
+		}
+		return v.problems[i].Path < v.problems[j].Path
+	})
+	return v.problems
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, &Problem{Severity: SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, &Problem{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) checkTypes(section string, cfgs map[string]map[string]interface{}, known func(string) bool) {
+	for name, cfg := range cfgs {
+		path := section + "/" + name
+		t, ok := cfg["type"]
+		if !ok {
+			v.errorf(path, "missing type")
+			continue
+		}
+		ts, ok := t.(string)
+		if !ok {
+			v.errorf(path, "type must be a string, got %T", t)
+			continue
+		}
+		if !known(ts) {
+			v.errorf(path, "unknown type %q", ts)
+		}
+	}
+}
+
+func (v *validator) checkRefs(path string, refs *references) {
+	v.checkNames(path, "processors", refs.Processors, v.a.Config.Processors)
+	v.checkNames(path, "actions", refs.Actions, v.a.Config.Actions)
+	v.checkNames(path, "outputs", refs.Outputs, v.a.Config.Outputs)
+	if refs.DeadLetter != "" {
+		v.checkNames(path, "outputs", []string{refs.DeadLetter}, v.a.Config.Outputs)
+	}
+}
+
+func (v *validator) checkNames(path, section string, names []string, cfgs map[string]map[string]interface{}) {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		v.used[section][name] = true
+		if _, ok := cfgs[name]; !ok {
+			v.errorf(path, "unknown %s %q", strings.TrimSuffix(section, "s"), name)
+		}
+		if seen[name] {
+			v.warnf(path, "%s %q is listed more than once", strings.TrimSuffix(section, "s"), name)
+		}
+		seen[name] = true
+	}
+}
+
+// checkDeadLetterCycles reports the outputs whose dead-letter chain loops,
+// the output closing the loop would not be initialized.
+func (v *validator) checkDeadLetterCycles() {
+	for name := range v.a.Config.Outputs {
+		chain := []string{name}
+		visited := map[string]bool{name: true}
+		cur := name
+		for {
+			next, _ := v.a.Config.Outputs[cur]["dead-letter"].(string)
+			if next == "" {
+				break
+			}
+			chain = append(chain, next)
+			if next == name {
+				v.errorf("outputs/"+name, "dead-letter cycle: %s", strings.Join(chain, " -> "))
+				break
+			}
+			// loops not going through name are reported for their own outputs
+			if visited[next] {
+				break
+			}
+			visited[next] = true
+			cur = next
+		}
+	}
+}
+
+func (v *validator) checkUnused() {
+	for _, sec := range []struct {
+		name string
+		cfgs map[string]map[string]interface{}
+	}{
+		{"processors", v.a.Config.Processors},
+		{"actions", v.a.Config.Actions},
+		{"outputs", v.a.Config.Outputs},
+	} {
+		for name := range sec.cfgs {
+			if !v.used[sec.name][name] {
+				v.warnf(sec.name+"/"+name, "not referenced")
+			}
+		}
+	}
+}
+
+func (v *validator) initProcessors() {
+	for name, cfg := range v.a.Config.Processors {
+		p, err := processors.CreateProcessor(cfg)
+		if err != nil {
+			// reported by checkTypes
+			continue
+		}
+		err = p.Init(cfg, processors.WithLogger(v.a.logger))
+		if err != nil {
+			v.errorf("processors/"+name, "init failed: %v", err)
+			continue
+		}
+		v.a.processors[name] = p
+	}
+}
+
+func (v *validator) initActions() {
+	for name, cfg := range v.a.Config.Actions {
+		act, err := actions.CreateAction(cfg)
+		if err != nil {
+			continue
+		}
+		err = act.Init(name, cfg,
+			actions.WithLogger(v.a.logger),
+			actions.WithProcessors(v.a.processors),
+			actions.WithOutputs(map[string]outputs.Output{}),
+		)
+		if err != nil {
+			v.errorf("actions/"+name, "init failed: %v", err)
+		}
+	}
+}
+
+// validateOutputs checks the configuration of the outputs implementing outputs.Validator.
+func (v *validator) validateOutputs() {
+	for name, cfg := range v.a.Config.Outputs {
+		typ, _ := cfg["type"].(string)
+		initFn, ok := outputs.Outputs[typ]
+		if !ok {
+			// reported by checkTypes
+			continue
+		}
+		if ov, ok := initFn().(outputs.Validator); ok {
+			if err := ov.Validate(cfg); err != nil {
+				v.errorf("outputs/"+name, "invalid config: %v", err)
+			}
+		}
+	}
+}
+
+// validateTriggers checks the configuration of the triggers implementing triggers.Validator.
+func (v *validator) validateTriggers() {
+	for name, cfg := range v.a.Config.Triggers {
+		typ, _ := cfg["type"].(string)
+		initFn, ok := triggers.Triggers[typ]
+		if !ok {
+			continue
+		}
+		if tv, ok := initFn().(triggers.Validator); ok {
+			if err := tv.Validate(cfg); err != nil {
+				v.errorf("triggers/"+name, "invalid config: %v", err)
+			}
+		}
+	}
+}
+
+// checkServers loads the TLS files of the API and metrics servers and of the traces export.
+func (v *validator) checkServers() {
+	c := v.a.Config
+	if c.APIServer != nil && c.APIServer.TLS != nil {
+		if _, err := c.APIServer.TLS.NewServerTLS(); err != nil {
+			v.errorf("api-server", "tls: %v", err)
+		}
+	}
+	if c.MetricsServer != nil && c.MetricsServer.TLS != nil {
+		if _, err := c.MetricsServer.TLS.NewServerTLS(); err != nil {
+			v.errorf("metrics-server", "tls: %v", err)
+		}
+	}
+	if c.APIServer != nil && c.MetricsServer != nil &&
+		c.APIServer.Address != "" && c.APIServer.Address == c.MetricsServer.Address {
+		v.errorf("metrics-server", "address %q is already used by the api-server", c.MetricsServer.Address)
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.Validate(); err != nil {
+			v.errorf("tracing", "%v", err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package orbrs
+
+import (
+	"io/ioutil"
+	"testing"
+
+	_ "github.com/karimra/ouroboros/outputs/file_output"
+	_ "github.com/karimra/ouroboros/outputs/influxdb_output"
+	_ "github.com/karimra/ouroboros/triggers/netconf_trigger"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestValidatePluginConfigs(t *testing.T) {
+	a := New()
+	a.logger = log.New()
+	a.logger.SetOutput(ioutil.Discard)
+	a.Config.Triggers = map[string]map[string]interface{}{
+		"in": {
+			"type":    "netconf",
+			"outputs": []interface{}{"influx", "file"},
+		},
+	}
+	a.Config.Outputs = map[string]map[string]interface{}{
+		"influx": {"type": "influxdb", "version": "v3"},
+		"file":   {"type": "file", "format": "jsonl"},
+	}
+	got := make(map[string]string)
+	for _, p := range a.Validate() {
+		if p.Severity == SeverityError {
+			got[p.Path] = p.Message
+		}
+	}
+	want := map[string]string{
+		"outputs/influx": `invalid config: unknown version "v3"`,
+		"triggers/in":    "invalid config: missing targets",
+	}
+	for path, msg := range want {
+		if got[path] != msg {
+			t.Errorf("%s: got %q, want %q", path, got[path], msg)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got errors %v, want %v", got, want)
+	}
+}
@@ -1,3 +1,20 @@
 package all
 
-import _ "github.com/karimra/ouroboros/outputs/nats_output"
+import (
+	_ "github.com/karimra/ouroboros/outputs/amqp_output"
+	_ "github.com/karimra/ouroboros/outputs/elasticsearch_output"
+	_ "github.com/karimra/ouroboros/outputs/file_output"
+	_ "github.com/karimra/ouroboros/outputs/influxdb_output"
+	_ "github.com/karimra/ouroboros/outputs/mattermost_output"
+	_ "github.com/karimra/ouroboros/outputs/mqtt_output"
+	_ "github.com/karimra/ouroboros/outputs/mysql_output"
+	_ "github.com/karimra/ouroboros/outputs/nats_output"
+	_ "github.com/karimra/ouroboros/outputs/postgres_output"
+	_ "github.com/karimra/ouroboros/outputs/prometheus_output"
+	_ "github.com/karimra/ouroboros/outputs/redis_output"
+	_ "github.com/karimra/ouroboros/outputs/slack_output"
+	_ "github.com/karimra/ouroboros/outputs/smtp_output"
+	_ "github.com/karimra/ouroboros/outputs/sqlite_output"
+	_ "github.com/karimra/ouroboros/outputs/syslog_output"
+	_ "github.com/karimra/ouroboros/outputs/teams_output"
+)
@@ -0,0 +1,549 @@
+// Package chat_output implements the outputs posting events to chat incoming webhooks,
+// the platform specific payload is built by a Formatter.
+package chat_output
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTitle        = "orbrs event"
+	defaultMaxRetries   = 3
+	defaultRetryWait    = time.Second
+	maxRetryAfter       = 5 * time.Minute
+	defaultTimeout      = 10 * time.Second
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+)
+
+var defaultColors = map[string]string{
+	"critical": "#E01E5A",
+	"error":    "#E01E5A",
+	"major":    "#E8912D",
+	"warning":  "#ECB22E",
+	"minor":    "#ECB22E",
+	"info":     "#439FE0",
+	"ok":       "#2EB67D",
+	"resolved": "#2EB67D",
+	"cleared":  "#2EB67D",
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value, to be used in payload templates
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Message is the rendered content of a notification.
+type Message struct {
+	Title string
+	Text  string
+	Link  string
+	// color as #RRGGBB
+	Color  string
+	Fields []*Field
+}
+
+type Field struct {
+	Name  string
+	Value string
+	Short bool
+}
+
+// Formatter builds a platform webhook payload from a Message.
+type Formatter interface {
+	Payload(m *Message) interface{}
+}
+
+// ChatOutput posts a message to a webhook for each event.
+type ChatOutput struct {
+	cfg       *cfg
+	formatter Formatter
+
+	ctx           context.Context
+	cfn           context.CancelFunc
+	tpls          map[string]*template.Template
+	fields        []*fieldTemplate
+	client        *http.Client
+	dedupe        *deduper
+	loggingPrefix string
+	procs         []processors.Processor
+	deadLetter    *outputs.DeadLetter
+	msgChan       chan interface{}
+	wg            *sync.WaitGroup
+	logger        *log.Entry
+}
+
+type cfg struct {
+	// incoming webhook URL
+	URL     string           `mapstructure:"url,omitempty"`
+	TLS     *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	Timeout time.Duration    `mapstructure:"timeout,omitempty"`
+	// Go templates executed against each event
+	Title string `mapstructure:"title,omitempty"`
+	Text  string `mapstructure:"text,omitempty"`
+	Link  string `mapstructure:"link,omitempty"`
+	// the color is looked up in colors using the rendered severity if not set
+	Color    string            `mapstructure:"color,omitempty"`
+	Severity string            `mapstructure:"severity,omitempty"`
+	Colors   map[string]string `mapstructure:"colors,omitempty"`
+	Fields   []*fieldCfg       `mapstructure:"fields,omitempty"`
+	// Go template rendering the whole JSON payload, replaces the fields above.
+	// the json function encodes its argument as JSON.
+	Payload string `mapstructure:"payload,omitempty"`
+	// identical messages posted within the window are dropped
+	DedupeWindow time.Duration `mapstructure:"dedupe-window,omitempty"`
+	// Go template, messages are deduplicated on the payload if unset
+	DedupeKey string `mapstructure:"dedupe-key,omitempty"`
+	// retries on connection errors, 429 and 5xx responses, none if negative.
+	// the Retry-After header is used as wait time if present.
+	MaxRetries   int           `mapstructure:"max-retries,omitempty"`
+	RetryWait    time.Duration `mapstructure:"retry-wait,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+type fieldCfg struct {
+	Name string `mapstructure:"name,omitempty"`
+	// Go template
+	Value string `mapstructure:"value,omitempty"`
+	Short bool   `mapstructure:"short,omitempty"`
+}
+
+type fieldTemplate struct {
+	cfg   *fieldCfg
+	value *template.Template
+}
+
+// New returns an output using formatter f, loggingPrefix is the plugin name used in logs.
+func New(f Formatter, loggingPrefix string) *ChatOutput {
+	return &ChatOutput{
+		cfg:           &cfg{},
+		formatter:     f,
+		loggingPrefix: loggingPrefix,
+		wg:            new(sync.WaitGroup),
+		msgChan:       make(chan interface{}),
+	}
+}
+
+func (c *ChatOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, c.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	err = c.setDefaults()
+	if err != nil {
+		return err
+	}
+	c.tpls = make(map[string]*template.Template)
+	for name, text := range map[string]string{
+		"title":      c.cfg.Title,
+		"text":       c.cfg.Text,
+		"link":       c.cfg.Link,
+		"color":      c.cfg.Color,
+		"severity":   c.cfg.Severity,
+		"payload":    c.cfg.Payload,
+		"dedupe-key": c.cfg.DedupeKey,
+	} {
+		if text == "" {
+			continue
+		}
+		c.tpls[name], err = template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, fc := range c.cfg.Fields {
+		if fc == nil || fc.Name == "" {
+			return errors.New("fields require a name")
+		}
+		tpl, err := template.New(fc.Name).Funcs(templateFuncs).Parse(fc.Value)
+		if err != nil {
+			return fmt.Errorf("field %q: %v", fc.Name, err)
+		}
+		c.fields = append(c.fields, &fieldTemplate{cfg: fc, value: tpl})
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.cfg.TLS != nil {
+		tr.TLSClientConfig, err = c.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	c.client = &http.Client{Transport: tr, Timeout: c.cfg.Timeout}
+	if c.cfg.DedupeWindow > 0 {
+		c.dedupe = newDeduper(c.cfg.DedupeWindow)
+	}
+	c.ctx, c.cfn = context.WithCancel(ctx)
+	c.logger.Infof("output starting with config: %+v", c.cfg)
+	c.wg.Add(c.cfg.NumWorkers)
+	for i := 0; i < c.cfg.NumWorkers; i++ {
+		go c.worker(c.ctx, i)
+	}
+	return nil
+}
+
+func (c *ChatOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		c.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			c.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			c.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			c.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, c.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case c.msgChan <- tracing.Wrap(ctx, d):
+	}
+	return nil
+}
+
+func (c *ChatOutput) Close() error {
+	if c.cfn != nil {
+		c.cfn()
+	}
+	c.wg.Wait()
+	return nil
+}
+
+func (c *ChatOutput) WithLogger(logger *log.Logger) {
+	if c.logger == nil {
+		c.logger = logger.WithField("plugin", c.loggingPrefix)
+	}
+}
+
+func (c *ChatOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range c.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			c.procs = append(c.procs, p)
+			continue
+		}
+		c.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (c *ChatOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	c.deadLetter = d
+}
+
+func (c *ChatOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, c.cfg)
+	if err != nil {
+		return err
+	}
+	return c.setDefaults()
+}
+
+func (c *ChatOutput) setDefaults() error {
+	if c.cfg.URL == "" {
+		return errors.New("missing webhook url")
+	}
+	if c.cfg.Timeout <= 0 {
+		c.cfg.Timeout = defaultTimeout
+	}
+	if c.cfg.Title == "" {
+		c.cfg.Title = defaultTitle
+	}
+	colors := make(map[string]string, len(defaultColors)+len(c.cfg.Colors))
+	for k, v := range defaultColors {
+		colors[k] = v
+	}
+	for k, v := range c.cfg.Colors {
+		colors[strings.ToLower(k)] = v
+	}
+	c.cfg.Colors = colors
+	if c.cfg.MaxRetries < 0 {
+		c.cfg.MaxRetries = 0
+	} else if c.cfg.MaxRetries == 0 {
+		c.cfg.MaxRetries = defaultMaxRetries
+	}
+	if c.cfg.RetryWait <= 0 {
+		c.cfg.RetryWait = defaultRetryWait
+	}
+	if c.cfg.NumWorkers <= 0 {
+		c.cfg.NumWorkers = defaultNumWorkers
+	}
+	if c.cfg.WriteTimeout <= 0 {
+		c.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (c *ChatOutput) worker(ctx context.Context, idx int) {
+	defer c.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	c.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case m := <-c.msgChan:
+			msg, sc := tracing.Unwrap(m)
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range c.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					c.logger.Errorf("failed to apply processor: %v", err)
+					c.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			v := utils.TemplateData(data)
+			body, err := c.payload(v)
+			if err != nil {
+				c.logger.Errorf("%s failed to build payload: %v", workerLogPrefix, err)
+				c.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			var key string
+			if c.dedupe != nil {
+				key = string(body)
+				if tpl, ok := c.tpls["dedupe-key"]; ok {
+					key, err = execute(tpl, v)
+					if err != nil {
+						c.logger.Errorf("%s failed to build dedupe key: %v", workerLogPrefix, err)
+						c.deadLetter.Send(ctx, msg, err)
+						continue
+					}
+				}
+				if c.dedupe.seen(key) {
+					if c.cfg.Debug {
+						c.logger.Debugf("%s duplicate message within %s, dropping", workerLogPrefix, c.cfg.DedupeWindow)
+					}
+					continue
+				}
+			}
+			if c.cfg.Debug {
+				c.logger.Debugf("%s posting: %s", workerLogPrefix, string(body))
+			}
+			first := time.Now()
+			attempts, err := c.post(trace.ContextWithSpanContext(ctx, sc), body)
+			if err != nil {
+				c.logger.Errorf("%s failed to post message: %v", workerLogPrefix, err)
+				c.deadLetter.SendRetried(ctx, msg, err, attempts, first)
+				continue
+			}
+			if c.dedupe != nil {
+				c.dedupe.add(key)
+			}
+		}
+	}
+}
+
+// payload renders the webhook request body for event v.
+func (c *ChatOutput) payload(v interface{}) ([]byte, error) {
+	if tpl, ok := c.tpls["payload"]; ok {
+		s, err := execute(tpl, v)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("payload is not valid JSON: %s", s)
+		}
+		return []byte(s), nil
+	}
+	m := new(Message)
+	var err error
+	for _, t := range []struct {
+		name string
+		dst  *string
+	}{
+		{"title", &m.Title},
+		{"text", &m.Text},
+		{"link", &m.Link},
+		{"color", &m.Color},
+	} {
+		tpl, ok := c.tpls[t.name]
+		if !ok {
+			continue
+		}
+		*t.dst, err = execute(tpl, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.name, err)
+		}
+		*t.dst = strings.TrimSpace(*t.dst)
+	}
+	if tpl, ok := c.tpls["severity"]; ok && m.Color == "" {
+		sev, err := execute(tpl, v)
+		if err != nil {
+			return nil, fmt.Errorf("severity: %v", err)
+		}
+		m.Color = c.cfg.Colors[strings.ToLower(strings.TrimSpace(sev))]
+	}
+	if _, ok := c.tpls["text"]; !ok {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		m.Text = string(b)
+	}
+	for _, f := range c.fields {
+		s, err := execute(f.value, v)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", f.cfg.Name, err)
+		}
+		m.Fields = append(m.Fields, &Field{Name: f.cfg.Name, Value: s, Short: f.cfg.Short})
+	}
+	return json.Marshal(c.formatter.Payload(m))
+}
+
+// post sends body to the webhook, retrying on connection errors, 429 and 5xx responses.
+// It returns the number of attempts made.
+func (c *ChatOutput) post(ctx context.Context, body []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		wait, err := c.send(ctx, body)
+		if err == nil {
+			return attempt + 1, nil
+		}
+		if wait < 0 || attempt >= c.cfg.MaxRetries {
+			return attempt + 1, err
+		}
+		if wait == 0 {
+			wait = c.cfg.RetryWait * time.Duration(1<<attempt)
+		}
+		c.logger.Warnf("post attempt %d failed, retrying in %s: %v", attempt+1, wait, err)
+		select {
+		case <-ctx.Done():
+			return attempt + 1, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send posts body once, the returned duration is negative if the request must not be retried,
+// 0 to use the default wait or the server requested wait time.
+func (c *ChatOutput) send(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := tracing.Do(ctx, c.client, req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, rsp.Body)
+		return 0, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024))
+	err = fmt.Errorf("status %s: %s", rsp.Status, strings.TrimSpace(string(msg)))
+	switch {
+	case rsp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(rsp.Header.Get("Retry-After")), err
+	case rsp.StatusCode >= 500:
+		return 0, err
+	default:
+		return -1, err
+	}
+}
+
+// retryAfter parses a Retry-After header value, in seconds or as an HTTP date.
+func retryAfter(s string) time.Duration {
+	var d time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(s); err == nil {
+		d = time.Until(t)
+	}
+	if d <= 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+// deduper reports keys added within a time window.
+type deduper struct {
+	m      sync.Mutex
+	window time.Duration
+	seenAt map[[sha256.Size]byte]time.Time
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{
+		window: window,
+		seenAt: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+// seen reports whether key was added within the window.
+func (d *deduper) seen(key string) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	now := time.Now()
+	for k, t := range d.seenAt {
+		if now.Sub(t) >= d.window {
+			delete(d.seenAt, k)
+		}
+	}
+	_, ok := d.seenAt[sha256.Sum256([]byte(key))]
+	return ok
+}
+
+// add records key, it is called once the message is posted
+// so that a failed message is not dropped when it is sent again.
+func (d *deduper) add(key string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.seenAt[sha256.Sum256([]byte(key))] = time.Now()
+}
+
+func execute(tpl *template.Template, v interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := tpl.Execute(buf, v)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
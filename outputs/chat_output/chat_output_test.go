@@ -0,0 +1,276 @@
+package chat_output
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/outputstest"
+	log "github.com/sirupsen/logrus"
+)
+
+type testFormatter struct{}
+
+func (testFormatter) Payload(m *Message) interface{} { return m }
+
+type response struct {
+	code       int
+	retryAfter string
+}
+
+// webhookServer answers the posted messages with the given responses in turn,
+// the last one is repeated.
+func webhookServer(t *testing.T, rsps ...response) (*httptest.Server, chan string) {
+	t.Helper()
+	bodies := make(chan string, 10)
+	m := new(sync.Mutex)
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+		m.Lock()
+		rsp := rsps[n]
+		if n < len(rsps)-1 {
+			n++
+		}
+		m.Unlock()
+		if rsp.retryAfter != "" {
+			w.Header().Set("Retry-After", rsp.retryAfter)
+		}
+		w.WriteHeader(rsp.code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, bodies
+}
+
+func newTestOutput(t *testing.T, c map[string]interface{}) (*ChatOutput, *outputstest.Failures) {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	dl := new(outputstest.Failures)
+	o := New(testFormatter{}, "test_output")
+	err := o.Init(context.Background(), c,
+		outputs.WithLogger(logger),
+		outputs.WithDeadLetter(outputs.NewDeadLetter(dl, log.NewEntry(logger))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, dl
+}
+
+func nextBody(t *testing.T, bodies chan string) string {
+	t.Helper()
+	select {
+	case b := <-bodies:
+		return b
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a post")
+	}
+	return ""
+}
+
+func noBody(t *testing.T, bodies chan string) {
+	t.Helper()
+	select {
+	case b := <-bodies:
+		t.Fatalf("unexpected post %s", b)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPayload(t *testing.T) {
+	srv, bodies := webhookServer(t, response{code: http.StatusOK})
+	o, dl := newTestOutput(t, map[string]interface{}{
+		"url":      srv.URL,
+		"title":    "{{.name}} is {{.state}}",
+		"link":     "http://nms/{{.name}}",
+		"severity": "{{.sev}}",
+		"fields": []interface{}{
+			map[string]interface{}{"name": "state", "value": "{{.state}}", "short": true},
+		},
+	})
+	defer o.Close()
+	err := o.Write(context.Background(), []byte(`{"name":"r1","state":"down","sev":"Major"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Title":"r1 is down","Text":"{\n  \"name\": \"r1\",\n  \"sev\": \"Major\",\n  \"state\": \"down\"\n}",` +
+		`"Link":"http://nms/r1","Color":"#E8912D","Fields":[{"Name":"state","Value":"down","Short":true}]}`
+	if b := nextBody(t, bodies); b != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+	if fs := dl.List(); len(fs) != 0 {
+		t.Errorf("unexpected dead letters %v", fs)
+	}
+}
+
+func TestPayloadTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", payload: `{"text":{{json .msg}}}`, want: `{"text":"a \"b\""}`},
+		{name: "invalid JSON", payload: `{"text":{{.msg}}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := webhookServer(t, response{code: http.StatusOK})
+			o, dl := newTestOutput(t, map[string]interface{}{"url": srv.URL, "payload": tt.payload})
+			err := o.Write(context.Background(), []byte(`{"msg":"a \"b\""}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				noBody(t, bodies)
+				o.Close()
+				if fs := dl.List(); len(fs) != 1 {
+					t.Errorf("got %d dead letters, want 1", len(fs))
+				}
+				return
+			}
+			if b := nextBody(t, bodies); b != tt.want {
+				t.Errorf("got %s, want %s", b, tt.want)
+			}
+			o.Close()
+		})
+	}
+}
+
+func TestPostRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		rsps         []response
+		wantPosts    int
+		wantAttempts int
+		minElapsed   time.Duration
+	}{
+		{
+			name:      "server error then success",
+			rsps:      []response{{code: http.StatusBadGateway}, {code: http.StatusOK}},
+			wantPosts: 2,
+		},
+		{
+			name:       "rate limited with retry-after",
+			rsps:       []response{{code: http.StatusTooManyRequests, retryAfter: "1"}, {code: http.StatusNoContent}},
+			wantPosts:  2,
+			minElapsed: time.Second,
+		},
+		{
+			name:         "bad request not retried",
+			rsps:         []response{{code: http.StatusBadRequest}},
+			wantPosts:    1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "max retries",
+			rsps:         []response{{code: http.StatusTooManyRequests}},
+			wantPosts:    3,
+			wantAttempts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := webhookServer(t, tt.rsps...)
+			o, dl := newTestOutput(t, map[string]interface{}{
+				"url":         srv.URL,
+				"max-retries": 2,
+				"retry-wait":  "10ms",
+			})
+			start := time.Now()
+			err := o.Write(context.Background(), []byte(`{"a":1}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.wantPosts; i++ {
+				nextBody(t, bodies)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.minElapsed)
+			}
+			noBody(t, bodies)
+			o.Close()
+			fs := dl.List()
+			if tt.wantAttempts == 0 {
+				if len(fs) != 0 {
+					t.Errorf("unexpected dead letters %v", fs)
+				}
+				return
+			}
+			if len(fs) != 1 {
+				t.Fatalf("got %d dead letters, want 1", len(fs))
+			}
+			if fs[0].Attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", fs[0].Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "", want: 0},
+		{in: "3", want: 3 * time.Second},
+		{in: " 3 ", want: 3 * time.Second},
+		{in: "-1", want: 0},
+		{in: "3600", want: maxRetryAfter},
+		{in: "soon", want: 0},
+		{in: "Mon, 01 Jan 2001 00:00:00 GMT", want: 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.in); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	srv, bodies := webhookServer(t,
+		response{code: http.StatusOK},
+		response{code: http.StatusBadRequest},
+		response{code: http.StatusOK},
+	)
+	o, dl := newTestOutput(t, map[string]interface{}{
+		"url":           srv.URL,
+		"title":         "{{.name}}",
+		"text":          "{{.state}}",
+		"dedupe-window": "1m",
+		"dedupe-key":    "{{.name}}",
+	})
+	defer o.Close()
+	write := func(ev string) {
+		err := o.Write(context.Background(), []byte(ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// posted
+	write(`{"name":"r1","state":"down"}`)
+	nextBody(t, bodies)
+	// same key, dropped
+	write(`{"name":"r1","state":"up"}`)
+	noBody(t, bodies)
+	// new key, rejected, so not recorded
+	write(`{"name":"r2","state":"down"}`)
+	nextBody(t, bodies)
+	noBody(t, bodies)
+	// sent again
+	write(`{"name":"r2","state":"down"}`)
+	want := `{"Title":"r2","Text":"down","Link":"","Color":"","Fields":null}`
+	if b := nextBody(t, bodies); b != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+	if fs := dl.List(); len(fs) != 1 {
+		t.Errorf("got %d dead letters, want 1", len(fs))
+	}
+}
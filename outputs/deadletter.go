@@ -0,0 +1,102 @@
+package outputs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Pipeline stages reported in a Failure.
+const (
+	StageProcessor = "processor"
+	StageAction    = "action"
+	StageOutput    = "output"
+)
+
+// Failure is the record written to a dead-letter output.
+type Failure struct {
+	// the trigger event for processor and action failures,
+	// the event written to the output for output failures.
+	Event interface{} `json:"event,omitempty"`
+	Stage string      `json:"stage,omitempty"`
+	// name of the failing processor, action or output
+	Name         string    `json:"name,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Attempts     int       `json:"attempts,omitempty"`
+	FirstAttempt time.Time `json:"first-attempt,omitempty"`
+	LastAttempt  time.Time `json:"last-attempt,omitempty"`
+}
+
+// DeadLetter writes the events failing a pipeline stage to an output.
+// Its methods are safe to call on a nil *DeadLetter, the failures are then discarded.
+type DeadLetter struct {
+	output Output
+	logger *log.Entry
+	stage  string
+	name   string
+}
+
+// NewDeadLetter returns a DeadLetter writing to output o,
+// l logs the failures to write to o.
+func NewDeadLetter(o Output, l *log.Entry) *DeadLetter {
+	return &DeadLetter{output: o, logger: l}
+}
+
+// For returns a DeadLetter sharing d's output, reporting failures of the named stage.
+func (d *DeadLetter) For(stage, name string) *DeadLetter {
+	if d == nil {
+		return nil
+	}
+	return &DeadLetter{output: d.output, logger: d.logger, stage: stage, name: name}
+}
+
+// Send writes a Failure of event ev after a single attempt to the dead-letter output.
+func (d *DeadLetter) Send(ctx context.Context, ev interface{}, err error) {
+	d.SendRetried(ctx, ev, err, 1, time.Now())
+}
+
+// SendRetried writes a Failure of event ev to the dead-letter output,
+// first is the time of the first of the attempts.
+func (d *DeadLetter) SendRetried(ctx context.Context, ev interface{}, err error, attempts int, first time.Time) {
+	if d == nil {
+		return
+	}
+	f := &Failure{
+		Event:        failedEvent(ev),
+		Stage:        d.stage,
+		Name:         d.name,
+		Attempts:     attempts,
+		FirstAttempt: first,
+		LastAttempt:  time.Now(),
+	}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	b, err := json.Marshal(f)
+	if err == nil {
+		err = d.output.Write(ctx, b)
+	}
+	if err != nil {
+		d.logger.Errorf("failed to write %s %q failure to dead-letter output: %v", d.stage, d.name, err)
+	}
+}
+
+// WithDeadLetter sets the dead-letter output of an output.
+func WithDeadLetter(d *DeadLetter) Option {
+	return func(o Output) {
+		o.WithDeadLetter(d)
+	}
+}
+
+// failedEvent keeps JSON events readable in the Failure record.
+func failedEvent(ev interface{}) interface{} {
+	if b, ok := ev.([]byte); ok {
+		if json.Valid(b) {
+			return json.RawMessage(b)
+		}
+		return string(b)
+	}
+	return ev
+}
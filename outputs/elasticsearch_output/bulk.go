@@ -0,0 +1,79 @@
+package elasticsearch_output
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var templateFuncs = template.FuncMap{
+	"now": time.Now,
+}
+
+// bulkItem is a single action of a _bulk request.
+type bulkItem struct {
+	meta []byte
+	doc  []byte
+	// number of failed attempts
+	attempts int
+	// the event received by the output and when it was first sent
+	msg   interface{}
+	first time.Time
+	// span context of the output write, if traced
+	span trace.SpanContext
+}
+
+func itemSpans(items []*bulkItem) []trace.SpanContext {
+	spans := make([]trace.SpanContext, 0, len(items))
+	for _, it := range items {
+		spans = append(spans, it.span)
+	}
+	return spans
+}
+
+type bulkMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
+
+func newBulkItem(action, index, id string, doc []byte) (*bulkItem, error) {
+	meta, err := json.Marshal(map[string]bulkMeta{
+		action: {Index: index, ID: id},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bulkItem{meta: meta, doc: doc}, nil
+}
+
+func bulkBody(items []*bulkItem) []byte {
+	buf := new(bytes.Buffer)
+	for _, it := range items {
+		buf.Write(it.meta)
+		buf.WriteByte('\n')
+		buf.Write(it.doc)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// result returns the status and error of the i-th response item.
+func (r *bulkResponse) result(i int) (int, string) {
+	for _, it := range r.Items[i] {
+		return it.Status, string(it.Error)
+	}
+	return 0, "missing item"
+}
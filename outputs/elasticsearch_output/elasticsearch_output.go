@@ -0,0 +1,476 @@
+package elasticsearch_output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outputName           = "elasticsearch"
+	defaultURL           = "http://localhost:9200"
+	defaultIndex         = `orbrs-{{ now.Format "2006.01.02" }}`
+	defaultAction        = actionIndex
+	defaultBatchSize     = 500
+	defaultFlushInterval = 5 * time.Second
+	defaultMaxRetries    = 3
+	defaultRetryWait     = time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultNumWorkers    = 1
+	defaultWriteTimeout  = 5 * time.Second
+	loggingPrefix        = "elasticsearch_output"
+
+	actionIndex  = "index"
+	actionCreate = "create"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &ElasticsearchOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type ElasticsearchOutput struct {
+	cfg *cfg
+
+	ctx       context.Context
+	cfn       context.CancelFunc
+	index     *utils.Expr
+	docID     *utils.Expr
+	client    *http.Client
+	itemChan  chan *bulkItem
+	batcherWG *sync.WaitGroup
+	// index of the URL requests are sent to
+	urlIdx     int
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	// cluster nodes, the next one is tried on connection errors
+	URLs     []string `mapstructure:"urls,omitempty"`
+	Username string   `mapstructure:"username,omitempty"`
+	Password string   `mapstructure:"password,omitempty"`
+	// base64 encoded API key, sent as "Authorization: ApiKey <api-key>"
+	APIKey string           `mapstructure:"api-key,omitempty"`
+	TLS    *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	// index name, Go template executed against each event,
+	// the now function returns the current time.
+	Index string `mapstructure:"index,omitempty"`
+	// jq expression or Go template extracting the document ID from the event,
+	// IDs are generated by the cluster if unset
+	DocID string `mapstructure:"doc-id,omitempty"`
+	// bulk action, index or create.
+	// create does not overwrite existing documents, conflicts are not errors.
+	Action        string        `mapstructure:"action,omitempty"`
+	BatchSize     int           `mapstructure:"batch-size,omitempty"`
+	FlushInterval time.Duration `mapstructure:"flush-interval,omitempty"`
+	// retries of failed requests and items rejected with 429 or 5xx, none if negative
+	MaxRetries   int           `mapstructure:"max-retries,omitempty"`
+	RetryWait    time.Duration `mapstructure:"retry-wait,omitempty"`
+	Timeout      time.Duration `mapstructure:"timeout,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (e *ElasticsearchOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, e.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	err = e.setDefaults()
+	if err != nil {
+		return err
+	}
+	e.index, err = utils.NewExpr("index", e.cfg.Index, templateFuncs)
+	if err != nil {
+		return fmt.Errorf("index: %v", err)
+	}
+	if e.cfg.DocID != "" {
+		e.docID, err = utils.NewExpr("doc-id", e.cfg.DocID, templateFuncs)
+		if err != nil {
+			return fmt.Errorf("doc-id: %v", err)
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if e.cfg.TLS != nil {
+		tr.TLSClientConfig, err = e.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	e.client = &http.Client{Transport: tr, Timeout: e.cfg.Timeout}
+
+	e.ctx, e.cfn = context.WithCancel(ctx)
+	e.logger.Infof("output starting with config: %+v", e.cfg)
+	e.itemChan = make(chan *bulkItem, e.cfg.BatchSize)
+	e.batcherWG = new(sync.WaitGroup)
+	e.batcherWG.Add(1)
+	go e.batcher()
+	e.wg.Add(e.cfg.NumWorkers)
+	for i := 0; i < e.cfg.NumWorkers; i++ {
+		go e.worker(e.ctx, i)
+	}
+	return nil
+}
+
+func (e *ElasticsearchOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		e.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			e.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			e.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			e.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, e.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case e.msgChan <- tracing.Wrap(ctx, d):
+	}
+	return nil
+}
+
+// Close stops the workers and flushes the pending batch,
+// the items of a request in flight or waiting for a retry are dead-lettered.
+func (e *ElasticsearchOutput) Close() error {
+	if e.cfn != nil {
+		e.cfn()
+	}
+	e.wg.Wait()
+	if e.itemChan != nil {
+		close(e.itemChan)
+		e.batcherWG.Wait()
+	}
+	return nil
+}
+
+func (e *ElasticsearchOutput) WithLogger(logger *log.Logger) {
+	if e.logger == nil {
+		e.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (e *ElasticsearchOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range e.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			e.procs = append(e.procs, p)
+			continue
+		}
+		e.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (e *ElasticsearchOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	e.deadLetter = d
+}
+
+func (e *ElasticsearchOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, e.cfg)
+	if err != nil {
+		return err
+	}
+	return e.setDefaults()
+}
+
+func (e *ElasticsearchOutput) setDefaults() error {
+	if len(e.cfg.URLs) == 0 {
+		e.cfg.URLs = []string{defaultURL}
+	}
+	for i, u := range e.cfg.URLs {
+		e.cfg.URLs[i] = strings.TrimSuffix(u, "/")
+	}
+	if e.cfg.Index == "" {
+		e.cfg.Index = defaultIndex
+	}
+	switch e.cfg.Action {
+	case "":
+		e.cfg.Action = defaultAction
+	case actionIndex, actionCreate:
+	default:
+		return fmt.Errorf("unknown action %q", e.cfg.Action)
+	}
+	if e.cfg.BatchSize <= 0 {
+		e.cfg.BatchSize = defaultBatchSize
+	}
+	if e.cfg.FlushInterval <= 0 {
+		e.cfg.FlushInterval = defaultFlushInterval
+	}
+	if e.cfg.MaxRetries < 0 {
+		e.cfg.MaxRetries = 0
+	} else if e.cfg.MaxRetries == 0 {
+		e.cfg.MaxRetries = defaultMaxRetries
+	}
+	if e.cfg.RetryWait <= 0 {
+		e.cfg.RetryWait = defaultRetryWait
+	}
+	if e.cfg.Timeout <= 0 {
+		e.cfg.Timeout = defaultTimeout
+	}
+	if e.cfg.NumWorkers <= 0 {
+		e.cfg.NumWorkers = defaultNumWorkers
+	}
+	if e.cfg.WriteTimeout <= 0 {
+		e.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (e *ElasticsearchOutput) worker(ctx context.Context, idx int) {
+	defer e.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	e.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			e.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case m := <-e.msgChan:
+			msg, sc := tracing.Unwrap(m)
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range e.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					e.logger.Errorf("failed to apply processor: %v", err)
+					e.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			it, err := e.newItem(data)
+			if err != nil {
+				e.logger.Errorf("%s failed to build bulk item: %v", workerLogPrefix, err)
+				e.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			it.msg, it.first, it.span = msg, time.Now(), sc
+			select {
+			case <-ctx.Done():
+				return
+			case e.itemChan <- it:
+			}
+		}
+	}
+}
+
+func (e *ElasticsearchOutput) newItem(data interface{}) (*bulkItem, error) {
+	doc, err := utils.ToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var ev interface{}
+	err = json.Unmarshal(doc, &ev)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ev.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("documents must be objects, got %T", ev)
+	}
+	index, err := e.index.EvalString(ev)
+	if err != nil {
+		return nil, fmt.Errorf("index: %v", err)
+	}
+	var id string
+	if e.docID != nil {
+		id, err = e.docID.EvalString(ev)
+		if err != nil {
+			return nil, fmt.Errorf("doc-id: %v", err)
+		}
+	}
+	// the document must fit on a single line
+	buf := new(bytes.Buffer)
+	err = json.Compact(buf, doc)
+	if err != nil {
+		return nil, err
+	}
+	return newBulkItem(e.cfg.Action, index, id, buf.Bytes())
+}
+
+// batcher sends items in batches of batch-size or every flush-interval,
+// it returns once itemChan is closed and the remaining items are sent.
+func (e *ElasticsearchOutput) batcher() {
+	defer e.batcherWG.Done()
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*bulkItem, 0, e.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		e.writeBatch(ctx, batch)
+		batch = make([]*bulkItem, 0, e.cfg.BatchSize)
+	}
+	for {
+		select {
+		case it, ok := <-e.itemChan:
+			if !ok {
+				// the output context is done, the last batch gets timeout to be sent
+				ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+				flush(ctx)
+				cancel()
+				return
+			}
+			batch = append(batch, it)
+			if len(batch) >= e.cfg.BatchSize {
+				flush(e.ctx)
+			}
+		case <-ticker.C:
+			flush(e.ctx)
+		}
+	}
+}
+
+// writeBatch sends items to the _bulk API,
+// retrying the whole request or the items rejected with a retryable status.
+// It stops retrying once ctx is done.
+func (e *ElasticsearchOutput) writeBatch(ctx context.Context, items []*bulkItem) {
+	wait := e.cfg.RetryWait
+	for attempt := 0; len(items) > 0; attempt++ {
+		rsp, err := e.post(ctx, bulkBody(items), itemSpans(items))
+		if err != nil {
+			e.logger.Warnf("bulk request failed: %v", err)
+			if attempt >= e.cfg.MaxRetries || !e.retryWait(ctx, len(items), wait) {
+				e.logger.Errorf("failed to send %d items: %v", len(items), err)
+				for _, it := range items {
+					e.deadLetter.SendRetried(context.Background(), it.msg, err, attempt+1, it.first)
+				}
+				return
+			}
+			wait *= 2
+			continue
+		}
+		if !rsp.Errors {
+			return
+		}
+		if len(rsp.Items) != len(items) {
+			err = fmt.Errorf("bulk response has %d items, expected %d", len(rsp.Items), len(items))
+			e.logger.Error(err)
+			for _, it := range items {
+				e.deadLetter.SendRetried(context.Background(), it.msg, err, it.attempts+1, it.first)
+			}
+			return
+		}
+		retry := make([]*bulkItem, 0)
+		var lastErr error
+		for i, it := range items {
+			status, reason := rsp.result(i)
+			switch {
+			case status/100 == 2:
+			case status == http.StatusConflict && e.cfg.Action == actionCreate:
+			case status == http.StatusTooManyRequests || status >= 500:
+				it.attempts++
+				lastErr = fmt.Errorf("status %d: %s", status, reason)
+				if it.attempts > e.cfg.MaxRetries {
+					e.logger.Errorf("item %s failed after %d attempts: %v", it.meta, it.attempts, lastErr)
+					e.deadLetter.SendRetried(context.Background(), it.msg, lastErr, it.attempts, it.first)
+					continue
+				}
+				retry = append(retry, it)
+			default:
+				e.logger.Errorf("item %s failed: status %d: %s", it.meta, status, reason)
+				e.deadLetter.SendRetried(context.Background(), it.msg, fmt.Errorf("status %d: %s", status, reason), it.attempts+1, it.first)
+			}
+		}
+		if len(retry) > 0 && !e.retryWait(ctx, len(retry), wait) {
+			e.logger.Errorf("failed to send %d items: %v", len(retry), ctx.Err())
+			for _, it := range retry {
+				e.deadLetter.SendRetried(context.Background(), it.msg, lastErr, it.attempts, it.first)
+			}
+			return
+		}
+		wait *= 2
+		items = retry
+	}
+}
+
+// retryWait waits before retrying n items, it returns false if ctx is done first.
+func (e *ElasticsearchOutput) retryWait(ctx context.Context, n int, wait time.Duration) bool {
+	e.logger.Warnf("retrying %d items in %s", n, wait)
+	timer := time.NewTimer(wait)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// post sends a _bulk request, it returns an error if the whole request failed.
+func (e *ElasticsearchOutput) post(ctx context.Context, body []byte, spans []trace.SpanContext) (*bulkResponse, error) {
+	u := e.cfg.URLs[e.urlIdx] + "/_bulk"
+	if e.cfg.Debug {
+		e.logger.Debugf("sending bulk request to %s: %s", u, string(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.cfg.APIKey)
+	} else if e.cfg.Username != "" {
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	}
+	rsp, err := tracing.Do(ctx, e.client, req, spans...)
+	if err != nil {
+		if ctx.Err() == nil {
+			// try the next node
+			e.urlIdx = (e.urlIdx + 1) % len(e.cfg.URLs)
+		}
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return nil, fmt.Errorf("status %s: %s", rsp.Status, strings.TrimSpace(string(msg)))
+	}
+	br := new(bulkResponse)
+	err = json.NewDecoder(rsp.Body).Decode(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %v", err)
+	}
+	return br, nil
+}
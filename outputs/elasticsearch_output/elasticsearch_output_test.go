@@ -0,0 +1,301 @@
+package elasticsearch_output
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/outputstest"
+	log "github.com/sirupsen/logrus"
+)
+
+// bulkReply is the answer of the _bulk stand-in to a request,
+// an item status per document of the request if code is 200.
+type bulkReply struct {
+	code     int
+	statuses []int
+}
+
+type request struct {
+	path string
+	auth string
+	// action and document lines
+	lines []string
+}
+
+// bulkServer answers the _bulk requests with the given replies in turn,
+// the last one is repeated.
+func bulkServer(t *testing.T, replies ...bulkReply) (*httptest.Server, chan *request) {
+	t.Helper()
+	reqs := make(chan *request, 10)
+	m := new(sync.Mutex)
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- &request{
+			path:  r.URL.Path,
+			auth:  r.Header.Get("Authorization"),
+			lines: strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"),
+		}
+		m.Lock()
+		reply := replies[n]
+		if n < len(replies)-1 {
+			n++
+		}
+		m.Unlock()
+		if reply.code != http.StatusOK {
+			http.Error(w, "boom", reply.code)
+			return
+		}
+		rsp := &bulkResponse{}
+		for _, st := range reply.statuses {
+			it := bulkResponseItem{Status: st}
+			if st/100 != 2 {
+				rsp.Errors = true
+				it.Error = json.RawMessage(`{"type":"error"}`)
+			}
+			rsp.Items = append(rsp.Items, map[string]bulkResponseItem{"index": it})
+		}
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+func newTestOutput(t *testing.T, c map[string]interface{}) (*ElasticsearchOutput, *outputstest.Failures) {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	dl := new(outputstest.Failures)
+	e := outputs.Outputs[outputName]().(*ElasticsearchOutput)
+	err := e.Init(context.Background(), c,
+		outputs.WithLogger(logger),
+		outputs.WithDeadLetter(outputs.NewDeadLetter(dl, log.NewEntry(logger))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, dl
+}
+
+func nextRequest(t *testing.T, reqs chan *request) *request {
+	t.Helper()
+	select {
+	case r := <-reqs:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a bulk request")
+	}
+	return nil
+}
+
+func noRequest(t *testing.T, reqs chan *request) {
+	t.Helper()
+	select {
+	case r := <-reqs:
+		t.Fatalf("unexpected bulk request %v", r.lines)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	srv, reqs := bulkServer(t, bulkReply{code: http.StatusOK, statuses: []int{201, 201}})
+	e, dl := newTestOutput(t, map[string]interface{}{
+		"urls":       []string{srv.URL + "/"},
+		"api-key":    "s3cr3t",
+		"index":      "idx-{{.name}}",
+		"doc-id":     ".id",
+		"batch-size": 2,
+	})
+	defer e.Close()
+	for _, ev := range []string{`{"id":"a","name":"x"}`, "{\n  \"id\": \"b\",\n  \"name\": \"y\"\n}"} {
+		err := e.Write(context.Background(), []byte(ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := nextRequest(t, reqs)
+	if r.path != "/_bulk" {
+		t.Errorf("got path %s", r.path)
+	}
+	if r.auth != "ApiKey s3cr3t" {
+		t.Errorf("got Authorization %q", r.auth)
+	}
+	want := []string{
+		`{"index":{"_index":"idx-x","_id":"a"}}`,
+		`{"id":"a","name":"x"}`,
+		`{"index":{"_index":"idx-y","_id":"b"}}`,
+		`{"id":"b","name":"y"}`,
+	}
+	if strings.Join(r.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got body\n%s\nwant\n%s", strings.Join(r.lines, "\n"), strings.Join(want, "\n"))
+	}
+	if fs := dl.List(); len(fs) != 0 {
+		t.Errorf("unexpected dead letters %v", fs)
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		replies []bulkReply
+		// documents sent by each request
+		wantDocs [][]string
+		// dead-lettered documents and their attempts
+		wantFailures map[string]int
+	}{
+		{
+			name:     "request error then success",
+			replies:  []bulkReply{{code: http.StatusServiceUnavailable}, {code: http.StatusOK, statuses: []int{201, 201}}},
+			wantDocs: [][]string{{`{"n":1}`, `{"n":2}`}, {`{"n":1}`, `{"n":2}`}},
+		},
+		{
+			name:         "request max retries",
+			replies:      []bulkReply{{code: http.StatusInternalServerError}},
+			wantDocs:     [][]string{{`{"n":1}`, `{"n":2}`}, {`{"n":1}`, `{"n":2}`}, {`{"n":1}`, `{"n":2}`}},
+			wantFailures: map[string]int{`{"n":1}`: 3, `{"n":2}`: 3},
+		},
+		{
+			name: "rejected item retried",
+			replies: []bulkReply{
+				{code: http.StatusOK, statuses: []int{201, 429}},
+				{code: http.StatusOK, statuses: []int{201}},
+			},
+			wantDocs: [][]string{{`{"n":1}`, `{"n":2}`}, {`{"n":2}`}},
+		},
+		{
+			name: "rejected item max retries",
+			replies: []bulkReply{
+				{code: http.StatusOK, statuses: []int{503, 201}},
+				{code: http.StatusOK, statuses: []int{503}},
+			},
+			wantDocs:     [][]string{{`{"n":1}`, `{"n":2}`}, {`{"n":1}`}, {`{"n":1}`}},
+			wantFailures: map[string]int{`{"n":1}`: 3},
+		},
+		{
+			name:         "bad item not retried",
+			replies:      []bulkReply{{code: http.StatusOK, statuses: []int{400, 201}}},
+			wantDocs:     [][]string{{`{"n":1}`, `{"n":2}`}},
+			wantFailures: map[string]int{`{"n":1}`: 1},
+		},
+		{
+			name:     "create conflict ignored",
+			action:   actionCreate,
+			replies:  []bulkReply{{code: http.StatusOK, statuses: []int{409, 201}}},
+			wantDocs: [][]string{{`{"n":1}`, `{"n":2}`}},
+		},
+		{
+			name:         "index conflict",
+			replies:      []bulkReply{{code: http.StatusOK, statuses: []int{201, 409}}},
+			wantDocs:     [][]string{{`{"n":1}`, `{"n":2}`}},
+			wantFailures: map[string]int{`{"n":2}`: 1},
+		},
+		{
+			name:         "item count mismatch",
+			replies:      []bulkReply{{code: http.StatusOK, statuses: []int{400}}},
+			wantDocs:     [][]string{{`{"n":1}`, `{"n":2}`}},
+			wantFailures: map[string]int{`{"n":1}`: 1, `{"n":2}`: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, reqs := bulkServer(t, tt.replies...)
+			e, dl := newTestOutput(t, map[string]interface{}{
+				"urls":        []string{srv.URL},
+				"action":      tt.action,
+				"batch-size":  2,
+				"max-retries": 2,
+				"retry-wait":  "10ms",
+			})
+			for _, ev := range []string{`{"n":1}`, `{"n":2}`} {
+				err := e.Write(context.Background(), []byte(ev))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, docs := range tt.wantDocs {
+				r := nextRequest(t, reqs)
+				var got []string
+				for i := 1; i < len(r.lines); i += 2 {
+					got = append(got, r.lines[i])
+				}
+				if strings.Join(got, ",") != strings.Join(docs, ",") {
+					t.Errorf("got documents %v, want %v", got, docs)
+				}
+			}
+			noRequest(t, reqs)
+			e.Close()
+			fs := dl.List()
+			if len(fs) != len(tt.wantFailures) {
+				t.Fatalf("got %d dead letters, want %d", len(fs), len(tt.wantFailures))
+			}
+			for _, f := range fs {
+				b, _ := json.Marshal(f.Event)
+				attempts, ok := tt.wantFailures[string(b)]
+				if !ok {
+					t.Errorf("unexpected dead letter %s", b)
+					continue
+				}
+				if f.Attempts != attempts {
+					t.Errorf("dead letter %s after %d attempts, want %d", b, f.Attempts, attempts)
+				}
+			}
+		})
+	}
+}
+
+func TestNextNode(t *testing.T) {
+	srv, reqs := bulkServer(t, bulkReply{code: http.StatusOK, statuses: []int{201}})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	e, dl := newTestOutput(t, map[string]interface{}{
+		"urls":       []string{down.URL, srv.URL},
+		"batch-size": 1,
+		"retry-wait": "10ms",
+	})
+	err := e.Write(context.Background(), []byte(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextRequest(t, reqs)
+	noRequest(t, reqs)
+	e.Close()
+	if fs := dl.List(); len(fs) != 0 {
+		t.Errorf("unexpected dead letters %v", fs)
+	}
+}
+
+func TestCloseStopsRetryWait(t *testing.T) {
+	srv, reqs := bulkServer(t, bulkReply{code: http.StatusOK, statuses: []int{503}})
+	e, dl := newTestOutput(t, map[string]interface{}{
+		"urls":       []string{srv.URL},
+		"batch-size": 1,
+		"retry-wait": "1h",
+	})
+	err := e.Write(context.Background(), []byte(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextRequest(t, reqs)
+	closed := make(chan struct{})
+	go func() {
+		e.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by the retry wait")
+	}
+	if fs := dl.List(); len(fs) != 1 {
+		t.Errorf("got %d dead letters, want 1", len(fs))
+	}
+}
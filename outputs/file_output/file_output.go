@@ -0,0 +1,321 @@
+package file_output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	outputName          = "file"
+	defaultFilename     = fileStdout
+	defaultFormat       = formatJSON
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+	loggingPrefix       = "file_output"
+
+	fileStdout = "stdout"
+	fileStderr = "stderr"
+
+	formatJSON       = "json"
+	formatPrettyJSON = "pretty-json"
+	formatJSONL      = "jsonl"
+	formatYAML       = "yaml"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &FileOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type FileOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	tpl        *template.Template
+	m          *sync.Mutex
+	w          io.Writer
+	file       *rotatingFile
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	// path of the file to write to, or stdout/stderr
+	Filename string `mapstructure:"filename,omitempty"`
+	// json, pretty-json, jsonl or yaml
+	Format string `mapstructure:"format,omitempty"`
+	// Go template executed against each event, overrides format
+	Template string `mapstructure:"template,omitempty"`
+	// rotate the file once it grows past max-size bytes
+	MaxSize int64 `mapstructure:"max-size,omitempty"`
+	// rotate the file every rotate-interval
+	RotateInterval time.Duration `mapstructure:"rotate-interval,omitempty"`
+	// number of rotated files to keep, all of them if 0
+	MaxBackups int `mapstructure:"max-backups,omitempty"`
+	// gzip rotated files
+	Compress     bool          `mapstructure:"compress,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (f *FileOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, f.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	err = f.setDefaults()
+	if err != nil {
+		return err
+	}
+	if f.cfg.Template != "" {
+		f.tpl, err = template.New("template").Parse(f.cfg.Template)
+		if err != nil {
+			return err
+		}
+	}
+	switch f.cfg.Filename {
+	case fileStdout:
+		f.w = os.Stdout
+	case fileStderr:
+		f.w = os.Stderr
+	default:
+		f.file, err = openRotatingFile(f.cfg.Filename, f.cfg.MaxSize, f.cfg.RotateInterval, f.cfg.MaxBackups, f.cfg.Compress, f.logger)
+		if err != nil {
+			return err
+		}
+		f.w = f.file
+	}
+	f.m = new(sync.Mutex)
+	f.ctx, f.cfn = context.WithCancel(ctx)
+	f.logger.Infof("output starting with config: %+v", f.cfg)
+	f.wg.Add(f.cfg.NumWorkers)
+	for i := 0; i < f.cfg.NumWorkers; i++ {
+		go f.worker(f.ctx, i)
+	}
+	return nil
+}
+
+func (f *FileOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		f.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			f.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			f.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			f.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, f.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case f.msgChan <- d:
+	}
+	return nil
+}
+
+func (f *FileOutput) Close() error {
+	if f.cfn != nil {
+		f.cfn()
+	}
+	f.wg.Wait()
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+func (f *FileOutput) WithLogger(logger *log.Logger) {
+	if f.logger == nil {
+		f.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (f *FileOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range f.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			f.procs = append(f.procs, p)
+			continue
+		}
+		f.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (f *FileOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	f.deadLetter = d
+}
+
+func (f *FileOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, f.cfg)
+	if err != nil {
+		return err
+	}
+	return f.setDefaults()
+}
+
+func (f *FileOutput) setDefaults() error {
+	if f.cfg.Filename == "" {
+		f.cfg.Filename = defaultFilename
+	}
+	switch f.cfg.Format {
+	case "":
+		f.cfg.Format = defaultFormat
+	case formatJSON, formatPrettyJSON, formatJSONL, formatYAML:
+	default:
+		return fmt.Errorf("unknown format %q", f.cfg.Format)
+	}
+	if f.cfg.MaxSize < 0 {
+		return fmt.Errorf("max-size must be positive")
+	}
+	if f.cfg.MaxBackups < 0 {
+		return fmt.Errorf("max-backups must be positive")
+	}
+	if f.cfg.NumWorkers <= 0 {
+		f.cfg.NumWorkers = defaultNumWorkers
+	}
+	if f.cfg.WriteTimeout <= 0 {
+		f.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (f *FileOutput) worker(ctx context.Context, idx int) {
+	defer f.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	f.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			f.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-f.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range f.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					f.logger.Errorf("failed to apply processor: %v", err)
+					f.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			b, err := f.format(data)
+			if err != nil {
+				f.logger.Errorf("%s failed to format event: %v", workerLogPrefix, err)
+				f.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			f.m.Lock()
+			_, err = f.w.Write(b)
+			f.m.Unlock()
+			if err != nil {
+				f.logger.Errorf("%s failed to write: %v", workerLogPrefix, err)
+				f.deadLetter.Send(ctx, msg, err)
+			}
+		}
+	}
+}
+
+// format renders data as one or more lines terminated by a new line.
+func (f *FileOutput) format(data interface{}) ([]byte, error) {
+	v := utils.TemplateData(data)
+	if b, ok := v.([]byte); ok {
+		// not JSON, written as is
+		v = string(b)
+	}
+	buf := new(bytes.Buffer)
+	if f.tpl != nil {
+		err := f.tpl.Execute(buf, v)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteString("\n")
+		}
+		return buf.Bytes(), nil
+	}
+	switch f.cfg.Format {
+	case formatJSON:
+		b, err := utils.ToBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		// an event per line, even if it was received indented
+		err = json.Compact(buf, b)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+	case formatPrettyJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteString("\n")
+	case formatJSONL:
+		// one line per element when the event is a list
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		for _, item := range items {
+			b, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+			buf.WriteString("\n")
+		}
+	case formatYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package file_output
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "json", format: formatJSON, data: []byte(`{"a":1}`), want: "{\"a\":1}\n"},
+		{name: "json indented", format: formatJSON, data: []byte("{\n  \"a\": [\n    1,\n    2\n  ]\n}\n"), want: "{\"a\":[1,2]}\n"},
+		{name: "json value", format: formatJSON, data: map[string]interface{}{"a": 1}, want: "{\"a\":1}\n"},
+		{name: "json invalid", format: formatJSON, data: []byte("a\nb"), wantErr: true},
+		{name: "pretty-json", format: formatPrettyJSON, data: []byte(`{"a":1}`), want: "{\n  \"a\": 1\n}\n"},
+		{name: "jsonl list", format: formatJSONL, data: []byte(`[{"a":1},{"b":2}]`), want: "{\"a\":1}\n{\"b\":2}\n"},
+		{name: "yaml", format: formatYAML, data: []byte(`{"a":1}`), want: "---\na: 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FileOutput{cfg: &cfg{Format: tt.format}}
+			b, err := f.format(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
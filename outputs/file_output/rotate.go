@@ -0,0 +1,268 @@
+package file_output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// rotatingFile is an io.WriteCloser appending to a file which is renamed
+// to <path>.<timestamp>[.gz] once it reaches maxSize bytes or is older than interval.
+// Rotated files are compressed and pruned in the background.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	compress   bool
+	logger     *log.Entry
+
+	m        *sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+
+	// serializes the background compression and pruning of the rotated files
+	bm   *sync.Mutex
+	wg   *sync.WaitGroup
+	done chan struct{}
+}
+
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int, compress bool, logger *log.Entry) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		compress:   compress,
+		logger:     logger,
+		m:          new(sync.Mutex),
+		bm:         new(sync.Mutex),
+		wg:         new(sync.WaitGroup),
+		done:       make(chan struct{}),
+	}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	if r.interval > 0 {
+		r.wg.Add(1)
+		go r.rotateOnInterval()
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	err := os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return err
+	}
+	r.f, err = os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := r.f.Stat()
+	if err != nil {
+		r.f.Close()
+		return err
+	}
+	r.size = fi.Size()
+	r.openedAt = time.Now()
+	if r.size > 0 {
+		// content left by a previous run dates back to the last rotation
+		r.openedAt = r.lastRotation(fi.ModTime())
+	}
+	return nil
+}
+
+// lastRotation returns the time of the most recent backup, def if there is none.
+func (r *rotatingFile) lastRotation(def time.Time) time.Time {
+	backups, err := r.backups()
+	if err != nil || len(backups) == 0 {
+		return def
+	}
+	ts, _ := time.ParseInLocation(backupTimeFormat, backupTime(r.path, backups[len(backups)-1]), time.Local)
+	return ts
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.shouldRotate(int64(len(b))) {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if r.size == 0 {
+		r.openedAt = time.Now()
+	}
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file once the background compression completes.
+func (r *rotatingFile) Close() error {
+	close(r.done)
+	r.m.Lock()
+	err := r.f.Close()
+	r.m.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func (r *rotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+	return r.interval > 0 && time.Since(r.openedAt) >= r.interval
+}
+
+// rotateOnInterval rotates the file once it is older than interval,
+// even if nothing is written to it.
+func (r *rotatingFile) rotateOnInterval() {
+	defer r.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-timer.C:
+		}
+		r.m.Lock()
+		if r.size == 0 {
+			// nothing to rotate, Write restarts the interval on the first write
+			r.openedAt = time.Now()
+		} else if r.shouldRotate(0) {
+			err := r.rotate()
+			if err != nil {
+				r.logger.Errorf("failed to rotate %q: %v", r.path, err)
+			}
+		}
+		timer.Reset(time.Until(r.openedAt.Add(r.interval)))
+		r.m.Unlock()
+	}
+}
+
+// rotate renames the file to a backup and opens a new one, it is called with r.m held.
+func (r *rotatingFile) rotate() error {
+	err := r.f.Close()
+	if err != nil {
+		return err
+	}
+	backup := r.path + "." + time.Now().Format(backupTimeFormat)
+	err = os.Rename(r.path, backup)
+	if err != nil {
+		// keep appending to the current file
+		if oerr := r.open(); oerr != nil {
+			return fmt.Errorf("%v, reopening: %v", err, oerr)
+		}
+		return err
+	}
+	err = r.open()
+	if err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.bm.Lock()
+		defer r.bm.Unlock()
+		if r.compress {
+			err := compressFile(backup)
+			if err != nil {
+				r.logger.Errorf("failed to compress %q: %v", backup, err)
+			}
+		}
+		err := r.removeOldBackups()
+		if err != nil {
+			r.logger.Errorf("failed to remove old backups of %q: %v", r.path, err)
+		}
+	}()
+	return nil
+}
+
+// backups returns the rotated files, oldest first.
+func (r *rotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, backupTime(r.path, m)); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	// the timestamp format sorts chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func backupTime(path, backup string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(backup, path+"."), ".gz")
+}
+
+// removeOldBackups keeps the maxBackups most recent rotated files.
+func (r *rotatingFile) removeOldBackups() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= r.maxBackups {
+		return nil
+	}
+	for _, b := range backups[:len(backups)-r.maxBackups] {
+		err = os.Remove(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,103 @@
+package file_output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func testLogger() *log.Entry {
+	l := log.New()
+	l.SetOutput(ioutil.Discard)
+	return log.NewEntry(l)
+}
+
+func waitForBackups(t *testing.T, r *rotatingFile, n int, suffix string) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		backups, err := r.backups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok := len(backups) == n
+		for _, b := range backups {
+			ok = ok && strings.HasSuffix(b, suffix)
+		}
+		if ok {
+			return backups
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got backups %v, want %d ending with %q", backups, n, suffix)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRotateOnSize(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "out.log")
+	r, err := openRotatingFile(fn, 10, 0, 2, true, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < 4; i++ {
+		_, err = r.Write([]byte("0123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// distinct backup names
+		time.Sleep(2 * time.Millisecond)
+	}
+	waitForBackups(t, r, 2, ".gz")
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "0123456789" {
+		t.Errorf("got current file %q", b)
+	}
+}
+
+func TestRotateOnIntervalWithoutWrites(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "out.log")
+	r, err := openRotatingFile(fn, 0, 100*time.Millisecond, 0, false, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	_, err = r.Write([]byte("event\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForBackups(t, r, 1, "")
+	// the empty file is not rotated
+	time.Sleep(300 * time.Millisecond)
+	waitForBackups(t, r, 1, "")
+}
+
+func TestRotateIntervalAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "out.log")
+	// rotated an hour ago, appended to since
+	last := time.Now().Add(-time.Hour).Format(backupTimeFormat)
+	err := os.WriteFile(fn+"."+last, []byte("old\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(fn, []byte("event\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openRotatingFile(fn, 0, 30*time.Minute, 0, false, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	waitForBackups(t, r, 2, "")
+}
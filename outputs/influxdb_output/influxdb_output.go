@@ -0,0 +1,471 @@
+package influxdb_output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outputName           = "influxdb"
+	defaultURL           = "http://localhost:8086"
+	defaultVersion       = versionV2
+	defaultMeasurement   = "orbrs"
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 10 * time.Second
+	defaultMaxRetries    = 3
+	defaultRetryWait     = time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultNumWorkers    = 1
+	defaultWriteTimeout  = 5 * time.Second
+	loggingPrefix        = "influxdb_output"
+
+	versionV1 = "v1"
+	versionV2 = "v2"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &InfluxDBOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type InfluxDBOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	mapping    *mapping
+	writeURL   string
+	client     *http.Client
+	lineChan   chan *point
+	batcherWG  *sync.WaitGroup
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	URL string `mapstructure:"url,omitempty"`
+	// write API version, v1 or v2
+	Version string `mapstructure:"version,omitempty"`
+	// v2 write API
+	Org    string `mapstructure:"org,omitempty"`
+	Bucket string `mapstructure:"bucket,omitempty"`
+	// v1 write API
+	Database        string `mapstructure:"database,omitempty"`
+	RetentionPolicy string `mapstructure:"retention-policy,omitempty"`
+	Username        string `mapstructure:"username,omitempty"`
+	Password        string `mapstructure:"password,omitempty"`
+	// sent as "Authorization: Token <token>"
+	Token string           `mapstructure:"token,omitempty"`
+	TLS   *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	// measurement name, Go template executed against each event
+	Measurement string `mapstructure:"measurement,omitempty"`
+	// tag and field names to jq expressions or Go templates,
+	// the event top level scalar values are used as fields if none is set
+	Tags   map[string]string `mapstructure:"tags,omitempty"`
+	Fields map[string]string `mapstructure:"fields,omitempty"`
+	// jq expression or Go template returning nanoseconds or an RFC3339 string,
+	// the reception time is used if unset
+	Timestamp     string        `mapstructure:"timestamp,omitempty"`
+	BatchSize     int           `mapstructure:"batch-size,omitempty"`
+	FlushInterval time.Duration `mapstructure:"flush-interval,omitempty"`
+	// retries on connection errors, 429 and 5xx responses, none if negative
+	MaxRetries   int           `mapstructure:"max-retries,omitempty"`
+	RetryWait    time.Duration `mapstructure:"retry-wait,omitempty"`
+	Timeout      time.Duration `mapstructure:"timeout,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (i *InfluxDBOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, i.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	err = i.setDefaults()
+	if err != nil {
+		return err
+	}
+	i.mapping, err = newMapping(i.cfg)
+	if err != nil {
+		return err
+	}
+	i.writeURL, err = i.buildWriteURL()
+	if err != nil {
+		return err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if i.cfg.TLS != nil {
+		tr.TLSClientConfig, err = i.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	i.client = &http.Client{Transport: tr, Timeout: i.cfg.Timeout}
+
+	i.ctx, i.cfn = context.WithCancel(ctx)
+	i.logger.Infof("output starting with config: %+v", i.cfg)
+	i.lineChan = make(chan *point, i.cfg.BatchSize)
+	i.batcherWG = new(sync.WaitGroup)
+	i.batcherWG.Add(1)
+	go i.batcher()
+	i.wg.Add(i.cfg.NumWorkers)
+	for idx := 0; idx < i.cfg.NumWorkers; idx++ {
+		go i.worker(i.ctx, idx)
+	}
+	return nil
+}
+
+func (i *InfluxDBOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		i.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			i.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			i.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			i.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, i.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case i.msgChan <- tracing.Wrap(ctx, d):
+	}
+	return nil
+}
+
+// Close stops the workers and flushes the pending batch, without retrying it.
+func (i *InfluxDBOutput) Close() error {
+	if i.cfn != nil {
+		i.cfn()
+	}
+	i.wg.Wait()
+	if i.lineChan != nil {
+		close(i.lineChan)
+		i.batcherWG.Wait()
+	}
+	return nil
+}
+
+func (i *InfluxDBOutput) WithLogger(logger *log.Logger) {
+	if i.logger == nil {
+		i.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (i *InfluxDBOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range i.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			i.procs = append(i.procs, p)
+			continue
+		}
+		i.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (i *InfluxDBOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	i.deadLetter = d
+}
+
+func (i *InfluxDBOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, i.cfg)
+	if err != nil {
+		return err
+	}
+	return i.setDefaults()
+}
+
+func (i *InfluxDBOutput) setDefaults() error {
+	if i.cfg.URL == "" {
+		i.cfg.URL = defaultURL
+	}
+	switch i.cfg.Version {
+	case "":
+		i.cfg.Version = defaultVersion
+	case versionV1, versionV2:
+	default:
+		return fmt.Errorf("unknown version %q", i.cfg.Version)
+	}
+	switch i.cfg.Version {
+	case versionV1:
+		if i.cfg.Database == "" {
+			return errors.New("missing database")
+		}
+	case versionV2:
+		if i.cfg.Org == "" || i.cfg.Bucket == "" {
+			return errors.New("missing org or bucket")
+		}
+	}
+	if i.cfg.Measurement == "" {
+		i.cfg.Measurement = defaultMeasurement
+	}
+	if i.cfg.BatchSize <= 0 {
+		i.cfg.BatchSize = defaultBatchSize
+	}
+	if i.cfg.FlushInterval <= 0 {
+		i.cfg.FlushInterval = defaultFlushInterval
+	}
+	if i.cfg.MaxRetries < 0 {
+		i.cfg.MaxRetries = 0
+	} else if i.cfg.MaxRetries == 0 {
+		i.cfg.MaxRetries = defaultMaxRetries
+	}
+	if i.cfg.RetryWait <= 0 {
+		i.cfg.RetryWait = defaultRetryWait
+	}
+	if i.cfg.Timeout <= 0 {
+		i.cfg.Timeout = defaultTimeout
+	}
+	if i.cfg.NumWorkers <= 0 {
+		i.cfg.NumWorkers = defaultNumWorkers
+	}
+	if i.cfg.WriteTimeout <= 0 {
+		i.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (i *InfluxDBOutput) buildWriteURL() (string, error) {
+	u, err := url.Parse(i.cfg.URL)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("precision", "ns")
+	switch i.cfg.Version {
+	case versionV1:
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+		q.Set("db", i.cfg.Database)
+		if i.cfg.RetentionPolicy != "" {
+			q.Set("rp", i.cfg.RetentionPolicy)
+		}
+	case versionV2:
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+		q.Set("org", i.cfg.Org)
+		q.Set("bucket", i.cfg.Bucket)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (i *InfluxDBOutput) worker(ctx context.Context, idx int) {
+	defer i.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	i.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			i.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case m := <-i.msgChan:
+			msg, sc := tracing.Unwrap(m)
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range i.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					i.logger.Errorf("failed to apply processor: %v", err)
+					i.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			evs, err := normalize(data)
+			if err != nil {
+				i.logger.Errorf("%s failed to decode event: %v", workerLogPrefix, err)
+				i.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			now := time.Now()
+			src := &source{msg: msg, first: now, span: sc}
+			for _, ev := range evs {
+				line, err := i.mapping.line(ev, now)
+				if err != nil {
+					i.logger.Errorf("%s failed to build line: %v", workerLogPrefix, err)
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case i.lineChan <- &point{line: line, src: src}:
+				}
+			}
+		}
+	}
+}
+
+// batcher writes lines in batches of batch-size or every flush-interval,
+// it returns once lineChan is closed and the remaining lines are written.
+func (i *InfluxDBOutput) batcher() {
+	defer i.batcherWG.Done()
+	ticker := time.NewTicker(i.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*point, 0, i.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		attempts, err := i.writeBatch(i.ctx, batch)
+		if err != nil {
+			i.logger.Errorf("failed to write %d lines: %v", len(batch), err)
+			i.deadLetterBatch(batch, err, attempts)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case pt, ok := <-i.lineChan:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, pt)
+			if len(batch) >= i.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// writeBatch writes the batch lines and returns the number of attempts made.
+// It stops retrying once ctx is done.
+func (i *InfluxDBOutput) writeBatch(ctx context.Context, batch []*point) (int, error) {
+	lines := make([]string, 0, len(batch))
+	spans := make([]trace.SpanContext, 0, len(batch))
+	seen := make(map[*source]bool)
+	for _, pt := range batch {
+		lines = append(lines, pt.line)
+		if !seen[pt.src] {
+			seen[pt.src] = true
+			spans = append(spans, pt.src.span)
+		}
+	}
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	if i.cfg.Debug {
+		i.logger.Debugf("writing %d lines to %s", len(batch), i.writeURL)
+	}
+	var err error
+	wait := i.cfg.RetryWait
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = i.post(body, spans)
+		if err == nil || !retry || attempt >= i.cfg.MaxRetries {
+			return attempt + 1, err
+		}
+		i.logger.Warnf("write attempt %d failed, retrying in %s: %v", attempt+1, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt + 1, err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// deadLetterBatch sends the events of a failed batch to the dead-letter output,
+// once per event even if it was written as several lines.
+func (i *InfluxDBOutput) deadLetterBatch(batch []*point, err error, attempts int) {
+	if i.deadLetter == nil {
+		return
+	}
+	sent := make(map[*source]bool)
+	for _, pt := range batch {
+		if sent[pt.src] {
+			continue
+		}
+		sent[pt.src] = true
+		i.deadLetter.SendRetried(context.Background(), pt.src.msg, err, attempts, pt.src.first)
+	}
+}
+
+// post sends body to the write API,
+// it returns true with the error if the write can be retried.
+func (i *InfluxDBOutput) post(body []byte, spans []trace.SpanContext) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, i.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.cfg.Token)
+	} else if i.cfg.Username != "" {
+		req.SetBasicAuth(i.cfg.Username, i.cfg.Password)
+	}
+	rsp, err := tracing.Do(context.Background(), i.client, req, spans...)
+	if err != nil {
+		return true, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, rsp.Body)
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, 1024))
+	err = fmt.Errorf("status %s: %s", rsp.Status, strings.TrimSpace(string(msg)))
+	return rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500, err
+}
+
+// normalize converts data to the generic JSON types expected by jq,
+// lists are expanded to one event per element.
+func normalize(data interface{}) ([]interface{}, error) {
+	b, err := utils.ToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := v.([]interface{}); ok {
+		return l, nil
+	}
+	return []interface{}{v}, nil
+}
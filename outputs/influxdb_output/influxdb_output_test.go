@@ -0,0 +1,181 @@
+package influxdb_output
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/outputstest"
+	log "github.com/sirupsen/logrus"
+)
+
+type request struct {
+	path  string
+	query string
+	auth  string
+	body  string
+}
+
+// influxServer answers the write requests with the given status codes in turn,
+// the last one is repeated.
+func influxServer(t *testing.T, codes ...int) (*httptest.Server, chan *request) {
+	t.Helper()
+	reqs := make(chan *request, 10)
+	m := new(sync.Mutex)
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- &request{path: r.URL.Path, query: r.URL.RawQuery, auth: r.Header.Get("Authorization"), body: string(b)}
+		m.Lock()
+		code := codes[n]
+		if n < len(codes)-1 {
+			n++
+		}
+		m.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+func newTestOutput(t *testing.T, c map[string]interface{}) (*InfluxDBOutput, *outputstest.Failures) {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	dl := new(outputstest.Failures)
+	i := outputs.Outputs[outputName]().(*InfluxDBOutput)
+	err := i.Init(context.Background(), c,
+		outputs.WithLogger(logger),
+		outputs.WithDeadLetter(outputs.NewDeadLetter(dl, log.NewEntry(logger))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i, dl
+}
+
+func nextRequest(t *testing.T, reqs chan *request) *request {
+	t.Helper()
+	select {
+	case r := <-reqs:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a write request")
+	}
+	return nil
+}
+
+func TestWriteBatch(t *testing.T) {
+	srv, reqs := influxServer(t, http.StatusNoContent)
+	i, dl := newTestOutput(t, map[string]interface{}{
+		"url":        srv.URL,
+		"org":        "org",
+		"bucket":     "bucket",
+		"token":      "s3cr3t",
+		"batch-size": 2,
+		"fields":     map[string]interface{}{"v": ".v"},
+		"timestamp":  ".ts",
+	})
+	defer i.Close()
+	for _, ev := range []string{`{"v":1,"ts":1}`, `{"v":2,"ts":2}`} {
+		err := i.Write(context.Background(), []byte(ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := nextRequest(t, reqs)
+	if r.path != "/api/v2/write" || r.query != "bucket=bucket&org=org&precision=ns" {
+		t.Errorf("got request %s?%s", r.path, r.query)
+	}
+	if r.auth != "Token s3cr3t" {
+		t.Errorf("got Authorization %q", r.auth)
+	}
+	if want := "orbrs v=1 1\norbrs v=2 2\n"; r.body != want {
+		t.Errorf("got body %q, want %q", r.body, want)
+	}
+	if fs := dl.List(); len(fs) != 0 {
+		t.Errorf("unexpected dead letters %v", fs)
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []int
+		wantRequests int
+		wantAttempts int
+	}{
+		{name: "server error then success", codes: []int{http.StatusServiceUnavailable, http.StatusNoContent}, wantRequests: 2},
+		{name: "rate limited then success", codes: []int{http.StatusTooManyRequests, http.StatusNoContent}, wantRequests: 2},
+		{name: "bad request not retried", codes: []int{http.StatusBadRequest}, wantRequests: 1, wantAttempts: 1},
+		{name: "max retries", codes: []int{http.StatusInternalServerError}, wantRequests: 3, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, reqs := influxServer(t, tt.codes...)
+			i, dl := newTestOutput(t, map[string]interface{}{
+				"url":         srv.URL,
+				"org":         "org",
+				"bucket":      "bucket",
+				"batch-size":  1,
+				"max-retries": 2,
+				"retry-wait":  "10ms",
+			})
+			err := i.Write(context.Background(), []byte(`{"v":1}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := 0; n < tt.wantRequests; n++ {
+				nextRequest(t, reqs)
+			}
+			i.Close()
+			if len(reqs) > 0 {
+				t.Errorf("got %d extra requests", len(reqs))
+			}
+			fs := dl.List()
+			if tt.wantAttempts == 0 {
+				if len(fs) != 0 {
+					t.Errorf("unexpected dead letters %v", fs)
+				}
+				return
+			}
+			if len(fs) != 1 || fs[0].Attempts != tt.wantAttempts {
+				t.Errorf("got dead letters %+v, want one after %d attempts", fs, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestCloseStopsRetryWait(t *testing.T) {
+	srv, reqs := influxServer(t, http.StatusServiceUnavailable)
+	i, dl := newTestOutput(t, map[string]interface{}{
+		"url":        srv.URL,
+		"org":        "org",
+		"bucket":     "bucket",
+		"batch-size": 1,
+		"retry-wait": "1h",
+	})
+	err := i.Write(context.Background(), []byte(`{"v":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextRequest(t, reqs)
+	closed := make(chan struct{})
+	go func() {
+		i.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by the retry wait")
+	}
+	if fs := dl.List(); len(fs) != 1 {
+		t.Errorf("got %d dead letters, want 1", len(fs))
+	}
+}
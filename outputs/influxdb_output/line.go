@@ -0,0 +1,210 @@
+package influxdb_output
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/karimra/ouroboros/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// mapping converts an event to a line protocol point.
+type mapping struct {
+	measurement *template.Template
+	tagKeys     []string
+	tags        []*utils.Expr
+	fieldKeys   []string
+	fields      []*utils.Expr
+	timestamp   *utils.Expr
+}
+
+func newMapping(c *cfg) (*mapping, error) {
+	var err error
+	m := new(mapping)
+	m.measurement, err = template.New("measurement").Parse(c.Measurement)
+	if err != nil {
+		return nil, err
+	}
+	m.tagKeys, m.tags, err = compileMap(c.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("tags: %v", err)
+	}
+	m.fieldKeys, m.fields, err = compileMap(c.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("fields: %v", err)
+	}
+	if c.Timestamp != "" {
+		m.timestamp, err = utils.NewExpr("timestamp", c.Timestamp, nil)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp: %v", err)
+		}
+	}
+	return m, nil
+}
+
+func compileMap(in map[string]string) ([]string, []*utils.Expr, error) {
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	exprs := make([]*utils.Expr, 0, len(keys))
+	for _, k := range keys {
+		e, err := utils.NewExpr(k, in[k], nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q: %v", k, err)
+		}
+		exprs = append(exprs, e)
+	}
+	return keys, exprs, nil
+}
+
+// line returns the line protocol representation of ev, without the trailing new line.
+func (m *mapping) line(ev interface{}, now time.Time) (string, error) {
+	buf := new(bytes.Buffer)
+	err := m.measurement.Execute(buf, ev)
+	if err != nil {
+		return "", fmt.Errorf("measurement: %v", err)
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("empty measurement")
+	}
+	sb := new(strings.Builder)
+	sb.WriteString(measurementEscaper.Replace(buf.String()))
+	for i, t := range m.tags {
+		v, err := t.Eval(ev)
+		if err != nil {
+			return "", fmt.Errorf("tag %q: %v", m.tagKeys[i], err)
+		}
+		s := toString(v)
+		if s == "" {
+			// empty tag values are not allowed
+			continue
+		}
+		sb.WriteString(",")
+		sb.WriteString(keyEscaper.Replace(m.tagKeys[i]))
+		sb.WriteString("=")
+		sb.WriteString(keyEscaper.Replace(s))
+	}
+
+	fields := make([]string, 0, len(m.fields))
+	if len(m.fields) == 0 {
+		// top level scalar values of the event
+		obj, ok := ev.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected an object, got %T", ev)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if fv, ok := fieldValue(obj[k]); ok {
+				fields = append(fields, keyEscaper.Replace(k)+"="+fv)
+			}
+		}
+	}
+	for i, f := range m.fields {
+		v, err := f.Eval(ev)
+		if err != nil {
+			return "", fmt.Errorf("field %q: %v", m.fieldKeys[i], err)
+		}
+		if fv, ok := fieldValue(v); ok {
+			fields = append(fields, keyEscaper.Replace(m.fieldKeys[i])+"="+fv)
+		}
+	}
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no field values")
+	}
+	sb.WriteString(" ")
+	sb.WriteString(strings.Join(fields, ","))
+
+	ts := now
+	if m.timestamp != nil {
+		v, err := m.timestamp.Eval(ev)
+		if err != nil {
+			return "", fmt.Errorf("timestamp: %v", err)
+		}
+		ts, err = toTime(v)
+		if err != nil {
+			return "", fmt.Errorf("timestamp: %v", err)
+		}
+	}
+	sb.WriteString(" ")
+	sb.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	return sb.String(), nil
+}
+
+// fieldValue formats v as a line protocol field value,
+// it returns false for values that cannot be fields, including NaN and infinite floats.
+func fieldValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v) + "i", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	default:
+		return "", false
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// toTime converts a number of nanoseconds or an RFC3339 string to a time.
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case float64:
+		return time.Unix(0, int64(v)), nil
+	case int:
+		return time.Unix(0, int64(v)), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	default:
+		return time.Time{}, fmt.Errorf("cannot convert %T to a time", v)
+	}
+}
+
+// point is a line protocol line and the event it was built from.
+type point struct {
+	line string
+	src  *source
+}
+
+// source is an event received by the output, shared by the points built from it.
+type source struct {
+	msg   interface{}
+	first time.Time
+	// span context of the output write, if traced
+	span trace.SpanContext
+}
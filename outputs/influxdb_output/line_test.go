@@ -0,0 +1,101 @@
+package influxdb_output
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLine(t *testing.T) {
+	now := time.Unix(0, 1000)
+	tests := []struct {
+		name    string
+		cfg     *cfg
+		ev      interface{}
+		want    string
+		wantErr string
+	}{
+		{
+			name: "top level fields",
+			cfg:  &cfg{Measurement: "if"},
+			ev: map[string]interface{}{
+				"name":   "ethernet-1/1",
+				"up":     true,
+				"mtu":    float64(1500),
+				"nested": map[string]interface{}{"a": 1},
+			},
+			want: `if mtu=1500,name="ethernet-1/1",up=true 1000`,
+		},
+		{
+			name: "escaping",
+			cfg: &cfg{
+				Measurement: "if stats,{{.kind}}",
+				Tags:        map[string]string{"dev ice": ".device"},
+				Fields:      map[string]string{"de=sc": ".desc"},
+			},
+			ev: map[string]interface{}{
+				"kind":   "x=y",
+				"device": "r1,a=b c",
+				"desc":   `say "hi" \o/`,
+			},
+			want: `if\ stats\,x=y,dev\ ice=r1\,a\=b\ c de\=sc="say \"hi\" \\o/" 1000`,
+		},
+		{
+			name: "empty tags skipped",
+			cfg:  &cfg{Measurement: "m", Tags: map[string]string{"a": ".a", "b": ".b"}, Fields: map[string]string{"v": ".v"}},
+			ev:   map[string]interface{}{"a": "", "b": "x", "v": float64(1)},
+			want: `m,b=x v=1 1000`,
+		},
+		{
+			name: "integers and templates",
+			cfg:  &cfg{Measurement: "m", Fields: map[string]string{"len": ".name | length", "s": "{{.n}}"}},
+			ev:   map[string]interface{}{"name": "abc", "n": 2.5},
+			want: `m len=3i,s="2.5" 1000`,
+		},
+		{
+			name: "nan and infinite skipped",
+			cfg:  &cfg{Measurement: "m", Fields: map[string]string{"nan": "nan", "inf": "infinite", "ninf": "-infinite", "v": ".v"}},
+			ev:   map[string]interface{}{"v": float64(1)},
+			want: `m v=1 1000`,
+		},
+		{
+			name:    "only nan",
+			cfg:     &cfg{Measurement: "m", Fields: map[string]string{"nan": "nan"}},
+			ev:      map[string]interface{}{},
+			wantErr: "no field values",
+		},
+		{
+			name: "timestamp",
+			cfg:  &cfg{Measurement: "m", Timestamp: ".ts"},
+			ev:   map[string]interface{}{"ts": "1970-01-01T00:00:01Z", "v": float64(1)},
+			want: `m ts="1970-01-01T00:00:01Z",v=1 1000000000`,
+		},
+		{
+			name:    "not an object",
+			cfg:     &cfg{Measurement: "m"},
+			ev:      []interface{}{float64(1)},
+			wantErr: "expected an object",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMapping(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.line(tt.ev, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package mattermost_output
+
+import (
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/chat_output"
+)
+
+const (
+	outputName    = "mattermost"
+	loggingPrefix = "mattermost_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return chat_output.New(formatter{}, loggingPrefix)
+	})
+}
+
+// formatter builds a message with a single message attachment.
+type formatter struct{}
+
+func (formatter) Payload(m *chat_output.Message) interface{} {
+	attachment := map[string]interface{}{
+		"fallback": m.Title,
+		"title":    m.Title,
+		"text":     m.Text,
+	}
+	if m.Link != "" {
+		attachment["title_link"] = m.Link
+	}
+	if m.Color != "" {
+		attachment["color"] = m.Color
+	}
+	if len(m.Fields) > 0 {
+		fields := make([]interface{}, 0, len(m.Fields))
+		for _, f := range m.Fields {
+			fields = append(fields, map[string]interface{}{
+				"title": f.Name,
+				"value": f.Value,
+				"short": f.Short,
+			})
+		}
+		attachment["fields"] = fields
+	}
+	return map[string]interface{}{
+		"attachments": []interface{}{attachment},
+	}
+}
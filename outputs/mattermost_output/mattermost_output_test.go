@@ -0,0 +1,88 @@
+package mattermost_output
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		c    map[string]interface{}
+		ev   string
+		want string
+	}{
+		{
+			name: "message",
+			c: map[string]interface{}{
+				"title":    "{{.name}} is {{.state}}",
+				"text":     "interface {{.if}}",
+				"link":     "http://nms/{{.name}}",
+				"severity": "{{.sev}}",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "state", "value": "{{.state}}", "short": true},
+				},
+			},
+			ev: `{"name":"r1","state":"down","sev":"ok","if":"eth0"}`,
+			want: `{"attachments":[{"fallback":"r1 is down","title":"r1 is down","text":"interface eth0",
+				"title_link":"http://nms/r1","color":"#2EB67D",
+				"fields":[{"title":"state","value":"down","short":true}]}]}`,
+		},
+		{
+			name: "defaults",
+			c:    map[string]interface{}{},
+			ev:   `{"a":1}`,
+			want: `{"attachments":[{"fallback":"orbrs event","title":"orbrs event","text":"{\n  \"a\": 1\n}"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make(chan []byte, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies <- b
+			}))
+			defer srv.Close()
+			logger := log.New()
+			logger.SetOutput(ioutil.Discard)
+			tt.c["url"] = srv.URL
+			o := outputs.Outputs[outputName]()
+			err := o.Init(context.Background(), tt.c, outputs.WithLogger(logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer o.Close()
+			err = o.Write(context.Background(), []byte(tt.ev))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b []byte
+			select {
+			case b = <-bodies:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for a post")
+			}
+			var got, want interface{}
+			err = json.Unmarshal(b, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.Unmarshal([]byte(tt.want), &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %s\nwant %s", b, tt.want)
+			}
+		})
+	}
+}
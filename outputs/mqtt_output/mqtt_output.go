@@ -0,0 +1,310 @@
+package mqtt_output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputName            = "mqtt"
+	mqttConnectWait       = 2 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+	defaultTopic          = "orbrs/events/out"
+	defaultNumWorkers     = 1
+	defaultWriteTimeout   = 5 * time.Second
+	defaultAddress        = "tcp://localhost:1883"
+	loggingPrefix         = "mqtt_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &MqttOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type MqttOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	client     mqtt.Client
+	topic      *template.Template
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	Name     string `mapstructure:"name,omitempty"`
+	Address  string `mapstructure:"address,omitempty"`
+	Username string `mapstructure:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty"`
+	// Go template executed against each event
+	Topic           string           `mapstructure:"topic,omitempty"`
+	QoS             byte             `mapstructure:"qos,omitempty"`
+	Retained        bool             `mapstructure:"retained,omitempty"`
+	TLS             *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	ConnectTimeout  time.Duration    `mapstructure:"connect-timeout,omitempty"`
+	ConnectTimeWait time.Duration    `mapstructure:"connect-time-wait,omitempty"`
+	Debug           bool             `mapstructure:"debug,omitempty"`
+	NumWorkers      int              `mapstructure:"num-workers,omitempty"`
+	WriteTimeout    time.Duration    `mapstructure:"write-timeout,omitempty"`
+	Processors      []string         `mapstructure:"processors,omitempty"`
+}
+
+func (m *MqttOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, m.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	err = m.setDefaults()
+	if err != nil {
+		return err
+	}
+	m.topic, err = template.New("topic").Parse(m.cfg.Topic)
+	if err != nil {
+		return err
+	}
+	m.ctx, m.cfn = context.WithCancel(ctx)
+	m.logger.Infof("output starting with config: %+v", m.cfg)
+	clientOpts, err := m.clientOpts()
+	if err != nil {
+		return err
+	}
+	m.client = mqtt.NewClient(clientOpts)
+	// the client keeps retrying in the background until it connects,
+	// messages published in the meantime are queued.
+	m.client.Connect()
+	m.wg.Add(m.cfg.NumWorkers)
+	for i := 0; i < m.cfg.NumWorkers; i++ {
+		go m.worker(m.ctx, i)
+	}
+	return nil
+}
+
+func (m *MqttOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		m.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			m.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			m.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			m.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, m.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case m.msgChan <- d:
+	}
+	return nil
+}
+
+// Connected reports whether the client is connected to the broker.
+func (m *MqttOutput) Connected() bool {
+	return m.client != nil && m.client.IsConnected()
+}
+
+func (m *MqttOutput) Close() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+	m.wg.Wait()
+	if m.client != nil {
+		m.client.Disconnect(250)
+	}
+	return nil
+}
+
+func (m *MqttOutput) WithLogger(logger *log.Logger) {
+	if m.logger == nil {
+		m.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (m *MqttOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range m.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			m.procs = append(m.procs, p)
+			continue
+		}
+		m.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (m *MqttOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	m.deadLetter = d
+}
+
+func (m *MqttOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, m.cfg)
+	if err != nil {
+		return err
+	}
+	return m.setDefaults()
+}
+
+func (m *MqttOutput) setDefaults() error {
+	if m.cfg.Address == "" {
+		m.cfg.Address = defaultAddress
+	}
+	if !strings.Contains(m.cfg.Address, "://") {
+		if m.cfg.TLS != nil {
+			m.cfg.Address = "ssl://" + m.cfg.Address
+		} else {
+			m.cfg.Address = "tcp://" + m.cfg.Address
+		}
+	}
+	if m.cfg.Topic == "" {
+		m.cfg.Topic = defaultTopic
+	}
+	if m.cfg.QoS > 2 {
+		return fmt.Errorf("invalid qos %d", m.cfg.QoS)
+	}
+	if m.cfg.Name == "" {
+		m.cfg.Name = "orbrs-" + uuid.New().String()
+	}
+	if m.cfg.ConnectTimeout <= 0 {
+		m.cfg.ConnectTimeout = defaultConnectTimeout
+	}
+	if m.cfg.ConnectTimeWait <= 0 {
+		m.cfg.ConnectTimeWait = mqttConnectWait
+	}
+	if m.cfg.NumWorkers <= 0 {
+		m.cfg.NumWorkers = defaultNumWorkers
+	}
+	if m.cfg.WriteTimeout <= 0 {
+		m.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (m *MqttOutput) clientOpts() (*mqtt.ClientOptions, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.cfg.Address).
+		SetClientID(m.cfg.Name).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(m.cfg.ConnectTimeWait).
+		SetMaxReconnectInterval(m.cfg.ConnectTimeWait).
+		SetConnectTimeout(m.cfg.ConnectTimeout).
+		SetOnConnectHandler(func(mqtt.Client) {
+			m.logger.Infof("connected to %s", m.cfg.Address)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			m.logger.Errorf("connection to %s lost: %v", m.cfg.Address, err)
+		})
+	if m.cfg.Username != "" {
+		opts.SetUsername(m.cfg.Username)
+		opts.SetPassword(m.cfg.Password)
+	}
+	if m.cfg.TLS != nil {
+		tlsCfg, err := m.cfg.TLS.NewTLS()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+	return opts, nil
+}
+
+func (m *MqttOutput) worker(ctx context.Context, idx int) {
+	defer m.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	m.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-m.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range m.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					m.logger.Errorf("failed to apply processor: %v", err)
+					m.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			b, err := utils.ToBytes(data)
+			if err != nil {
+				m.logger.Errorf("failed to marshal result: %v", err)
+				m.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			topic, err := m.topicName(data)
+			if err != nil {
+				m.logger.Errorf("%s failed to build topic: %v", workerLogPrefix, err)
+				m.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			if m.cfg.Debug {
+				m.logger.Debugf("%s publish to %q: %s", workerLogPrefix, topic, string(b))
+			}
+			token := m.client.Publish(topic, m.cfg.QoS, m.cfg.Retained, b)
+			if !token.WaitTimeout(m.cfg.WriteTimeout) {
+				m.logger.Errorf("%s timeout publishing to topic %q", workerLogPrefix, topic)
+				m.deadLetter.Send(ctx, msg, fmt.Errorf("timeout publishing to topic %q", topic))
+				continue
+			}
+			if err = token.Error(); err != nil {
+				m.logger.Errorf("%s failed to publish to topic %q: %v", workerLogPrefix, topic, err)
+				m.deadLetter.Send(ctx, msg, err)
+			}
+		}
+	}
+}
+
+func (m *MqttOutput) topicName(data interface{}) (string, error) {
+	if b, ok := data.([]byte); ok {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err == nil {
+			data = v
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := m.topic.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
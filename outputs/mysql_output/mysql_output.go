@@ -1 +1,71 @@
 package mysql_output
+
+import (
+	"fmt"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/sql_output"
+)
+
+const (
+	outputName    = "mysql"
+	defaultDSN    = "root@tcp(localhost:3306)/orbrs"
+	loggingPrefix = "mysql_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return sql_output.New(dialect{}, loggingPrefix)
+	})
+}
+
+type dialect struct{}
+
+func (dialect) DriverName() string { return "mysql" }
+
+func (dialect) DefaultDSN() string { return defaultDSN }
+
+func (dialect) Placeholder(int) string { return "?" }
+
+func (dialect) Quote(ident string) string { return "`" + ident + "`" }
+
+func (dialect) ColumnType(typ string, key bool) string {
+	switch typ {
+	case sql_output.TypeInteger:
+		return "BIGINT"
+	case sql_output.TypeReal:
+		return "DOUBLE"
+	case sql_output.TypeBoolean:
+		return "BOOLEAN"
+	case sql_output.TypeTimestamp:
+		return "DATETIME(6)"
+	}
+	// TEXT and JSON columns cannot be part of a primary key
+	if key {
+		return "VARCHAR(255)"
+	}
+	if typ == sql_output.TypeJSON {
+		return "JSON"
+	}
+	return "TEXT"
+}
+
+func (dialect) Upsert(columns, keys []string) string {
+	isKey := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if !isKey[c] {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", c, c))
+		}
+	}
+	if len(sets) == 0 {
+		// no-op update to ignore duplicates
+		sets = append(sets, fmt.Sprintf("%s = %s", keys[0], keys[0]))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,14 +41,22 @@ func init() {
 }
 
 type NatsOutput struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	reconnects uint64
+
 	cfg *cfg
 
-	ctx     context.Context
-	cfn     context.CancelFunc
-	procs   []processors.Processor
-	msgChan chan interface{}
-	wg      *sync.WaitGroup
-	logger  *log.Entry
+	ctx        context.Context
+	cfn        context.CancelFunc
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+
+	// the workers connections
+	m     sync.Mutex
+	conns map[*nats.Conn]struct{}
 }
 
 type cfg struct {
@@ -126,16 +135,9 @@ func (n *NatsOutput) WithLogger(logger *log.Logger) {
 	}
 }
 
-func (n *NatsOutput) WithProcessors(procs map[string]map[string]interface{}, l *log.Logger) {
+func (n *NatsOutput) WithProcessors(procs map[string]processors.Processor) {
 	for _, name := range n.cfg.Processors {
-		if pCfg, ok := procs[name]; ok {
-			n.logger.Infof("initializing processor %q", name)
-			p, err := processors.CreateProcessor(pCfg)
-			if err != nil {
-				n.logger.Errorf("failed to initialize processor %q: %v", name, err)
-				continue
-			}
-			p.Init(pCfg, processors.WithLogger(l))
+		if p, ok := procs[name]; ok {
 			n.procs = append(n.procs, p)
 			continue
 		}
@@ -143,6 +145,18 @@ func (n *NatsOutput) WithProcessors(procs map[string]map[string]interface{}, l *
 	}
 }
 
+func (n *NatsOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	n.deadLetter = d
+}
+
+func (n *NatsOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, n.cfg)
+	if err != nil {
+		return err
+	}
+	return n.setDefaults()
+}
+
 func (n *NatsOutput) setDefaults() error {
 	if n.cfg.Address == "" {
 		n.cfg.Address = defaultAddress
@@ -199,12 +213,14 @@ OUTER:
 				data, err = p.Apply(data)
 				if err != nil {
 					n.logger.Errorf("failed to apply processor: %v", err)
+					n.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
 					continue OUTER
 				}
 			}
 			b, err := n.toBytes(data)
 			if err != nil {
 				n.logger.Errorf("failed to marshal result: %v", err)
+				n.deadLetter.Send(ctx, msg, err)
 				continue
 			}
 			subject := n.subjectName(wcfg)
@@ -214,6 +230,7 @@ OUTER:
 				if n.cfg.Debug {
 					n.logger.Printf("%s failed to write to nats subject '%s': %v", workerLogPrefix, subject, err)
 				}
+				n.deadLetter.Send(ctx, msg, err)
 				natsConn.Close()
 				time.Sleep(wcfg.ConnectTimeWait)
 				goto CRCONN
@@ -234,6 +251,10 @@ func (n *NatsOutput) createNATSConn(c *cfg) (*nats.Conn, error) {
 		nats.DisconnectHandler(func(c *nats.Conn) {
 			n.logger.Println("Disconnected from NATS")
 		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			n.logger.Println("Reconnected to NATS")
+			atomic.AddUint64(&n.reconnects, 1)
+		}),
 		nats.ClosedHandler(func(c *nats.Conn) {
 			n.logger.Println("NATS connection is closed")
 		}),
@@ -245,9 +266,37 @@ func (n *NatsOutput) createNATSConn(c *cfg) (*nats.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	n.m.Lock()
+	defer n.m.Unlock()
+	if n.conns == nil {
+		n.conns = make(map[*nats.Conn]struct{})
+	}
+	for c := range n.conns {
+		if c.IsClosed() {
+			delete(n.conns, c)
+		}
+	}
+	n.conns[nc] = struct{}{}
 	return nc, nil
 }
 
+// Connected reports whether a worker is connected to NATS.
+func (n *NatsOutput) Connected() bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+	for c := range n.conns {
+		if c.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconnects returns the number of restored NATS connections.
+func (n *NatsOutput) Reconnects() uint64 {
+	return atomic.LoadUint64(&n.reconnects)
+}
+
 // Dial //
 func (n *NatsOutput) Dial(network, address string) (net.Conn, error) {
 	ctx, cancel := context.WithCancel(n.ctx)
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/karimra/ouroboros/processors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -14,7 +15,14 @@ type Output interface {
 	Close() error
 
 	WithLogger(*log.Logger)
-	WithProcessors(map[string]map[string]interface{}, *log.Logger)
+	WithProcessors(map[string]processors.Processor)
+	WithDeadLetter(*DeadLetter)
+}
+
+// Validator is implemented by the outputs able to check a configuration
+// without initializing, Validate is called on a new instance.
+type Validator interface {
+	Validate(cfg interface{}) error
 }
 
 type Initializer func() Output
@@ -33,9 +41,9 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
-func WithProcessors(procs map[string]map[string]interface{}, l *log.Logger) Option {
+func WithProcessors(procs map[string]processors.Processor) Option {
 	return func(o Output) {
-		o.WithProcessors(procs, l)
+		o.WithProcessors(procs)
 	}
 }
 
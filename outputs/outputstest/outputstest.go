@@ -0,0 +1,42 @@
+// Package outputstest provides utilities for testing outputs.
+package outputstest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Failures is a dead-letter output collecting the failure records written to it.
+type Failures struct {
+	m  sync.Mutex
+	fs []*outputs.Failure
+}
+
+func (f *Failures) Init(context.Context, interface{}, ...outputs.Option) error { return nil }
+func (f *Failures) Write(_ context.Context, d interface{}) error {
+	fl := new(outputs.Failure)
+	err := json.Unmarshal(d.([]byte), fl)
+	if err != nil {
+		return err
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.fs = append(f.fs, fl)
+	return nil
+}
+func (f *Failures) Close() error                                   { return nil }
+func (f *Failures) WithLogger(*log.Logger)                         {}
+func (f *Failures) WithProcessors(map[string]processors.Processor) {}
+func (f *Failures) WithDeadLetter(*outputs.DeadLetter)             {}
+
+// List returns the failures written so far.
+func (f *Failures) List() []*outputs.Failure {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return append([]*outputs.Failure(nil), f.fs...)
+}
@@ -0,0 +1,68 @@
+package postgres_output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/sql_output"
+	_ "github.com/lib/pq"
+)
+
+const (
+	outputName    = "postgres"
+	defaultDSN    = "postgres://localhost:5432/orbrs?sslmode=disable"
+	loggingPrefix = "postgres_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return sql_output.New(dialect{}, loggingPrefix)
+	})
+}
+
+type dialect struct{}
+
+func (dialect) DriverName() string { return "postgres" }
+
+func (dialect) DefaultDSN() string { return defaultDSN }
+
+func (dialect) Placeholder(i int) string { return "$" + strconv.Itoa(i) }
+
+func (dialect) Quote(ident string) string { return `"` + ident + `"` }
+
+func (dialect) ColumnType(typ string, _ bool) string {
+	switch typ {
+	case sql_output.TypeInteger:
+		return "BIGINT"
+	case sql_output.TypeReal:
+		return "DOUBLE PRECISION"
+	case sql_output.TypeBoolean:
+		return "BOOLEAN"
+	case sql_output.TypeTimestamp:
+		return "TIMESTAMPTZ"
+	case sql_output.TypeJSON:
+		return "JSONB"
+	default:
+		return "TEXT"
+	}
+}
+
+func (dialect) Upsert(columns, keys []string) string {
+	isKey := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if !isKey[c] {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+		}
+	}
+	target := strings.Join(keys, ", ")
+	if len(sets) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", target)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", target, strings.Join(sets, ", "))
+}
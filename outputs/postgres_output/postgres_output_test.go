@@ -0,0 +1,63 @@
+package postgres_output
+
+import (
+	"testing"
+
+	"github.com/karimra/ouroboros/outputs/sql_output"
+)
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		typ  string
+		key  bool
+		want string
+	}{
+		{typ: sql_output.TypeText, want: "TEXT"},
+		{typ: sql_output.TypeText, key: true, want: "TEXT"},
+		{typ: sql_output.TypeInteger, want: "BIGINT"},
+		{typ: sql_output.TypeReal, want: "DOUBLE PRECISION"},
+		{typ: sql_output.TypeBoolean, want: "BOOLEAN"},
+		{typ: sql_output.TypeTimestamp, key: true, want: "TIMESTAMPTZ"},
+		{typ: sql_output.TypeJSON, want: "JSONB"},
+	}
+	for _, tt := range tests {
+		if got := (dialect{}).ColumnType(tt.typ, tt.key); got != tt.want {
+			t.Errorf("ColumnType(%q, %t) = %q, want %q", tt.typ, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		keys    []string
+		want    string
+	}{
+		{
+			name:    "update values",
+			columns: []string{`"id"`, `"a"`, `"b"`},
+			keys:    []string{`"id"`},
+			want:    `ON CONFLICT ("id") DO UPDATE SET "a" = EXCLUDED."a", "b" = EXCLUDED."b"`,
+		},
+		{
+			name:    "keys only",
+			columns: []string{`"id"`, `"ts"`},
+			keys:    []string{`"id"`, `"ts"`},
+			want:    `ON CONFLICT ("id", "ts") DO NOTHING`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (dialect{}).Upsert(tt.columns, tt.keys); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	if got := (dialect{}).Placeholder(3); got != "$3" {
+		t.Errorf("got %q, want $3", got)
+	}
+}
@@ -0,0 +1,161 @@
+package prometheus_output
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesStore is a prometheus.Collector exposing the series built from events.
+// It is unchecked: metric names and label sets are only known at runtime.
+type seriesStore struct {
+	maxSeries  int
+	expiration time.Duration
+
+	m sync.Mutex
+	// series key to entry
+	entries map[string]*entry
+	// metric name to number of series
+	counts map[string]int
+	// metric name to the help, type and label names of its first series,
+	// a metric exposing different ones fails the whole scrape.
+	schemas map[string]*schema
+}
+
+type schema struct {
+	help      string
+	typ       string
+	labelKeys []string
+}
+
+var errMaxSeries = errors.New("max-series reached")
+
+type entry struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	values    []string
+	value     float64
+	updated   time.Time
+}
+
+func newSeriesStore(maxSeries int, expiration time.Duration) *seriesStore {
+	return &seriesStore{
+		maxSeries:  maxSeries,
+		expiration: expiration,
+		entries:    make(map[string]*entry),
+		counts:     make(map[string]int),
+		schemas:    make(map[string]*schema),
+	}
+}
+
+// update sets or increments the series s.
+// It returns errMaxSeries if s is new and its metric already has maxSeries series,
+// or an error if its type or label names differ from the existing series of the metric.
+// The help of the first series of a metric is used for all of them.
+func (st *seriesStore) update(s *series) error {
+	key := seriesKey(s)
+	st.m.Lock()
+	defer st.m.Unlock()
+	sc, ok := st.schemas[s.name]
+	if ok && sc.typ != s.typ {
+		return fmt.Errorf("metric %q type %s conflicts with the existing type %s", s.name, s.typ, sc.typ)
+	}
+	e, ok := st.entries[key]
+	if !ok {
+		if sc == nil {
+			sc = &schema{help: s.help, typ: s.typ, labelKeys: s.labelKeys}
+		} else if !equal(sc.labelKeys, s.labelKeys) {
+			return fmt.Errorf("metric %q labels %v conflict with the existing labels %v", s.name, s.labelKeys, sc.labelKeys)
+		}
+		if st.counts[s.name] >= st.maxSeries {
+			return errMaxSeries
+		}
+		st.schemas[s.name] = sc
+		e = &entry{
+			desc:      prometheus.NewDesc(s.name, sc.help, s.labelKeys, nil),
+			valueType: prometheus.GaugeValue,
+			values:    s.labelValues,
+		}
+		if s.typ == metricTypeCounter {
+			e.valueType = prometheus.CounterValue
+		}
+		st.entries[key] = e
+		st.counts[s.name]++
+	}
+	if s.typ == metricTypeCounter {
+		e.value += s.value
+	} else {
+		e.value = s.value
+	}
+	e.updated = time.Now()
+	return nil
+}
+
+// expire removes the series not updated since expiration and returns their number.
+func (st *seriesStore) expire() int {
+	st.m.Lock()
+	defer st.m.Unlock()
+	n := 0
+	for key, e := range st.entries {
+		if time.Since(e.updated) < st.expiration {
+			continue
+		}
+		delete(st.entries, key)
+		name := key[:strings.IndexByte(key, 0)]
+		st.counts[name]--
+		if st.counts[name] <= 0 {
+			delete(st.counts, name)
+			delete(st.schemas, name)
+		}
+		n++
+	}
+	return n
+}
+
+// Describe implements prometheus.Collector,
+// sending no descriptor makes it an unchecked collector.
+func (st *seriesStore) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (st *seriesStore) Collect(ch chan<- prometheus.Metric) {
+	st.m.Lock()
+	defer st.m.Unlock()
+	for _, e := range st.entries {
+		m, err := prometheus.NewConstMetric(e.desc, e.valueType, e.value, e.values...)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(e.desc, err)
+			continue
+		}
+		ch <- m
+	}
+}
+
+// seriesKey identifies a series by its metric name, label names and values.
+func seriesKey(s *series) string {
+	sb := new(strings.Builder)
+	sb.WriteString(s.name)
+	for i, k := range s.labelKeys {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(s.labelValues[i])
+	}
+	sb.WriteByte(0)
+	return sb.String()
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package prometheus_output
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesStoreUpdate(t *testing.T) {
+	st := newSeriesStore(2, time.Minute)
+	tests := []struct {
+		name    string
+		s       *series
+		wantErr error
+	}{
+		{
+			name: "new metric",
+			s:    &series{name: "if_up", help: "interface state", typ: metricTypeGauge, labelKeys: []string{"if"}, labelValues: []string{"e1"}, value: 1},
+		},
+		{
+			name: "other help",
+			s:    &series{name: "if_up", help: "other help", typ: metricTypeGauge, labelKeys: []string{"if"}, labelValues: []string{"e2"}, value: 0},
+		},
+		{
+			name:    "conflicting labels",
+			s:       &series{name: "if_up", help: "interface state", typ: metricTypeGauge, labelKeys: []string{"device", "if"}, labelValues: []string{"r1", "e3"}, value: 1},
+			wantErr: errors.New("conflict"),
+		},
+		{
+			name:    "conflicting type",
+			s:       &series{name: "if_up", help: "interface state", typ: metricTypeCounter, labelKeys: []string{"if"}, labelValues: []string{"e1"}, value: 1},
+			wantErr: errors.New("conflict"),
+		},
+		{
+			name:    "max series",
+			s:       &series{name: "if_up", help: "interface state", typ: metricTypeGauge, labelKeys: []string{"if"}, labelValues: []string{"e3"}, value: 1},
+			wantErr: errMaxSeries,
+		},
+		{
+			name: "existing series",
+			s:    &series{name: "if_up", help: "interface state", typ: metricTypeGauge, labelKeys: []string{"if"}, labelValues: []string{"e1"}, value: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := st.update(tt.s)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr == errMaxSeries && !errors.Is(err, errMaxSeries):
+				t.Errorf("got error %v, want %v", err, errMaxSeries)
+			case tt.wantErr != nil && (err == nil || !strings.Contains(err.Error(), tt.wantErr.Error())):
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(st)
+	want := `
+# HELP if_up interface state
+# TYPE if_up gauge
+if_up{if="e1"} 0
+if_up{if="e2"} 0
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
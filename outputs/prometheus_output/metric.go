@@ -0,0 +1,214 @@
+package prometheus_output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+	"github.com/karimra/ouroboros/utils"
+)
+
+const (
+	metricTypeCounter = "counter"
+	metricTypeGauge   = "gauge"
+)
+
+var (
+	metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegex  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// metricCfg maps an event to a series.
+// Label and value expressions are Go templates if they contain "{{", jq expressions otherwise.
+type metricCfg struct {
+	// metric name, may be a Go template
+	Name string `mapstructure:"name,omitempty"`
+	Help string `mapstructure:"help,omitempty"`
+	// counter or gauge
+	Type string `mapstructure:"type,omitempty"`
+	// jq condition, the event is skipped if it does not evaluate to true
+	Condition string `mapstructure:"condition,omitempty"`
+	// gauges are set to the value, counters are incremented by it (1 if unset)
+	Value  string            `mapstructure:"value,omitempty"`
+	Labels map[string]string `mapstructure:"labels,omitempty"`
+}
+
+type metric struct {
+	cfg *metricCfg
+
+	name      *template.Template
+	cond      *gojq.Code
+	value     *utils.Expr
+	labelKeys []string
+	labels    []*utils.Expr
+}
+
+// series is a single sample computed from an event.
+type series struct {
+	name        string
+	help        string
+	typ         string
+	labelKeys   []string
+	labelValues []string
+	value       float64
+}
+
+func newMetric(mc *metricCfg) (*metric, error) {
+	if mc == nil || mc.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	switch mc.Type {
+	case "":
+		mc.Type = metricTypeGauge
+	case metricTypeCounter, metricTypeGauge:
+	default:
+		return nil, fmt.Errorf("unknown type %q", mc.Type)
+	}
+	if mc.Type == metricTypeGauge && mc.Value == "" {
+		return nil, errors.New("gauge metrics require a value")
+	}
+	if mc.Help == "" {
+		mc.Help = "orbrs generated metric"
+	}
+	m := &metric{cfg: mc}
+	var err error
+	m.name, err = template.New("name").Parse(mc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if mc.Condition != "" {
+		m.cond, err = compileJQ(mc.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("condition: %v", err)
+		}
+	}
+	if mc.Value != "" {
+		m.value, err = utils.NewExpr("value", mc.Value, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for k := range mc.Labels {
+		if !labelNameRegex.MatchString(k) {
+			return nil, fmt.Errorf("invalid label name %q", k)
+		}
+		m.labelKeys = append(m.labelKeys, k)
+	}
+	sort.Strings(m.labelKeys)
+	for _, k := range m.labelKeys {
+		e, err := utils.NewExpr(k, mc.Labels[k], nil)
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %v", k, err)
+		}
+		m.labels = append(m.labels, e)
+	}
+	return m, nil
+}
+
+func compileJQ(s string) (*gojq.Code, error) {
+	q, err := gojq.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(q)
+}
+
+// eval returns the series computed from ev, or nil if the condition is not met.
+func (m *metric) eval(ev interface{}) (*series, error) {
+	if m.cond != nil {
+		r, err := runJQ(m.cond, ev)
+		if err != nil {
+			return nil, fmt.Errorf("condition: %v", err)
+		}
+		if ok, _ := r.(bool); !ok {
+			return nil, nil
+		}
+	}
+	buf := new(bytes.Buffer)
+	err := m.name.Execute(buf, ev)
+	if err != nil {
+		return nil, fmt.Errorf("name: %v", err)
+	}
+	s := &series{
+		name:        buf.String(),
+		help:        m.cfg.Help,
+		typ:         m.cfg.Type,
+		labelKeys:   m.labelKeys,
+		labelValues: make([]string, 0, len(m.labels)),
+		value:       1,
+	}
+	if !metricNameRegex.MatchString(s.name) {
+		return nil, fmt.Errorf("invalid metric name %q", s.name)
+	}
+	for i, l := range m.labels {
+		v, err := l.Eval(ev)
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %v", m.labelKeys[i], err)
+		}
+		s.labelValues = append(s.labelValues, toString(v))
+	}
+	if m.value != nil {
+		v, err := m.value.Eval(ev)
+		if err != nil {
+			return nil, fmt.Errorf("value: %v", err)
+		}
+		s.value, err = toFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("value: %v", err)
+		}
+	}
+	if s.typ == metricTypeCounter && s.value < 0 {
+		return nil, fmt.Errorf("counter value %f is negative", s.value)
+	}
+	return s, nil
+}
+
+// runJQ returns the first result of code applied to ev.
+func runJQ(code *gojq.Code, ev interface{}) (interface{}, error) {
+	iter := code.Run(ev)
+	r, ok := iter.Next()
+	if !ok {
+		return nil, nil
+	}
+	if err, ok := r.(error); ok {
+		return nil, err
+	}
+	return r, nil
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to a number", v)
+	}
+}
@@ -0,0 +1,331 @@
+package prometheus_output
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputName          = "prometheus"
+	defaultListen       = ":9804"
+	defaultPath         = "/metrics"
+	defaultMaxSeries    = 1000
+	defaultExpiration   = 10 * time.Minute
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+	loggingPrefix       = "prometheus_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &PrometheusOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type PrometheusOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	metrics    []*metric
+	series     *seriesStore
+	srv        *http.Server
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	// HTTP server listen address
+	Listen string           `mapstructure:"listen,omitempty"`
+	Path   string           `mapstructure:"path,omitempty"`
+	TLS    *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	// metrics built from each event
+	Metrics []*metricCfg `mapstructure:"metrics,omitempty"`
+	// max number of series per metric name, new series beyond it are dropped
+	MaxSeries int `mapstructure:"max-series,omitempty"`
+	// series not updated for this long are removed, never if negative
+	Expiration   time.Duration `mapstructure:"expiration,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (p *PrometheusOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, p.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	err = p.setDefaults()
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string)
+	for i, mc := range p.cfg.Metrics {
+		m, err := newMetric(mc)
+		if err != nil {
+			return fmt.Errorf("metric %d: %v", i, err)
+		}
+		// the type of the names built by a template is checked when the series are updated
+		if !strings.Contains(mc.Name, "{{") {
+			if typ, ok := types[mc.Name]; ok && typ != mc.Type {
+				return fmt.Errorf("metric %d: %q is already defined as a %s", i, mc.Name, typ)
+			}
+			types[mc.Name] = mc.Type
+		}
+		p.metrics = append(p.metrics, m)
+	}
+	p.series = newSeriesStore(p.cfg.MaxSeries, p.cfg.Expiration)
+
+	l, err := net.Listen("tcp", p.cfg.Listen)
+	if err != nil {
+		return err
+	}
+	if p.cfg.TLS != nil {
+		tlsCfg, err := p.cfg.TLS.NewServerTLS()
+		if err != nil {
+			l.Close()
+			return err
+		}
+		l = tls.NewListener(l, tlsCfg)
+	}
+	reg := prometheus.NewRegistry()
+	err = reg.Register(p.series)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	mux := http.NewServeMux()
+	// serve the valid series if some fail
+	mux.Handle(p.cfg.Path, promhttp.HandlerFor(reg, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}))
+	p.srv = &http.Server{Handler: mux}
+
+	p.ctx, p.cfn = context.WithCancel(ctx)
+	p.logger.Infof("output starting with config: %+v", p.cfg)
+	go func() {
+		err := p.srv.Serve(l)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Errorf("metrics server stopped: %v", err)
+		}
+	}()
+	if p.cfg.Expiration > 0 {
+		p.wg.Add(1)
+		go p.expire(p.ctx)
+	}
+	p.wg.Add(p.cfg.NumWorkers)
+	for i := 0; i < p.cfg.NumWorkers; i++ {
+		go p.worker(p.ctx, i)
+	}
+	return nil
+}
+
+func (p *PrometheusOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		p.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			p.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			p.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			p.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, p.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case p.msgChan <- d:
+	}
+	return nil
+}
+
+func (p *PrometheusOutput) Close() error {
+	if p.cfn != nil {
+		p.cfn()
+	}
+	p.wg.Wait()
+	if p.srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return p.srv.Shutdown(ctx)
+	}
+	return nil
+}
+
+func (p *PrometheusOutput) WithLogger(logger *log.Logger) {
+	if p.logger == nil {
+		p.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (p *PrometheusOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range p.cfg.Processors {
+		if proc, ok := procs[name]; ok {
+			p.procs = append(p.procs, proc)
+			continue
+		}
+		p.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (p *PrometheusOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	p.deadLetter = d
+}
+
+func (p *PrometheusOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, p.cfg)
+	if err != nil {
+		return err
+	}
+	return p.setDefaults()
+}
+
+func (p *PrometheusOutput) setDefaults() error {
+	if p.cfg.Listen == "" {
+		p.cfg.Listen = defaultListen
+	}
+	if p.cfg.Path == "" {
+		p.cfg.Path = defaultPath
+	}
+	if len(p.cfg.Metrics) == 0 {
+		return errors.New("missing metrics definition")
+	}
+	if p.cfg.MaxSeries <= 0 {
+		p.cfg.MaxSeries = defaultMaxSeries
+	}
+	if p.cfg.Expiration == 0 {
+		p.cfg.Expiration = defaultExpiration
+	}
+	if p.cfg.NumWorkers <= 0 {
+		p.cfg.NumWorkers = defaultNumWorkers
+	}
+	if p.cfg.WriteTimeout <= 0 {
+		p.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (p *PrometheusOutput) worker(ctx context.Context, idx int) {
+	defer p.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	p.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-p.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, proc := range p.procs {
+				data, err = proc.Apply(data)
+				if err != nil {
+					p.logger.Errorf("failed to apply processor: %v", err)
+					p.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			ev, err := normalize(data)
+			if err != nil {
+				p.logger.Errorf("%s failed to decode event: %v", workerLogPrefix, err)
+				p.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			var errs []string
+			for _, m := range p.metrics {
+				s, err := m.eval(ev)
+				if err != nil {
+					p.logger.Errorf("%s metric %q: %v", workerLogPrefix, m.cfg.Name, err)
+					errs = append(errs, fmt.Sprintf("metric %q: %v", m.cfg.Name, err))
+					continue
+				}
+				if s == nil {
+					continue
+				}
+				if p.cfg.Debug {
+					p.logger.Debugf("%s series %s %v: %f", workerLogPrefix, s.name, s.labelValues, s.value)
+				}
+				err = p.series.update(s)
+				switch {
+				case errors.Is(err, errMaxSeries):
+					p.logger.Warnf("metric %q reached max-series %d, dropping series %v", s.name, p.cfg.MaxSeries, s.labelValues)
+				case err != nil:
+					p.logger.Errorf("%s %v", workerLogPrefix, err)
+					errs = append(errs, err.Error())
+				}
+			}
+			if len(errs) > 0 {
+				p.deadLetter.Send(ctx, msg, errors.New(strings.Join(errs, "; ")))
+			}
+		}
+	}
+}
+
+func (p *PrometheusOutput) expire(ctx context.Context) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.Expiration / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n := p.series.expire()
+			if n > 0 && p.cfg.Debug {
+				p.logger.Debugf("expired %d series", n)
+			}
+		}
+	}
+}
+
+// normalize converts data to the generic JSON types expected by jq.
+func normalize(data interface{}) (interface{}, error) {
+	b, err := utils.ToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
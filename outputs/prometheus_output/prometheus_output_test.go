@@ -0,0 +1,63 @@
+package prometheus_output
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/karimra/ouroboros/outputs"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestInitMetricTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics []interface{}
+		wantErr string
+	}{
+		{
+			name: "counter and gauge",
+			metrics: []interface{}{
+				map[string]interface{}{"name": "if_up", "value": ".up"},
+				map[string]interface{}{"name": "if_up", "type": "counter"},
+			},
+			wantErr: `metric 1: "if_up" is already defined as a gauge`,
+		},
+		{
+			name: "same type",
+			metrics: []interface{}{
+				map[string]interface{}{"name": "if_flaps", "type": "counter"},
+				map[string]interface{}{"name": "if_flaps", "type": "counter", "value": ".n"},
+			},
+		},
+		{
+			name: "template name",
+			metrics: []interface{}{
+				map[string]interface{}{"name": "if_{{.kind}}", "value": ".v"},
+				map[string]interface{}{"name": "if_{{.kind}}", "type": "counter"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.New()
+			logger.SetOutput(ioutil.Discard)
+			p := outputs.Outputs[outputName]()
+			err := p.Init(context.Background(), map[string]interface{}{
+				"listen":  "127.0.0.1:0",
+				"metrics": tt.metrics,
+			}, outputs.WithLogger(logger))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package redis_output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputName          = "redis"
+	defaultAddress      = "localhost:6379"
+	defaultMode         = modeXAdd
+	defaultKey          = "orbrs.events.out"
+	defaultField        = "data"
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+	loggingPrefix       = "redis_output"
+
+	modeXAdd    = "xadd"
+	modePublish = "publish"
+	modeSet     = "set"
+	modeHSet    = "hset"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &RedisOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type RedisOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	client     *redis.Client
+	key        *template.Template
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	Address  string           `mapstructure:"address,omitempty"`
+	Username string           `mapstructure:"username,omitempty"`
+	Password string           `mapstructure:"password,omitempty"`
+	DB       int              `mapstructure:"db,omitempty"`
+	TLS      *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	// xadd, publish, set or hset
+	Mode string `mapstructure:"mode,omitempty"`
+	// stream, channel or key name, Go template executed against each event
+	Key string `mapstructure:"key,omitempty"`
+	// xadd entry field holding the event
+	Field string `mapstructure:"field,omitempty"`
+	// approximate stream max length, xadd only
+	MaxLen int64 `mapstructure:"max-len,omitempty"`
+	// key expiration, set and hset only
+	TTL          time.Duration `mapstructure:"ttl,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (r *RedisOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, r.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	err = r.setDefaults()
+	if err != nil {
+		return err
+	}
+	r.key, err = template.New("key").Parse(r.cfg.Key)
+	if err != nil {
+		return err
+	}
+	redisOpts := &redis.Options{
+		Addr:     r.cfg.Address,
+		Username: r.cfg.Username,
+		Password: r.cfg.Password,
+		DB:       r.cfg.DB,
+	}
+	if r.cfg.TLS != nil {
+		redisOpts.TLSConfig, err = r.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	r.client = redis.NewClient(redisOpts)
+	r.ctx, r.cfn = context.WithCancel(ctx)
+	r.logger.Infof("output starting with config: %+v", r.cfg)
+	r.wg.Add(r.cfg.NumWorkers)
+	for i := 0; i < r.cfg.NumWorkers; i++ {
+		go r.worker(r.ctx, i)
+	}
+	return nil
+}
+
+func (r *RedisOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		r.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			r.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			r.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			r.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, r.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case r.msgChan <- d:
+	}
+	return nil
+}
+
+func (r *RedisOutput) Close() error {
+	if r.cfn != nil {
+		r.cfn()
+	}
+	r.wg.Wait()
+	if r.client != nil {
+		return r.client.Close()
+	}
+	return nil
+}
+
+func (r *RedisOutput) WithLogger(logger *log.Logger) {
+	if r.logger == nil {
+		r.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (r *RedisOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range r.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			r.procs = append(r.procs, p)
+			continue
+		}
+		r.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (r *RedisOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	r.deadLetter = d
+}
+
+func (r *RedisOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, r.cfg)
+	if err != nil {
+		return err
+	}
+	return r.setDefaults()
+}
+
+func (r *RedisOutput) setDefaults() error {
+	if r.cfg.Address == "" {
+		r.cfg.Address = defaultAddress
+	}
+	switch r.cfg.Mode {
+	case "":
+		r.cfg.Mode = defaultMode
+	case modeXAdd, modePublish, modeSet, modeHSet:
+	default:
+		return fmt.Errorf("unknown mode %q", r.cfg.Mode)
+	}
+	if r.cfg.Key == "" {
+		r.cfg.Key = defaultKey
+	}
+	if r.cfg.Field == "" {
+		r.cfg.Field = defaultField
+	}
+	if r.cfg.NumWorkers <= 0 {
+		r.cfg.NumWorkers = defaultNumWorkers
+	}
+	if r.cfg.WriteTimeout <= 0 {
+		r.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (r *RedisOutput) worker(ctx context.Context, idx int) {
+	defer r.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	r.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-r.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range r.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					r.logger.Errorf("failed to apply processor: %v", err)
+					r.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			err = r.write(ctx, data)
+			if err != nil {
+				r.logger.Errorf("%s failed to write: %v", workerLogPrefix, err)
+				r.deadLetter.Send(ctx, msg, err)
+			}
+		}
+	}
+}
+
+func (r *RedisOutput) write(ctx context.Context, data interface{}) error {
+	v := utils.TemplateData(data)
+	buf := new(bytes.Buffer)
+	err := r.key.Execute(buf, v)
+	if err != nil {
+		return fmt.Errorf("failed to build key: %v", err)
+	}
+	key := buf.String()
+	b, err := utils.ToBytes(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %v", err)
+	}
+	if r.cfg.Debug {
+		r.logger.Debugf("%s %q: %s", r.cfg.Mode, key, string(b))
+	}
+	wctx, cancel := context.WithTimeout(ctx, r.cfg.WriteTimeout)
+	defer cancel()
+	switch r.cfg.Mode {
+	case modeXAdd:
+		args := &redis.XAddArgs{
+			Stream: key,
+			Values: map[string]interface{}{r.cfg.Field: b},
+		}
+		if r.cfg.MaxLen > 0 {
+			args.MaxLen = r.cfg.MaxLen
+			args.Approx = true
+		}
+		return r.client.XAdd(wctx, args).Err()
+	case modePublish:
+		return r.client.Publish(wctx, key, b).Err()
+	case modeSet:
+		return r.client.Set(wctx, key, b, r.cfg.TTL).Err()
+	case modeHSet:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("hset mode expects an object, got %T", v)
+		}
+		values := make(map[string]interface{}, len(m))
+		for k, fv := range m {
+			switch fv := fv.(type) {
+			case string:
+				values[k] = fv
+			default:
+				fb, err := json.Marshal(fv)
+				if err != nil {
+					return err
+				}
+				values[k] = fb
+			}
+		}
+		_, err = r.client.TxPipelined(wctx, func(p redis.Pipeliner) error {
+			p.HSet(wctx, key, values)
+			if r.cfg.TTL > 0 {
+				p.Expire(wctx, key, r.cfg.TTL)
+			}
+			return nil
+		})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package slack_output
+
+import (
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/chat_output"
+)
+
+const (
+	outputName    = "slack"
+	loggingPrefix = "slack_output"
+	// max number of fields in a section block
+	maxSectionFields = 10
+	// Block Kit text lengths limits, in characters
+	maxHeaderText       = 150
+	maxSectionText      = 3000
+	maxSectionFieldText = 2000
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return chat_output.New(formatter{}, loggingPrefix)
+	})
+}
+
+// formatter builds a Block Kit message wrapped in a colored attachment.
+type formatter struct{}
+
+func (formatter) Payload(m *chat_output.Message) interface{} {
+	blocks := []interface{}{
+		map[string]interface{}{
+			"type": "header",
+			"text": plainText(truncate(m.Title, maxHeaderText)),
+		},
+	}
+	if m.Text != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": markdown(truncate(m.Text, maxSectionText)),
+		})
+	}
+	for i := 0; i < len(m.Fields); i += maxSectionFields {
+		end := i + maxSectionFields
+		if end > len(m.Fields) {
+			end = len(m.Fields)
+		}
+		fields := make([]interface{}, 0, end-i)
+		for _, f := range m.Fields[i:end] {
+			fields = append(fields, markdown(truncate("*"+f.Name+"*\n"+f.Value, maxSectionFieldText)))
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":   "section",
+			"fields": fields,
+		})
+	}
+	if m.Link != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []interface{}{
+				map[string]interface{}{
+					"type": "button",
+					"text": plainText("Open"),
+					"url":  m.Link,
+				},
+			},
+		})
+	}
+	attachment := map[string]interface{}{
+		"blocks": blocks,
+	}
+	if m.Color != "" {
+		attachment["color"] = m.Color
+	}
+	return map[string]interface{}{
+		// notification fallback
+		"text":        m.Title,
+		"attachments": []interface{}{attachment},
+	}
+}
+
+func plainText(s string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": s}
+}
+
+func markdown(s string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": s}
+}
+
+// truncate shortens s to max characters, ending it with an ellipsis,
+// Slack rejects blocks with longer texts.
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
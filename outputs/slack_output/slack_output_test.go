@@ -0,0 +1,117 @@
+package slack_output
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		c    map[string]interface{}
+		ev   string
+		want string
+	}{
+		{
+			name: "message",
+			c: map[string]interface{}{
+				"title":    "{{.name}} is {{.state}}",
+				"text":     "interface {{.if}}",
+				"link":     "http://nms/{{.name}}",
+				"severity": "{{.sev}}",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "state", "value": "{{.state}}"},
+				},
+			},
+			ev: `{"name":"r1","state":"down","sev":"critical","if":"eth0"}`,
+			want: `{"text":"r1 is down","attachments":[{"color":"#E01E5A","blocks":[
+				{"type":"header","text":{"type":"plain_text","text":"r1 is down"}},
+				{"type":"section","text":{"type":"mrkdwn","text":"interface eth0"}},
+				{"type":"section","fields":[{"type":"mrkdwn","text":"*state*\ndown"}]},
+				{"type":"actions","elements":[{"type":"button","text":{"type":"plain_text","text":"Open"},"url":"http://nms/r1"}]}
+			]}]}`,
+		},
+		{
+			name: "truncated texts",
+			c: map[string]interface{}{
+				"title": "{{.t}}",
+				"text":  "{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}{{.t}}",
+			},
+			ev: `{"t":"` + strings.Repeat("é", 300) + `"}`,
+			want: `{"text":"` + strings.Repeat("é", 300) + `","attachments":[{"blocks":[
+				{"type":"header","text":{"type":"plain_text","text":"` + strings.Repeat("é", 149) + `…"}},
+				{"type":"section","text":{"type":"mrkdwn","text":"` + strings.Repeat("é", 2999) + `…"}}
+			]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make(chan []byte, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies <- b
+			}))
+			defer srv.Close()
+			logger := log.New()
+			logger.SetOutput(ioutil.Discard)
+			tt.c["url"] = srv.URL
+			o := outputs.Outputs[outputName]()
+			err := o.Init(context.Background(), tt.c, outputs.WithLogger(logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer o.Close()
+			err = o.Write(context.Background(), []byte(tt.ev))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b []byte
+			select {
+			case b = <-bodies:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for a post")
+			}
+			var got, want interface{}
+			err = json.Unmarshal(b, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.Unmarshal([]byte(tt.want), &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %s\nwant %s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{in: "", max: 3, want: ""},
+		{in: "abc", max: 3, want: "abc"},
+		{in: "abcd", max: 3, want: "ab…"},
+		{in: "ééé", max: 3, want: "ééé"},
+		{in: "éééé", max: 3, want: "éé…"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.in, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
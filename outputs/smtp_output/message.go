@@ -0,0 +1,288 @@
+package smtp_output
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/karimra/ouroboros/utils"
+)
+
+// templates holds the parsed email templates.
+type templates struct {
+	from     *template.Template
+	to       []*template.Template
+	cc       []*template.Template
+	subject  *template.Template
+	textBody *template.Template
+	htmlBody *htmltemplate.Template
+}
+
+// email is a message ready to be sent.
+type email struct {
+	from  string
+	rcpts []string
+	body  []byte
+}
+
+func newTemplates(c *cfg) (*templates, error) {
+	var err error
+	t := new(templates)
+	t.from, err = template.New("from").Parse(c.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	for i, s := range c.To {
+		tpl, err := template.New(fmt.Sprintf("to-%d", i)).Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("to: %v", err)
+		}
+		t.to = append(t.to, tpl)
+	}
+	for i, s := range c.Cc {
+		tpl, err := template.New(fmt.Sprintf("cc-%d", i)).Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("cc: %v", err)
+		}
+		t.cc = append(t.cc, tpl)
+	}
+	t.subject, err = template.New("subject").Parse(c.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("subject: %v", err)
+	}
+	if c.TextBody != "" {
+		t.textBody, err = template.New("text-body").Parse(c.TextBody)
+		if err != nil {
+			return nil, fmt.Errorf("text-body: %v", err)
+		}
+	}
+	if c.HTMLBody != "" {
+		t.htmlBody, err = htmltemplate.New("html-body").Parse(c.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("html-body: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// message renders the templates against data.
+func (t *templates) message(data interface{}, now time.Time) (*email, error) {
+	v := utils.TemplateData(data)
+	from, err := execute(t.from, v)
+	if err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("from: %v", err)
+	}
+	to, err := addresses(t.to, v)
+	if err != nil {
+		return nil, fmt.Errorf("to: %v", err)
+	}
+	if len(to) == 0 {
+		return nil, errors.New("no recipient")
+	}
+	cc, err := addresses(t.cc, v)
+	if err != nil {
+		return nil, fmt.Errorf("cc: %v", err)
+	}
+	subject, err := execute(t.subject, v)
+	if err != nil {
+		return nil, fmt.Errorf("subject: %v", err)
+	}
+
+	var text, html string
+	if t.textBody != nil {
+		text, err = execute(t.textBody, v)
+		if err != nil {
+			return nil, fmt.Errorf("text-body: %v", err)
+		}
+	}
+	if t.htmlBody != nil {
+		buf := new(bytes.Buffer)
+		err = t.htmlBody.Execute(buf, v)
+		if err != nil {
+			return nil, fmt.Errorf("html-body: %v", err)
+		}
+		html = buf.String()
+	}
+	if t.textBody == nil && t.htmlBody == nil {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	buf := new(bytes.Buffer)
+	writeHeader(buf, "From", fromAddr.String())
+	writeHeader(buf, "To", joinAddresses(to))
+	if len(cc) > 0 {
+		writeHeader(buf, "Cc", joinAddresses(cc))
+	}
+	writeHeader(buf, "Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	writeHeader(buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(buf, "Message-ID", messageID(fromAddr.Address))
+	writeHeader(buf, "MIME-Version", "1.0")
+	switch {
+	case t.textBody != nil && t.htmlBody != nil:
+		mw := multipart.NewWriter(buf)
+		writeHeader(buf, "Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		buf.WriteString("\r\n")
+		for _, part := range []struct {
+			contentType string
+			body        string
+		}{
+			{"text/plain; charset=utf-8", text},
+			{"text/html; charset=utf-8", html},
+		} {
+			pw, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			err = writeQuotedPrintable(pw, part.body)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = mw.Close()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		contentType, body := "text/plain; charset=utf-8", text
+		if t.htmlBody != nil {
+			contentType, body = "text/html; charset=utf-8", html
+		}
+		writeHeader(buf, "Content-Type", contentType)
+		writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		err = writeQuotedPrintable(buf, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &email{
+		from:  fromAddr.Address,
+		rcpts: make([]string, 0, len(to)+len(cc)),
+		body:  buf.Bytes(),
+	}
+	for _, a := range append(to, cc...) {
+		m.rcpts = append(m.rcpts, a.Address)
+	}
+	return m, nil
+}
+
+func execute(tpl *template.Template, v interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := tpl.Execute(buf, v)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// addresses renders tpls and parses the resulting comma separated addresses.
+func addresses(tpls []*template.Template, v interface{}) ([]*mail.Address, error) {
+	addrs := make([]*mail.Address, 0, len(tpls))
+	for _, tpl := range tpls {
+		s, err := execute(tpl, v)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range splitAddresses(s) {
+			addr, err := mail.ParseAddress(a)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %v", a, err)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+func joinAddresses(addrs []*mail.Address) string {
+	s := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		s = append(s, a.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	// header values must not contain line breaks
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	_, err := qw.Write([]byte(s))
+	if err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+func messageID(from string) string {
+	domain := "orbrs"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// limiter is a token bucket allowing n events per interval.
+type limiter struct {
+	m        sync.Mutex
+	max      float64
+	tokens   float64
+	perToken time.Duration
+	last     time.Time
+}
+
+func newLimiter(n int, interval time.Duration) *limiter {
+	return &limiter{
+		max:      float64(n),
+		tokens:   float64(n),
+		perToken: interval / time.Duration(n),
+		last:     time.Now(),
+	}
+}
+
+func (l *limiter) allow() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.perToken)
+	if l.tokens > l.max {
+		l.tokens = l.max
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,355 @@
+package smtp_output
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputName          = "smtp"
+	defaultAddress      = "localhost:25"
+	defaultTLSMode      = tlsModeStartTLS
+	defaultSubject      = "orbrs event"
+	defaultRateInterval = time.Minute
+	defaultTimeout      = 10 * time.Second
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+	loggingPrefix       = "smtp_output"
+
+	tlsModeNone     = "none"
+	tlsModeStartTLS = "starttls"
+	tlsModeTLS      = "tls"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &SmtpOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type SmtpOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	host       string
+	tlsConfig  *tls.Config
+	tpls       *templates
+	limiter    *limiter
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	// SMTP server host:port
+	Address string `mapstructure:"address,omitempty"`
+	// none, starttls or tls (implicit TLS)
+	TLSMode  string           `mapstructure:"tls-mode,omitempty"`
+	TLS      *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	Username string           `mapstructure:"username,omitempty"`
+	Password string           `mapstructure:"password,omitempty"`
+	// Go templates executed against each event,
+	// each to and cc entry can render a comma separated list of addresses.
+	From    string   `mapstructure:"from,omitempty"`
+	To      []string `mapstructure:"to,omitempty"`
+	Cc      []string `mapstructure:"cc,omitempty"`
+	Subject string   `mapstructure:"subject,omitempty"`
+	// the message is multipart/alternative if both are set,
+	// the indented event JSON is sent if none is set.
+	TextBody string `mapstructure:"text-body,omitempty"`
+	HTMLBody string `mapstructure:"html-body,omitempty"`
+	// max number of emails sent per rate-interval, unlimited if 0.
+	// events beyond it are dropped.
+	RateLimit    int           `mapstructure:"rate-limit,omitempty"`
+	RateInterval time.Duration `mapstructure:"rate-interval,omitempty"`
+	Timeout      time.Duration `mapstructure:"timeout,omitempty"`
+	Debug        bool          `mapstructure:"debug,omitempty"`
+	NumWorkers   int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors   []string      `mapstructure:"processors,omitempty"`
+}
+
+func (s *SmtpOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	err = s.setDefaults()
+	if err != nil {
+		return err
+	}
+	s.host, _, err = net.SplitHostPort(s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	s.tpls, err = newTemplates(s.cfg)
+	if err != nil {
+		return err
+	}
+	if s.cfg.TLSMode != tlsModeNone {
+		tlsCfg := s.cfg.TLS
+		if tlsCfg == nil {
+			tlsCfg = new(utils.TLSConfig)
+		}
+		s.tlsConfig, err = tlsCfg.NewTLS()
+		if err != nil {
+			return err
+		}
+		if s.tlsConfig.ServerName == "" {
+			s.tlsConfig.ServerName = s.host
+		}
+	}
+	if s.cfg.RateLimit > 0 {
+		s.limiter = newLimiter(s.cfg.RateLimit, s.cfg.RateInterval)
+	}
+	s.ctx, s.cfn = context.WithCancel(ctx)
+	s.logger.Infof("output starting with config: %+v", s.cfg)
+	s.wg.Add(s.cfg.NumWorkers)
+	for i := 0; i < s.cfg.NumWorkers; i++ {
+		go s.worker(s.ctx, i)
+	}
+	return nil
+}
+
+func (s *SmtpOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		s.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, s.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case s.msgChan <- d:
+	}
+	return nil
+}
+
+func (s *SmtpOutput) Close() error {
+	if s.cfn != nil {
+		s.cfn()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *SmtpOutput) WithLogger(logger *log.Logger) {
+	if s.logger == nil {
+		s.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (s *SmtpOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range s.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			s.procs = append(s.procs, p)
+			continue
+		}
+		s.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (s *SmtpOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	s.deadLetter = d
+}
+
+func (s *SmtpOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	return s.setDefaults()
+}
+
+func (s *SmtpOutput) setDefaults() error {
+	if s.cfg.Address == "" {
+		s.cfg.Address = defaultAddress
+	}
+	switch s.cfg.TLSMode {
+	case "":
+		s.cfg.TLSMode = defaultTLSMode
+	case tlsModeNone, tlsModeStartTLS, tlsModeTLS:
+	default:
+		return fmt.Errorf("unknown tls-mode %q", s.cfg.TLSMode)
+	}
+	if s.cfg.From == "" {
+		return errors.New("missing from address")
+	}
+	if len(s.cfg.To) == 0 {
+		return errors.New("missing to addresses")
+	}
+	if s.cfg.Subject == "" {
+		s.cfg.Subject = defaultSubject
+	}
+	if s.cfg.RateLimit < 0 {
+		return errors.New("rate-limit must be positive")
+	}
+	if s.cfg.RateInterval <= 0 {
+		s.cfg.RateInterval = defaultRateInterval
+	}
+	if s.cfg.Timeout <= 0 {
+		s.cfg.Timeout = defaultTimeout
+	}
+	if s.cfg.NumWorkers <= 0 {
+		s.cfg.NumWorkers = defaultNumWorkers
+	}
+	if s.cfg.WriteTimeout <= 0 {
+		s.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (s *SmtpOutput) worker(ctx context.Context, idx int) {
+	defer s.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	s.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-s.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range s.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					s.logger.Errorf("failed to apply processor: %v", err)
+					s.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			if s.limiter != nil && !s.limiter.allow() {
+				s.logger.Warnf("%s rate limit of %d emails per %s reached, dropping event", workerLogPrefix, s.cfg.RateLimit, s.cfg.RateInterval)
+				s.deadLetter.Send(ctx, msg, errors.New("rate limit reached"))
+				continue
+			}
+			m, err := s.tpls.message(data, time.Now())
+			if err != nil {
+				s.logger.Errorf("%s failed to build email: %v", workerLogPrefix, err)
+				s.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			if s.cfg.Debug {
+				s.logger.Debugf("%s sending email to %v: %s", workerLogPrefix, m.rcpts, string(m.body))
+			}
+			err = s.send(m)
+			if err != nil {
+				s.logger.Errorf("%s failed to send email: %v", workerLogPrefix, err)
+				s.deadLetter.Send(ctx, msg, err)
+			}
+		}
+	}
+}
+
+func (s *SmtpOutput) send(m *email) error {
+	d := &net.Dialer{Timeout: s.cfg.Timeout}
+	var conn net.Conn
+	var err error
+	if s.cfg.TLSMode == tlsModeTLS {
+		conn, err = tls.DialWithDialer(d, "tcp", s.cfg.Address, s.tlsConfig)
+	} else {
+		conn, err = d.Dial("tcp", s.cfg.Address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if s.cfg.TLSMode == tlsModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		err = c.StartTLS(s.tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.host))
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(m.from)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range m.rcpts {
+		err = c.Rcpt(rcpt)
+		if err != nil {
+			return fmt.Errorf("recipient %q: %v", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(m.body)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// splitAddresses splits a comma separated list of addresses.
+func splitAddresses(s string) []string {
+	addrs := make([]string, 0)
+	for _, a := range strings.Split(s, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
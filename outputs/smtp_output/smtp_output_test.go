@@ -0,0 +1,219 @@
+package smtp_output
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/outputstest"
+	log "github.com/sirupsen/logrus"
+)
+
+// received is an email accepted by the fake server.
+type received struct {
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+}
+
+// smtpServer runs a minimal SMTP server refusing the reject recipient,
+// it returns its address and the channel receiving the accepted emails.
+func smtpServer(t *testing.T, reject string) (string, chan *received) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	mails := make(chan *received, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, reject, mails)
+		}
+	}()
+	return l.Addr().String(), mails
+}
+
+func serveSMTP(conn net.Conn, reject string, mails chan *received) {
+	tc := textproto.NewConn(conn)
+	defer tc.Close()
+	m := new(received)
+	tc.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			tc.PrintfLine("250-localhost")
+			tc.PrintfLine("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH PLAIN "):
+			b, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+			m.auth = string(b)
+			tc.PrintfLine("235 2.7.0 authenticated")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			tc.PrintfLine("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpt := strings.Trim(line[len("RCPT TO:"):], "<>")
+			if rcpt == reject {
+				tc.PrintfLine("550 5.1.1 no such user")
+				continue
+			}
+			m.rcpts = append(m.rcpts, rcpt)
+			tc.PrintfLine("250 ok")
+		case cmd == "DATA":
+			tc.PrintfLine("354 go ahead")
+			b, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(b)
+			tc.PrintfLine("250 ok")
+			mails <- m
+			m = new(received)
+		case cmd == "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func newTestOutput(t *testing.T, c map[string]interface{}) (*SmtpOutput, *outputstest.Failures) {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	dl := new(outputstest.Failures)
+	s := outputs.Outputs[outputName]().(*SmtpOutput)
+	err := s.Init(context.Background(), c,
+		outputs.WithLogger(logger),
+		outputs.WithDeadLetter(outputs.NewDeadLetter(dl, log.NewEntry(logger))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, dl
+}
+
+func waitForFailures(t *testing.T, dl *outputstest.Failures, n int) []*outputs.Failure {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fs := dl.List()
+		if len(fs) >= n {
+			return fs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d dead letters, want %d", len(fs), n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSend(t *testing.T) {
+	addr, mails := smtpServer(t, "")
+	s, dl := newTestOutput(t, map[string]interface{}{
+		"address":   addr,
+		"tls-mode":  tlsModeNone,
+		"username":  "user",
+		"password":  "s3cr3t",
+		"from":      "orbrs <orbrs@example.com>",
+		"to":        []string{"{{.owner}}, noc@example.com"},
+		"cc":        []string{"ops@example.com"},
+		"subject":   "{{.device}} is {{.state}}",
+		"text-body": "interface {{.if}} went {{.state}}",
+	})
+	err := s.Write(context.Background(), []byte(`{"owner":"alice@example.com","device":"r1","if":"e1","state":"down"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m *received
+	select {
+	case m = <-mails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the email")
+	}
+	if m.auth != "\x00user\x00s3cr3t" {
+		t.Errorf("got auth %q", m.auth)
+	}
+	if m.from != "orbrs@example.com" {
+		t.Errorf("got from %q", m.from)
+	}
+	if got := strings.Join(m.rcpts, ","); got != "alice@example.com,noc@example.com,ops@example.com" {
+		t.Errorf("got recipients %s", got)
+	}
+	for _, want := range []string{
+		"From: \"orbrs\" <orbrs@example.com>\n",
+		"To: <alice@example.com>, <noc@example.com>\n",
+		"Cc: <ops@example.com>\n",
+		"Subject: r1 is down\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"\n\ninterface e1 went down",
+	} {
+		if !strings.Contains(m.data, want) {
+			t.Errorf("email missing %q:\n%s", want, m.data)
+		}
+	}
+	if fs := dl.List(); len(fs) != 0 {
+		t.Errorf("unexpected dead letters %v", fs)
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "rejected recipient",
+			cfg:     map[string]interface{}{"tls-mode": tlsModeNone, "to": []string{"nobody@example.com"}},
+			wantErr: `recipient "nobody@example.com": 550 "5.1.1 no such user"`,
+		},
+		{
+			name:    "starttls not offered",
+			cfg:     map[string]interface{}{"tls-mode": tlsModeStartTLS, "to": []string{"noc@example.com"}},
+			wantErr: "server does not support STARTTLS",
+		},
+		{
+			name:    "missing recipient field",
+			cfg:     map[string]interface{}{"tls-mode": tlsModeNone, "to": []string{"{{.owner}}"}},
+			wantErr: `to: "<no value>": mail: missing @ in addr-spec`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, mails := smtpServer(t, "nobody@example.com")
+			tt.cfg["address"] = addr
+			tt.cfg["from"] = "orbrs@example.com"
+			s, dl := newTestOutput(t, tt.cfg)
+			err := s.Write(context.Background(), []byte(`{"state":"down"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fs := waitForFailures(t, dl, 1)
+			if fs[0].Error != tt.wantErr {
+				t.Errorf("got error %q, want %q", fs[0].Error, tt.wantErr)
+			}
+			if len(mails) != 0 {
+				t.Error("unexpected email sent")
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package sql_output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// Column types, mapped to database types by the Dialect.
+const (
+	TypeText      = "text"
+	TypeInteger   = "integer"
+	TypeReal      = "real"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+	TypeJSON      = "json"
+)
+
+var identRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type columnCfg struct {
+	Name string `mapstructure:"name,omitempty"`
+	// text, integer, real, boolean, timestamp or json
+	Type string `mapstructure:"type,omitempty"`
+	// jq expression extracting the value from the event.
+	// timestamp columns without a path are set to the insertion time.
+	Path string `mapstructure:"path,omitempty"`
+	// part of the primary key
+	Key bool `mapstructure:"key,omitempty"`
+}
+
+type column struct {
+	cfg  *columnCfg
+	code *gojq.Code
+}
+
+func newColumn(cc *columnCfg) (*column, error) {
+	if cc == nil || !identRegex.MatchString(cc.Name) {
+		return nil, fmt.Errorf("invalid column name in %+v", cc)
+	}
+	switch cc.Type {
+	case "":
+		cc.Type = TypeText
+	case TypeText, TypeInteger, TypeReal, TypeBoolean, TypeTimestamp, TypeJSON:
+	default:
+		return nil, fmt.Errorf("column %q: unknown type %q", cc.Name, cc.Type)
+	}
+	c := &column{cfg: cc}
+	if cc.Path == "" {
+		if cc.Type == TypeTimestamp {
+			return c, nil
+		}
+		return nil, fmt.Errorf("column %q: missing path", cc.Name)
+	}
+	q, err := gojq.Parse(strings.TrimSpace(cc.Path))
+	if err != nil {
+		return nil, fmt.Errorf("column %q: %v", cc.Name, err)
+	}
+	c.code, err = gojq.Compile(q)
+	if err != nil {
+		return nil, fmt.Errorf("column %q: %v", cc.Name, err)
+	}
+	return c, nil
+}
+
+// value extracts the column value from ev and converts it to the column type.
+func (c *column) value(ev interface{}, now time.Time) (interface{}, error) {
+	if c.code == nil {
+		return now.UTC(), nil
+	}
+	iter := c.code.Run(ev)
+	v, ok := iter.Next()
+	if !ok || v == nil {
+		return nil, nil
+	}
+	if err, ok := v.(error); ok {
+		return nil, err
+	}
+	switch c.cfg.Type {
+	case TypeText:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	case TypeInteger:
+		switch v := v.(type) {
+		case float64:
+			return int64(v), nil
+		case int:
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case TypeReal:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case TypeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case TypeTimestamp:
+		// RFC3339 strings or unix seconds
+		switch v := v.(type) {
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			return t.UTC(), err
+		case float64:
+			return time.Unix(0, int64(v*1e9)).UTC(), nil
+		case int:
+			return time.Unix(int64(v), 0).UTC(), nil
+		}
+	case TypeJSON:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", v, c.cfg.Type)
+}
+
+func (s *SQLOutput) insertStatement() string {
+	names := make([]string, 0, len(s.columns))
+	keys := make([]string, 0)
+	params := make([]string, 0, len(s.columns))
+	for i, c := range s.columns {
+		names = append(names, s.dialect.Quote(c.cfg.Name))
+		params = append(params, s.dialect.Placeholder(i+1))
+		if c.cfg.Key {
+			keys = append(keys, s.dialect.Quote(c.cfg.Name))
+		}
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		s.dialect.Quote(s.cfg.Table),
+		strings.Join(names, ", "),
+		strings.Join(params, ", "),
+	)
+	if s.cfg.Upsert {
+		stmt += " " + s.dialect.Upsert(names, keys)
+	}
+	return stmt
+}
+
+func (s *SQLOutput) createTableStatement() string {
+	defs := make([]string, 0, len(s.columns)+1)
+	keys := make([]string, 0)
+	for _, c := range s.columns {
+		defs = append(defs, s.dialect.Quote(c.cfg.Name)+" "+s.dialect.ColumnType(c.cfg.Type, c.cfg.Key))
+		if c.cfg.Key {
+			keys = append(keys, s.dialect.Quote(c.cfg.Name))
+		}
+	}
+	if len(keys) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", s.dialect.Quote(s.cfg.Table), strings.Join(defs, ", "))
+}
+
+// migrate creates the table if it does not exist and adds the missing columns.
+func (s *SQLOutput) migrate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+	table := s.dialect.Quote(s.cfg.Table)
+	stmt := s.createTableStatement()
+	s.logger.Debugf("migration: %s", stmt)
+	_, err := s.db.ExecContext(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return err
+	}
+	existing, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		found[strings.ToLower(name)] = true
+	}
+	for _, c := range s.columns {
+		if found[strings.ToLower(c.cfg.Name)] {
+			continue
+		}
+		if c.cfg.Key {
+			return fmt.Errorf("key column %q cannot be added to existing table %q", c.cfg.Name, s.cfg.Table)
+		}
+		stmt = fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, s.dialect.Quote(c.cfg.Name), s.dialect.ColumnType(c.cfg.Type, false))
+		s.logger.Infof("migration: %s", stmt)
+		_, err = s.db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+// Package sql_output implements the outputs writing events to SQL databases,
+// the database specific parts are provided by a Dialect.
+package sql_output
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTable         = "orbrs_events"
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultNumWorkers    = 1
+	defaultWriteTimeout  = 5 * time.Second
+	migrationTimeout     = 30 * time.Second
+)
+
+// Dialect holds the database specific SQL syntax.
+type Dialect interface {
+	// DriverName is the database/sql driver name.
+	DriverName() string
+	// DefaultDSN is used if the config does not set a dsn.
+	DefaultDSN() string
+	// Placeholder returns the bind parameter for the i-th (1-based) value.
+	Placeholder(i int) string
+	// Quote quotes an identifier.
+	Quote(ident string) string
+	// ColumnType returns the database type of a column type,
+	// key is true if the column is part of the primary key.
+	ColumnType(typ string, key bool) string
+	// Upsert returns the clause appended to an insert statement
+	// to update the columns of an existing row with the same keys.
+	Upsert(columns, keys []string) string
+}
+
+// SQLOutput writes events to a database table in batched transactions.
+type SQLOutput struct {
+	cfg     *cfg
+	dialect Dialect
+
+	ctx           context.Context
+	cfn           context.CancelFunc
+	db            *sql.DB
+	columns       []*column
+	insert        string
+	rowChan       chan *row
+	batcherWG     *sync.WaitGroup
+	loggingPrefix string
+	procs         []processors.Processor
+	deadLetter    *outputs.DeadLetter
+	msgChan       chan interface{}
+	wg            *sync.WaitGroup
+	logger        *log.Entry
+}
+
+type cfg struct {
+	// driver specific data source name
+	DSN   string `mapstructure:"dsn,omitempty"`
+	Table string `mapstructure:"table,omitempty"`
+	// a single json column named data holding the whole event if unset
+	Columns []*columnCfg `mapstructure:"columns,omitempty"`
+	// update existing rows with the same key columns values
+	Upsert bool `mapstructure:"upsert,omitempty"`
+	// create the table and add missing columns on startup
+	Migrate       bool          `mapstructure:"migrate,omitempty"`
+	BatchSize     int           `mapstructure:"batch-size,omitempty"`
+	FlushInterval time.Duration `mapstructure:"flush-interval,omitempty"`
+	MaxOpenConns  int           `mapstructure:"max-open-conns,omitempty"`
+	Debug         bool          `mapstructure:"debug,omitempty"`
+	NumWorkers    int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout  time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors    []string      `mapstructure:"processors,omitempty"`
+}
+
+// New returns an output using dialect d, loggingPrefix is the plugin name used in logs.
+func New(d Dialect, loggingPrefix string) *SQLOutput {
+	return &SQLOutput{
+		cfg:           &cfg{},
+		dialect:       d,
+		loggingPrefix: loggingPrefix,
+		wg:            new(sync.WaitGroup),
+		msgChan:       make(chan interface{}),
+	}
+}
+
+func (s *SQLOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	err = s.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, cc := range s.cfg.Columns {
+		c, err := newColumn(cc)
+		if err != nil {
+			return err
+		}
+		s.columns = append(s.columns, c)
+	}
+	s.insert = s.insertStatement()
+	s.db, err = sql.Open(s.dialect.DriverName(), s.cfg.DSN)
+	if err != nil {
+		return err
+	}
+	if s.cfg.MaxOpenConns > 0 {
+		s.db.SetMaxOpenConns(s.cfg.MaxOpenConns)
+	}
+	if s.cfg.Migrate {
+		err = s.migrate(ctx)
+		if err != nil {
+			s.db.Close()
+			return fmt.Errorf("schema migration failed: %v", err)
+		}
+	}
+	s.ctx, s.cfn = context.WithCancel(ctx)
+	s.logger.Infof("output starting with config: %+v", s.cfg)
+	s.rowChan = make(chan *row, s.cfg.BatchSize)
+	s.batcherWG = new(sync.WaitGroup)
+	s.batcherWG.Add(1)
+	go s.batcher()
+	s.wg.Add(s.cfg.NumWorkers)
+	for i := 0; i < s.cfg.NumWorkers; i++ {
+		go s.worker(s.ctx, i)
+	}
+	return nil
+}
+
+func (s *SQLOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		s.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, s.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case s.msgChan <- d:
+	}
+	return nil
+}
+
+// Close stops the workers, flushes the pending batch and closes the database.
+func (s *SQLOutput) Close() error {
+	if s.cfn != nil {
+		s.cfn()
+	}
+	s.wg.Wait()
+	if s.rowChan != nil {
+		close(s.rowChan)
+		s.batcherWG.Wait()
+	}
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+func (s *SQLOutput) WithLogger(logger *log.Logger) {
+	if s.logger == nil {
+		s.logger = logger.WithField("plugin", s.loggingPrefix)
+	}
+}
+
+func (s *SQLOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range s.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			s.procs = append(s.procs, p)
+			continue
+		}
+		s.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (s *SQLOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	s.deadLetter = d
+}
+
+func (s *SQLOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	return s.setDefaults()
+}
+
+func (s *SQLOutput) setDefaults() error {
+	if s.cfg.DSN == "" {
+		s.cfg.DSN = s.dialect.DefaultDSN()
+	}
+	if s.cfg.Table == "" {
+		s.cfg.Table = defaultTable
+	}
+	if !identRegex.MatchString(s.cfg.Table) {
+		return fmt.Errorf("invalid table name %q", s.cfg.Table)
+	}
+	if len(s.cfg.Columns) == 0 {
+		s.cfg.Columns = []*columnCfg{{Name: "data", Type: TypeJSON, Path: "."}}
+	}
+	if s.cfg.Upsert {
+		hasKey := false
+		for _, c := range s.cfg.Columns {
+			hasKey = hasKey || (c != nil && c.Key)
+		}
+		if !hasKey {
+			return errors.New("upsert requires at least one key column")
+		}
+	}
+	if s.cfg.BatchSize <= 0 {
+		s.cfg.BatchSize = defaultBatchSize
+	}
+	if s.cfg.FlushInterval <= 0 {
+		s.cfg.FlushInterval = defaultFlushInterval
+	}
+	if s.cfg.NumWorkers <= 0 {
+		s.cfg.NumWorkers = defaultNumWorkers
+	}
+	if s.cfg.WriteTimeout <= 0 {
+		s.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (s *SQLOutput) worker(ctx context.Context, idx int) {
+	defer s.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	s.logger.Infof("%s starting", workerLogPrefix)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-s.msgChan:
+			var data interface{}
+			var err error
+			data = msg
+			for _, p := range s.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					s.logger.Errorf("failed to apply processor: %v", err)
+					s.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			values, err := s.values(data)
+			if err != nil {
+				s.logger.Errorf("%s failed to build row: %v", workerLogPrefix, err)
+				s.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case s.rowChan <- &row{values: values, msg: msg}:
+			}
+		}
+	}
+}
+
+// row is a row to insert and the event it was built from.
+type row struct {
+	values []interface{}
+	msg    interface{}
+}
+
+// values returns the columns values extracted from data.
+func (s *SQLOutput) values(data interface{}) ([]interface{}, error) {
+	b, err := utils.ToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var ev interface{}
+	err = json.Unmarshal(b, &ev)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	values := make([]interface{}, 0, len(s.columns))
+	for _, c := range s.columns {
+		v, err := c.value(ev, now)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", c.cfg.Name, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// batcher inserts rows in batches of batch-size or every flush-interval,
+// it returns once rowChan is closed and the remaining rows are inserted.
+func (s *SQLOutput) batcher() {
+	defer s.batcherWG.Done()
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*row, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := s.insertBatch(batch)
+		if err != nil {
+			s.logger.Errorf("failed to insert %d rows: %v", len(batch), err)
+			s.insertRows(batch)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case r, ok := <-s.rowChan:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// insertBatch inserts rows in a single transaction.
+func (s *SQLOutput) insertBatch(rows []*row) error {
+	if s.cfg.Debug {
+		s.logger.Debugf("inserting %d rows: %s", len(rows), s.insert)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.WriteTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, s.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rows {
+		_, err = stmt.ExecContext(ctx, r.values...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertRows inserts rows one by one after a failed batch,
+// so that only the rows failing on their own are dead-lettered.
+// The rows left after a timeout are not retried.
+func (s *SQLOutput) insertRows(rows []*row) {
+	var err error
+	for _, r := range rows {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			err = s.insertRow(r)
+		}
+		if err != nil {
+			s.logger.Errorf("failed to insert row: %v", err)
+			s.deadLetter.Send(context.Background(), r.msg, err)
+		}
+	}
+}
+
+func (s *SQLOutput) insertRow(r *row) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.WriteTimeout)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, s.insert, r.values...)
+	return err
+}
@@ -0,0 +1,161 @@
+package sql_output
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/outputstest"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// testDialect is a minimal sqlite dialect.
+type testDialect struct{}
+
+func (testDialect) DriverName() string       { return "sqlite" }
+func (testDialect) DefaultDSN() string       { return ":memory:" }
+func (testDialect) Placeholder(i int) string { return fmt.Sprintf("?%d", i) }
+func (testDialect) Quote(ident string) string {
+	return `"` + ident + `"`
+}
+func (testDialect) ColumnType(typ string, key bool) string {
+	if key {
+		return strings.ToUpper(typ) + " NOT NULL"
+	}
+	return strings.ToUpper(typ)
+}
+func (testDialect) Upsert(columns, keys []string) string {
+	return fmt.Sprintf("UPSERT %s ON %s", strings.Join(columns, ","), strings.Join(keys, ","))
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name       string
+		columns    []*columnCfg
+		upsert     bool
+		wantCreate string
+		wantInsert string
+	}{
+		{
+			name:       "default column",
+			wantCreate: `CREATE TABLE IF NOT EXISTS "orbrs_events" ("data" JSON)`,
+			wantInsert: `INSERT INTO "orbrs_events" ("data") VALUES (?1)`,
+		},
+		{
+			name: "keys",
+			columns: []*columnCfg{
+				{Name: "device", Path: ".device", Key: true},
+				{Name: "ts", Type: TypeTimestamp, Key: true},
+				{Name: "value", Type: TypeReal, Path: ".value"},
+			},
+			wantCreate: `CREATE TABLE IF NOT EXISTS "orbrs_events" ("device" TEXT NOT NULL, "ts" TIMESTAMP NOT NULL, "value" REAL, PRIMARY KEY ("device", "ts"))`,
+			wantInsert: `INSERT INTO "orbrs_events" ("device", "ts", "value") VALUES (?1, ?2, ?3)`,
+		},
+		{
+			name: "upsert",
+			columns: []*columnCfg{
+				{Name: "device", Path: ".device", Key: true},
+				{Name: "up", Type: TypeBoolean, Path: ".up"},
+			},
+			upsert:     true,
+			wantCreate: `CREATE TABLE IF NOT EXISTS "orbrs_events" ("device" TEXT NOT NULL, "up" BOOLEAN, PRIMARY KEY ("device"))`,
+			wantInsert: `INSERT INTO "orbrs_events" ("device", "up") VALUES (?1, ?2) UPSERT "device","up" ON "device"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(testDialect{}, "test")
+			s.cfg.Columns = tt.columns
+			s.cfg.Upsert = tt.upsert
+			err := s.setDefaults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, cc := range s.cfg.Columns {
+				c, err := newColumn(cc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.columns = append(s.columns, c)
+			}
+			if got := s.createTableStatement(); got != tt.wantCreate {
+				t.Errorf("got  %s\nwant %s", got, tt.wantCreate)
+			}
+			if got := s.insertStatement(); got != tt.wantInsert {
+				t.Errorf("got  %s\nwant %s", got, tt.wantInsert)
+			}
+		})
+	}
+}
+
+func TestBatchFallback(t *testing.T) {
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	dl := new(outputstest.Failures)
+	s := New(testDialect{}, "test")
+	err := s.Init(context.Background(),
+		map[string]interface{}{
+			"dsn":     dsn,
+			"migrate": true,
+			"columns": []map[string]interface{}{
+				{"name": "id", "type": TypeInteger, "path": ".id", "key": true},
+				{"name": "name", "path": ".name"},
+			},
+			"batch-size":     3,
+			"flush-interval": "1h",
+		},
+		outputs.WithLogger(logger),
+		outputs.WithDeadLetter(outputs.NewDeadLetter(dl, log.NewEntry(logger))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the duplicate key fails the batch
+	for _, ev := range []string{`{"id":1,"name":"a"}`, `{"id":1,"name":"b"}`, `{"id":2,"name":"c"}`} {
+		err = s.Write(context.Background(), []byte(ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT "name" FROM "orbrs_events" ORDER BY "id"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var n string
+		err = rows.Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, n)
+	}
+	if strings.Join(names, ",") != "a,c" {
+		t.Errorf("got rows %v, want [a c]", names)
+	}
+	fs := dl.List()
+	if len(fs) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(fs))
+	}
+	if ev, _ := json.Marshal(fs[0].Event); string(ev) != `{"id":1,"name":"b"}` {
+		t.Errorf("got dead letter event %s", ev)
+	}
+}
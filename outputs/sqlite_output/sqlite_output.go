@@ -0,0 +1,63 @@
+package sqlite_output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/sql_output"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	outputName    = "sqlite"
+	defaultDSN    = "orbrs.db"
+	loggingPrefix = "sqlite_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return sql_output.New(dialect{}, loggingPrefix)
+	})
+}
+
+type dialect struct{}
+
+func (dialect) DriverName() string { return "sqlite" }
+
+func (dialect) DefaultDSN() string { return defaultDSN }
+
+func (dialect) Placeholder(int) string { return "?" }
+
+func (dialect) Quote(ident string) string { return `"` + ident + `"` }
+
+func (dialect) ColumnType(typ string, _ bool) string {
+	switch typ {
+	case sql_output.TypeInteger, sql_output.TypeBoolean:
+		return "INTEGER"
+	case sql_output.TypeReal:
+		return "REAL"
+	case sql_output.TypeTimestamp:
+		return "TIMESTAMP"
+	default:
+		return "TEXT"
+	}
+}
+
+func (dialect) Upsert(columns, keys []string) string {
+	isKey := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	sets := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if !isKey[c] {
+			sets = append(sets, fmt.Sprintf("%s = excluded.%s", c, c))
+		}
+	}
+	target := strings.Join(keys, ", ")
+	if len(sets) == 0 {
+		return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", target)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", target, strings.Join(sets, ", "))
+}
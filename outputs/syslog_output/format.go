@@ -0,0 +1,276 @@
+package syslog_output
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/karimra/ouroboros/utils"
+)
+
+const nilValue = "-"
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var severities = map[string]int{
+	"emerg":         0,
+	"emergency":     0,
+	"alert":         1,
+	"crit":          2,
+	"critical":      2,
+	"err":           3,
+	"error":         3,
+	"warning":       4,
+	"warn":          4,
+	"notice":        5,
+	"info":          6,
+	"informational": 6,
+	"debug":         7,
+}
+
+var sdParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// header holds the message fields built from an event.
+type header struct {
+	facility int
+	severity int
+	hostname string
+	appName  string
+	procID   string
+	msgID    string
+}
+
+// formatter builds syslog messages from events.
+type formatter struct {
+	format    string
+	facility  *template.Template
+	severity  *template.Template
+	hostname  *template.Template
+	appName   *template.Template
+	msgID     *template.Template
+	message   *template.Template
+	sdID      string
+	sdKeys    []string
+	sdParams  []*utils.Expr
+	procID    string
+	defaultHN string
+}
+
+func newFormatter(c *cfg, hostname string, procID string) (*formatter, error) {
+	var err error
+	f := &formatter{
+		format:    c.Format,
+		sdID:      c.StructuredData.ID,
+		procID:    procID,
+		defaultHN: hostname,
+	}
+	for _, t := range []struct {
+		dst  **template.Template
+		name string
+		text string
+	}{
+		{&f.facility, "facility", c.Facility},
+		{&f.severity, "severity", c.Severity},
+		{&f.hostname, "hostname", c.Hostname},
+		{&f.appName, "app-name", c.AppName},
+		{&f.msgID, "msg-id", c.MsgID},
+		{&f.message, "message", c.Message},
+	} {
+		if t.text == "" {
+			continue
+		}
+		*t.dst, err = template.New(t.name).Parse(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.name, err)
+		}
+	}
+	for k := range c.StructuredData.Params {
+		if !validSDName(k) {
+			return nil, fmt.Errorf("invalid structured data param name %q", k)
+		}
+		f.sdKeys = append(f.sdKeys, k)
+	}
+	sort.Strings(f.sdKeys)
+	for _, k := range f.sdKeys {
+		e, err := utils.NewExpr(k, c.StructuredData.Params[k], nil)
+		if err != nil {
+			return nil, fmt.Errorf("structured data param %q: %v", k, err)
+		}
+		f.sdParams = append(f.sdParams, e)
+	}
+	return f, nil
+}
+
+// build returns the syslog message for ev, raw is the event JSON.
+func (f *formatter) build(ev interface{}, raw []byte, now time.Time) ([]byte, error) {
+	var err error
+	h := &header{
+		facility: facilities[defaultFacility],
+		severity: severities[defaultSeverity],
+		hostname: f.defaultHN,
+		appName:  defaultAppName,
+		procID:   f.procID,
+	}
+	if f.facility != nil {
+		h.facility, err = lookup(f.facility, ev, facilities, 23)
+		if err != nil {
+			return nil, fmt.Errorf("facility: %v", err)
+		}
+	}
+	if f.severity != nil {
+		h.severity, err = lookup(f.severity, ev, severities, 7)
+		if err != nil {
+			return nil, fmt.Errorf("severity: %v", err)
+		}
+	}
+	for _, t := range []struct {
+		tpl *template.Template
+		dst *string
+	}{
+		{f.hostname, &h.hostname},
+		{f.appName, &h.appName},
+		{f.msgID, &h.msgID},
+	} {
+		if t.tpl == nil {
+			continue
+		}
+		s, err := execute(t.tpl, ev)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", t.tpl.Name(), err)
+		}
+		*t.dst = s
+	}
+	msg := raw
+	if f.message != nil {
+		s, err := execute(f.message, ev)
+		if err != nil {
+			return nil, fmt.Errorf("message: %v", err)
+		}
+		msg = []byte(s)
+	}
+	buf := new(bytes.Buffer)
+	switch f.format {
+	case formatRFC3164:
+		f.rfc3164(buf, h, msg, now)
+	default:
+		err = f.rfc5424(buf, h, ev, msg, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// rfc5424 writes <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+func (f *formatter) rfc5424(buf *bytes.Buffer, h *header, ev interface{}, msg []byte, now time.Time) error {
+	fmt.Fprintf(buf, "<%d>1 %s %s %s %s %s ",
+		h.facility*8+h.severity,
+		now.Format(time.RFC3339Nano),
+		headerField(h.hostname, 255),
+		headerField(h.appName, 48),
+		headerField(h.procID, 128),
+		headerField(h.msgID, 32),
+	)
+	if len(f.sdParams) == 0 {
+		buf.WriteString(nilValue)
+	} else {
+		buf.WriteString("[")
+		buf.WriteString(f.sdID)
+		for i, p := range f.sdParams {
+			v, err := p.EvalString(ev)
+			if err != nil {
+				return fmt.Errorf("structured data param %q: %v", f.sdKeys[i], err)
+			}
+			fmt.Fprintf(buf, ` %s="%s"`, f.sdKeys[i], sdParamEscaper.Replace(v))
+		}
+		buf.WriteString("]")
+	}
+	if len(msg) > 0 {
+		buf.WriteString(" ")
+		buf.Write(msg)
+	}
+	return nil
+}
+
+// rfc3164 writes <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG.
+func (f *formatter) rfc3164(buf *bytes.Buffer, h *header, msg []byte, now time.Time) {
+	tag := h.appName
+	if len(tag) > 32 {
+		tag = tag[:32]
+	}
+	fmt.Fprintf(buf, "<%d>%s %s %s", h.facility*8+h.severity, now.Format(time.Stamp), headerField(h.hostname, 255), tag)
+	if h.procID != "" {
+		fmt.Fprintf(buf, "[%s]", h.procID)
+	}
+	buf.WriteString(": ")
+	buf.Write(msg)
+}
+
+// lookup executes tpl and converts its result to a code using names,
+// the result can also be a number up to max.
+func lookup(tpl *template.Template, ev interface{}, names map[string]int, max int) (int, error) {
+	s, err := execute(tpl, ev)
+	if err != nil {
+		return 0, err
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > max {
+		return 0, fmt.Errorf("unknown value %q", s)
+	}
+	return v, nil
+}
+
+func execute(tpl *template.Template, ev interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := tpl.Execute(buf, ev)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// headerField replaces empty values with the NILVALUE,
+// removes spaces and truncates s to max characters.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// validSDName reports whether s is a valid SD-NAME.
+func validSDName(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for _, r := range s {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return false
+		}
+	}
+	return true
+}
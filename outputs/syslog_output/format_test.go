@@ -0,0 +1,207 @@
+package syslog_output
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		c       *cfg
+		procID  string
+		ev      string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "rfc5424 defaults",
+			c:      &cfg{Format: formatRFC5424},
+			procID: "42",
+			ev:     `{"a":1}`,
+			want:   `<14>1 2022-03-01T10:04:05Z host orbrs 42 - - {"a":1}`,
+		},
+		{
+			name: "rfc5424 templates",
+			c: &cfg{
+				Format:   formatRFC5424,
+				Facility: "local0",
+				Severity: "{{.sev}}",
+				Hostname: "{{.host}}",
+				AppName:  "app",
+				MsgID:    "{{.id}}",
+				Message:  "{{.host}} is {{.state}}",
+			},
+			procID: "42",
+			ev:     `{"sev":"ERR","host":"r 1","id":"IF","state":"down"}`,
+			want:   `<131>1 2022-03-01T10:04:05Z r1 app 42 IF - r 1 is down`,
+		},
+		{
+			name: "numeric severity",
+			c:    &cfg{Format: formatRFC5424, Facility: "{{.f}}", Severity: "{{.s}}", Message: "m"},
+			ev:   `{"f":3,"s":2}`,
+			want: `<26>1 2022-03-01T10:04:05Z host orbrs - - - m`,
+		},
+		{
+			name:    "unknown severity",
+			c:       &cfg{Format: formatRFC5424, Severity: "{{.s}}"},
+			ev:      `{"s":"loud"}`,
+			wantErr: true,
+		},
+		{
+			name:    "severity out of range",
+			c:       &cfg{Format: formatRFC5424, Severity: "8"},
+			ev:      `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "facility out of range",
+			c:       &cfg{Format: formatRFC5424, Facility: "24"},
+			ev:      `{}`,
+			wantErr: true,
+		},
+		{
+			name: "structured data",
+			c: &cfg{
+				Format:  formatRFC5424,
+				Message: "m",
+				StructuredData: &sdCfg{
+					ID:     defaultSDID,
+					Params: map[string]string{"b": ".b", "a": "{{.a}}", "n": ".n"},
+				},
+			},
+			ev:   `{"a":1,"b":"x\"]\\","n":1.5}`,
+			want: `<14>1 2022-03-01T10:04:05Z host orbrs - - [orbrs@32473 a="1" b="x\"\]\\" n="1.5"] m`,
+		},
+		{
+			name: "structured data jq error",
+			c: &cfg{
+				Format:         formatRFC5424,
+				StructuredData: &sdCfg{ID: defaultSDID, Params: map[string]string{"a": ".a.b"}},
+			},
+			ev:      `{"a":1}`,
+			wantErr: true,
+		},
+		{
+			name:   "rfc3164",
+			c:      &cfg{Format: formatRFC3164, Severity: "warning", Message: "{{.msg}}"},
+			procID: "42",
+			ev:     `{"msg":"link down"}`,
+			want:   `<12>Mar  1 10:04:05 host orbrs[42]: link down`,
+		},
+		{
+			name: "rfc3164 long tag without pid",
+			c:    &cfg{Format: formatRFC3164, AppName: strings.Repeat("a", 40)},
+			ev:   `{"a":1}`,
+			want: `<14>Mar  1 10:04:05 host ` + strings.Repeat("a", 32) + `: {"a":1}`,
+		},
+		{
+			name: "rfc3164 ignores structured data",
+			c: &cfg{
+				Format:         formatRFC3164,
+				Message:        "m",
+				StructuredData: &sdCfg{ID: defaultSDID, Params: map[string]string{"a": ".a"}},
+			},
+			procID: "42",
+			ev:     `{"a":1}`,
+			want:   `<14>Mar  1 10:04:05 host orbrs[42]: m`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.c.StructuredData == nil {
+				tt.c.StructuredData = &sdCfg{ID: defaultSDID}
+			}
+			f, err := newFormatter(tt.c, "host", tt.procID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ev interface{}
+			err = json.Unmarshal([]byte(tt.ev), &ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := f.build(ev, []byte(tt.ev), now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got  %q\nwant %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFormatterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *cfg
+	}{
+		{name: "bad template", c: &cfg{Message: "{{.a"}},
+		{name: "bad param name", c: &cfg{StructuredData: &sdCfg{Params: map[string]string{"a=b": ".a"}}}},
+		{name: "bad jq expression", c: &cfg{StructuredData: &sdCfg{Params: map[string]string{"a": ".a | ]"}}}},
+		{name: "bad param template", c: &cfg{StructuredData: &sdCfg{Params: map[string]string{"a": "{{.a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.c.StructuredData == nil {
+				tt.c.StructuredData = new(sdCfg)
+			}
+			_, err := newFormatter(tt.c, "host", "")
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestHeaderField(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{in: "", max: 10, want: "-"},
+		{in: "   ", max: 10, want: "-"},
+		{in: "router 1", max: 10, want: "router1"},
+		{in: "r\t1\n", max: 10, want: "r1"},
+		{in: "héllo", max: 10, want: "hllo"},
+		{in: "abcdef", max: 4, want: "abcd"},
+	}
+	for _, tt := range tests {
+		if got := headerField(tt.in, tt.max); got != tt.want {
+			t.Errorf("headerField(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestValidSDName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "orbrs@32473", want: true},
+		{in: "if-name", want: true},
+		{in: "", want: false},
+		{in: strings.Repeat("a", 33), want: false},
+		{in: "a b", want: false},
+		{in: "a=b", want: false},
+		{in: "a]", want: false},
+		{in: `a"`, want: false},
+		{in: "é", want: false},
+	}
+	for _, tt := range tests {
+		if got := validSDName(tt.in); got != tt.want {
+			t.Errorf("validSDName(%q) = %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package syslog_output
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputName          = "syslog"
+	defaultAddress      = "localhost:514"
+	defaultNetwork      = networkUDP
+	defaultFormat       = formatRFC5424
+	defaultFacility     = "user"
+	defaultSeverity     = "info"
+	defaultAppName      = "orbrs"
+	defaultSDID         = "orbrs@32473"
+	defaultDialTimeout  = 5 * time.Second
+	syslogConnectWait   = 2 * time.Second
+	defaultNumWorkers   = 1
+	defaultWriteTimeout = 5 * time.Second
+	loggingPrefix       = "syslog_output"
+
+	networkUDP = "udp"
+	networkTCP = "tcp"
+	networkTLS = "tls"
+
+	formatRFC5424 = "rfc5424"
+	formatRFC3164 = "rfc3164"
+
+	framingOctetCounting  = "octet-counting"
+	framingNonTransparent = "non-transparent"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return &SyslogOutput{
+			cfg:     &cfg{},
+			wg:      new(sync.WaitGroup),
+			msgChan: make(chan interface{}),
+		}
+	})
+}
+
+type SyslogOutput struct {
+	cfg *cfg
+
+	ctx        context.Context
+	cfn        context.CancelFunc
+	formatter  *formatter
+	tlsConfig  *tls.Config
+	procs      []processors.Processor
+	deadLetter *outputs.DeadLetter
+	msgChan    chan interface{}
+	wg         *sync.WaitGroup
+	logger     *log.Entry
+}
+
+type cfg struct {
+	Address string `mapstructure:"address,omitempty"`
+	// udp, tcp or tls
+	Network string           `mapstructure:"network,omitempty"`
+	TLS     *utils.TLSConfig `mapstructure:"tls,omitempty"`
+	// rfc5424 or rfc3164
+	Format string `mapstructure:"format,omitempty"`
+	// octet-counting or non-transparent, tcp and tls only
+	Framing string `mapstructure:"framing,omitempty"`
+	// Go templates executed against each event,
+	// facility and severity can be names or numeric codes.
+	Facility string `mapstructure:"facility,omitempty"`
+	Severity string `mapstructure:"severity,omitempty"`
+	Hostname string `mapstructure:"hostname,omitempty"`
+	AppName  string `mapstructure:"app-name,omitempty"`
+	MsgID    string `mapstructure:"msg-id,omitempty"`
+	// the event JSON is sent if unset
+	Message string `mapstructure:"message,omitempty"`
+	// rfc5424 only
+	StructuredData *sdCfg        `mapstructure:"structured-data,omitempty"`
+	DialTimeout    time.Duration `mapstructure:"dial-timeout,omitempty"`
+	Debug          bool          `mapstructure:"debug,omitempty"`
+	NumWorkers     int           `mapstructure:"num-workers,omitempty"`
+	WriteTimeout   time.Duration `mapstructure:"write-timeout,omitempty"`
+	Processors     []string      `mapstructure:"processors,omitempty"`
+}
+
+type sdCfg struct {
+	ID string `mapstructure:"id,omitempty"`
+	// param names to jq expressions or Go templates
+	Params map[string]string `mapstructure:"params,omitempty"`
+}
+
+func (s *SyslogOutput) Init(ctx context.Context, cfg interface{}, opts ...outputs.Option) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	err = s.setDefaults()
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	s.formatter, err = newFormatter(s.cfg, hostname, strconv.Itoa(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	if s.cfg.Network == networkTLS {
+		tlsCfg := s.cfg.TLS
+		if tlsCfg == nil {
+			tlsCfg = new(utils.TLSConfig)
+		}
+		s.tlsConfig, err = tlsCfg.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	s.ctx, s.cfn = context.WithCancel(ctx)
+	s.logger.Infof("output starting with config: %+v", s.cfg)
+	s.wg.Add(s.cfg.NumWorkers)
+	for i := 0; i < s.cfg.NumWorkers; i++ {
+		go s.worker(s.ctx, i)
+	}
+	return nil
+}
+
+func (s *SyslogOutput) Write(ctx context.Context, d interface{}) error {
+	switch d := d.(type) {
+	case nil:
+		s.logger.Debug("nil data received, skipping...")
+		return nil
+	case []uint8:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case []interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	case map[string]interface{}:
+		if len(d) == 0 {
+			s.logger.Debug("nil data received, skipping...")
+			return nil
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, s.cfg.WriteTimeout)
+	defer cancel()
+	select {
+	case <-tctx.Done():
+		return tctx.Err()
+	case s.msgChan <- d:
+	}
+	return nil
+}
+
+func (s *SyslogOutput) Close() error {
+	if s.cfn != nil {
+		s.cfn()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *SyslogOutput) WithLogger(logger *log.Logger) {
+	if s.logger == nil {
+		s.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+func (s *SyslogOutput) WithProcessors(procs map[string]processors.Processor) {
+	for _, name := range s.cfg.Processors {
+		if p, ok := procs[name]; ok {
+			s.procs = append(s.procs, p)
+			continue
+		}
+		s.logger.Warnf("processor %q not found", name)
+	}
+}
+
+func (s *SyslogOutput) WithDeadLetter(d *outputs.DeadLetter) {
+	s.deadLetter = d
+}
+
+func (s *SyslogOutput) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, s.cfg)
+	if err != nil {
+		return err
+	}
+	return s.setDefaults()
+}
+
+func (s *SyslogOutput) setDefaults() error {
+	if s.cfg.Address == "" {
+		s.cfg.Address = defaultAddress
+	}
+	switch s.cfg.Network {
+	case "":
+		s.cfg.Network = defaultNetwork
+	case networkUDP, networkTCP, networkTLS:
+	default:
+		return fmt.Errorf("unknown network %q", s.cfg.Network)
+	}
+	switch s.cfg.Format {
+	case "":
+		s.cfg.Format = defaultFormat
+	case formatRFC5424, formatRFC3164:
+	default:
+		return fmt.Errorf("unknown format %q", s.cfg.Format)
+	}
+	switch s.cfg.Framing {
+	case "":
+		s.cfg.Framing = framingOctetCounting
+	case framingOctetCounting, framingNonTransparent:
+	default:
+		return fmt.Errorf("unknown framing %q", s.cfg.Framing)
+	}
+	if s.cfg.StructuredData == nil {
+		s.cfg.StructuredData = new(sdCfg)
+	}
+	if s.cfg.StructuredData.ID == "" {
+		s.cfg.StructuredData.ID = defaultSDID
+	}
+	if !validSDName(s.cfg.StructuredData.ID) {
+		return fmt.Errorf("invalid structured data id %q", s.cfg.StructuredData.ID)
+	}
+	if s.cfg.DialTimeout <= 0 {
+		s.cfg.DialTimeout = defaultDialTimeout
+	}
+	if s.cfg.NumWorkers <= 0 {
+		s.cfg.NumWorkers = defaultNumWorkers
+	}
+	if s.cfg.WriteTimeout <= 0 {
+		s.cfg.WriteTimeout = defaultWriteTimeout
+	}
+	return nil
+}
+
+func (s *SyslogOutput) dial() (net.Conn, error) {
+	switch s.cfg.Network {
+	case networkTLS:
+		d := &net.Dialer{Timeout: s.cfg.DialTimeout}
+		return tls.DialWithDialer(d, "tcp", s.cfg.Address, s.tlsConfig)
+	default:
+		return net.DialTimeout(s.cfg.Network, s.cfg.Address, s.cfg.DialTimeout)
+	}
+}
+
+func (s *SyslogOutput) worker(ctx context.Context, idx int) {
+	defer s.wg.Done()
+	var conn net.Conn
+	var err error
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	s.logger.Infof("%s starting", workerLogPrefix)
+CRCONN:
+	conn, err = s.dial()
+	if err != nil {
+		s.logger.Errorf("%s failed to connect to %s: %v", workerLogPrefix, s.cfg.Address, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syslogConnectWait):
+		}
+		goto CRCONN
+	}
+	defer conn.Close()
+	s.logger.Infof("%s connected to %s", workerLogPrefix, s.cfg.Address)
+OUTER:
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Infof("%s shutting down", workerLogPrefix)
+			return
+		case msg := <-s.msgChan:
+			var data interface{}
+			data = msg
+			for _, p := range s.procs {
+				data, err = p.Apply(data)
+				if err != nil {
+					s.logger.Errorf("failed to apply processor: %v", err)
+					s.deadLetter.Send(ctx, msg, fmt.Errorf("processor failed: %w", err))
+					continue OUTER
+				}
+			}
+			b, err := s.message(data)
+			if err != nil {
+				s.logger.Errorf("%s failed to build message: %v", workerLogPrefix, err)
+				s.deadLetter.Send(ctx, msg, err)
+				continue
+			}
+			if s.cfg.Debug {
+				s.logger.Debugf("%s sending: %s", workerLogPrefix, string(b))
+			}
+			conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+			_, err = conn.Write(s.frame(b))
+			if err != nil {
+				s.logger.Errorf("%s failed to send message: %v", workerLogPrefix, err)
+				s.deadLetter.Send(ctx, msg, err)
+				conn.Close()
+				goto CRCONN
+			}
+		}
+	}
+}
+
+func (s *SyslogOutput) message(data interface{}) ([]byte, error) {
+	raw, err := utils.ToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var ev interface{}
+	err = json.Unmarshal(raw, &ev)
+	if err != nil {
+		// not JSON, sent as is
+		ev = string(raw)
+	}
+	return s.formatter.build(ev, raw, time.Now())
+}
+
+// frame adds the stream transports framing to b.
+func (s *SyslogOutput) frame(b []byte) []byte {
+	if s.cfg.Network == networkUDP {
+		return b
+	}
+	if s.cfg.Framing == framingNonTransparent {
+		return append(b, '\n')
+	}
+	return append([]byte(strconv.Itoa(len(b))+" "), b...)
+}
@@ -0,0 +1,60 @@
+package teams_output
+
+import (
+	"strings"
+
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/outputs/chat_output"
+)
+
+const (
+	outputName    = "teams"
+	loggingPrefix = "teams_output"
+)
+
+func init() {
+	outputs.Register(outputName, func() outputs.Output {
+		return chat_output.New(formatter{}, loggingPrefix)
+	})
+}
+
+// formatter builds a connector MessageCard.
+type formatter struct{}
+
+func (formatter) Payload(m *chat_output.Message) interface{} {
+	card := map[string]interface{}{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  m.Title,
+		"title":    m.Title,
+	}
+	if m.Color != "" {
+		card["themeColor"] = strings.TrimPrefix(m.Color, "#")
+	}
+	section := map[string]interface{}{
+		"text": m.Text,
+	}
+	if len(m.Fields) > 0 {
+		facts := make([]interface{}, 0, len(m.Fields))
+		for _, f := range m.Fields {
+			facts = append(facts, map[string]interface{}{
+				"name":  f.Name,
+				"value": f.Value,
+			})
+		}
+		section["facts"] = facts
+	}
+	card["sections"] = []interface{}{section}
+	if m.Link != "" {
+		card["potentialAction"] = []interface{}{
+			map[string]interface{}{
+				"@type": "OpenUri",
+				"name":  "Open",
+				"targets": []interface{}{
+					map[string]interface{}{"os": "default", "uri": m.Link},
+				},
+			},
+		}
+	}
+	return card
+}
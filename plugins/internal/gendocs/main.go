@@ -0,0 +1,403 @@
+// gendocs extracts the config structs fields comments and default values
+// from the ouroboros sources and writes them as a Go map for the plugins package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirs are the directories, relative to the module root, scanned for config structs.
+var dirs = []string{"config", "orbrs", "tracing", "utils", "triggers", "actions", "outputs", "processors"}
+
+type fieldDoc struct {
+	description string
+	def         string
+}
+
+// field is a config struct field.
+type field struct {
+	pkgPath string
+	typ     string
+	name    string
+}
+
+type pkgFiles struct {
+	files []*ast.File
+	info  *types.Info
+}
+
+// scanner type checks the module packages from source, the standard library ones included.
+// The third party imports are not resolved, the fields and constants not depending on them are still typed.
+type scanner struct {
+	root    string
+	modPath string
+	fset    *token.FileSet
+	std     types.Importer
+	// type checked module packages by path
+	pkgs map[string]*types.Package
+
+	// config struct fields by position of their name,
+	// a package imported before it is scanned is checked twice.
+	fields map[string]*field
+	// field docs by package path and type name, then field name
+	docs map[string]map[string]*fieldDoc
+}
+
+func main() {
+	root := flag.String("root", "..", "module root directory")
+	out := flag.String("o", "docs.go", "output file")
+	flag.Parse()
+
+	modPath, err := modulePath(*root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &scanner{
+		root:    *root,
+		modPath: modPath,
+		fset:    token.NewFileSet(),
+		pkgs:    make(map[string]*types.Package),
+		fields:  make(map[string]*field),
+		docs:    make(map[string]map[string]*fieldDoc),
+	}
+	s.std = importer.ForCompiler(s.fset, "source", nil)
+
+	var scanned []*pkgFiles
+	for _, d := range dirs {
+		err = filepath.Walk(filepath.Join(*root, d), func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				return nil
+			}
+			if fi.Name() == "internal" {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(*root, path)
+			if err != nil {
+				return err
+			}
+			pkgPath := modPath + "/" + filepath.ToSlash(rel)
+			p, err := s.check(pkgPath, parser.ParseComments)
+			if err != nil || len(p.files) == 0 {
+				return err
+			}
+			s.collectFields(pkgPath, p)
+			scanned = append(scanned, p)
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the defaults are set by the packages using the config structs,
+	// they are collected once all the structs are known.
+	for _, p := range scanned {
+		s.collectDefaults(p)
+	}
+	b, err := render(s.docs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = ioutil.WriteFile(*out, b, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func modulePath(root string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(l, "module ")), nil
+		}
+	}
+	return "", fmt.Errorf("module path not found in go.mod")
+}
+
+// check parses and type checks the module package pkgPath.
+func (s *scanner) check(pkgPath string, mode parser.Mode) (*pkgFiles, error) {
+	dir := filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(pkgPath, s.modPath)))
+	pkgs, err := parser.ParseDir(s.fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, mode)
+	if err != nil {
+		return nil, err
+	}
+	p := &pkgFiles{
+		info: &types.Info{
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+			Types: make(map[ast.Expr]types.TypeAndValue),
+		},
+	}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			p.files = append(p.files, f)
+		}
+	}
+	conf := types.Config{
+		Importer: s,
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(pkgPath, s.fset, p.files, p.info)
+	s.pkgs[pkgPath] = pkg
+	return p, nil
+}
+
+func (s *scanner) Import(path string) (*types.Package, error) {
+	if pkg, ok := s.pkgs[path]; ok {
+		return pkg, nil
+	}
+	if strings.HasPrefix(path, s.modPath+"/") {
+		_, err := s.check(path, 0)
+		if err != nil {
+			return nil, err
+		}
+		return s.pkgs[path], nil
+	}
+	if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+		return nil, fmt.Errorf("%s not imported", path)
+	}
+	return s.std.Import(path)
+}
+
+// collectFields records the exported fields of the config structs and their comments.
+func (s *scanner) collectFields(pkgPath string, p *pkgFiles) {
+	for _, f := range p.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			ts, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || !isConfig(ts.Name.Name, st) {
+				return true
+			}
+			for _, fl := range st.Fields.List {
+				desc := comment(fl.Doc)
+				if desc == "" {
+					desc = comment(fl.Comment)
+				}
+				for _, id := range fl.Names {
+					if !id.IsExported() {
+						continue
+					}
+					s.fields[s.fset.Position(id.Pos()).String()] = &field{pkgPath: pkgPath, typ: ts.Name.Name, name: id.Name}
+					if desc != "" {
+						s.docFor(pkgPath, ts.Name.Name, id.Name).description = desc
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// collectDefaults records the constant values assigned to the config structs fields:
+// all of them in the functions setting defaults,
+// elsewhere only when guarded by a zero value check of the field.
+func (s *scanner) collectDefaults(p *pkgFiles) {
+	for _, f := range p.files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			isDefaults := strings.Contains(strings.ToLower(fd.Name.Name), "default")
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.IfStmt:
+					if isDefaults {
+						return true
+					}
+					guard := zeroCheck(n.Cond, p.info)
+					if guard == nil {
+						return true
+					}
+					for _, st := range n.Body.List {
+						s.setDefault(st, guard, p.info)
+					}
+				case *ast.AssignStmt:
+					if isDefaults {
+						s.setDefault(n, nil, p.info)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// setDefault records the constant values assigned by st to config fields, to guard only if set.
+// The first value found is kept.
+func (s *scanner) setDefault(st ast.Stmt, guard types.Object, info *types.Info) {
+	as, ok := st.(*ast.AssignStmt)
+	if !ok || as.Tok != token.ASSIGN || len(as.Lhs) != len(as.Rhs) {
+		return
+	}
+	for i, lhs := range as.Lhs {
+		sel, ok := lhs.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		obj := info.Uses[sel.Sel]
+		if obj == nil || (guard != nil && obj != guard) {
+			continue
+		}
+		fl, ok := s.fields[s.fset.Position(obj.Pos()).String()]
+		if !ok {
+			continue
+		}
+		v, ok := constValue(info.Types[as.Rhs[i]])
+		// resetting invalid values to zero is not a default
+		if !ok || isZero(v) {
+			continue
+		}
+		fd := s.docFor(fl.pkgPath, fl.typ, fl.name)
+		if fd.def == "" {
+			fd.def = v
+		}
+	}
+}
+
+func (s *scanner) docFor(pkgPath, typ, field string) *fieldDoc {
+	key := pkgPath + "." + typ
+	if s.docs[key] == nil {
+		s.docs[key] = make(map[string]*fieldDoc)
+	}
+	if s.docs[key][field] == nil {
+		s.docs[key][field] = new(fieldDoc)
+	}
+	return s.docs[key][field]
+}
+
+// isConfig reports whether the struct is decoded from the config file:
+// the plugins cfg structs and the structs with mapstructure tags.
+func isConfig(name string, st *ast.StructType) bool {
+	if name == "cfg" {
+		return true
+	}
+	for _, fl := range st.Fields.List {
+		if fl.Tag != nil && strings.Contains(fl.Tag.Value, "mapstructure:") {
+			return true
+		}
+	}
+	return false
+}
+
+// zeroCheck returns the field compared to its zero value by cond, e.g. c.Timeout <= 0.
+func zeroCheck(cond ast.Expr, info *types.Info) types.Object {
+	be, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return nil
+	}
+	switch be.Op {
+	case token.EQL, token.LEQ, token.LSS:
+	default:
+		return nil
+	}
+	sel, ok := be.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	switch y := be.Y.(type) {
+	case *ast.BasicLit:
+		if y.Value != `""` && y.Value != "0" {
+			return nil
+		}
+	case *ast.Ident:
+		if y.Name != "nil" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return info.Uses[sel.Sel]
+}
+
+func constValue(tv types.TypeAndValue) (string, bool) {
+	if tv.Value == nil {
+		return "", false
+	}
+	if named, ok := tv.Type.(*types.Named); ok && named.Obj().Pkg() != nil &&
+		named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Duration" {
+		d, ok := constant.Int64Val(tv.Value)
+		if !ok {
+			return "", false
+		}
+		return time.Duration(d).String(), true
+	}
+	if tv.Value.Kind() == constant.String {
+		return constant.StringVal(tv.Value), true
+	}
+	return tv.Value.ExactString(), true
+}
+
+func isZero(v string) bool {
+	switch v {
+	case "", "0", "0s", "false":
+		return true
+	}
+	return false
+}
+
+func comment(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
+
+func render(docs map[string]map[string]*fieldDoc) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString("// Code generated by gendocs. DO NOT EDIT.\n\npackage plugins\n\n")
+	buf.WriteString("var docs = map[string]map[string]fieldDoc{\n")
+	keys := make([]string, 0, len(docs))
+	for t := range docs {
+		keys = append(keys, t)
+	}
+	sort.Strings(keys)
+	for _, t := range keys {
+		fmt.Fprintf(buf, "%q: {\n", t)
+		names := make([]string, 0, len(docs[t]))
+		for n := range docs[t] {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			d := docs[t][n]
+			fmt.Fprintf(buf, "%q: {", n)
+			if d.description != "" {
+				fmt.Fprintf(buf, "Description: %q,", d.description)
+			}
+			if d.def != "" {
+				fmt.Fprintf(buf, "Default: %q,", d.def)
+			}
+			buf.WriteString("},\n")
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
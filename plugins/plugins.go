@@ -0,0 +1,270 @@
+// Package plugins describes the registered triggers, processors, actions and outputs types
+// and their configuration fields, derived from the plugins config structs.
+package plugins
+
+//go:generate go run ./internal/gendocs -root .. -o docs.go
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+)
+
+const (
+	KindTrigger   = "trigger"
+	KindProcessor = "processor"
+	KindAction    = "action"
+	KindOutput    = "output"
+)
+
+// Kinds are the plugin kinds in pipeline order.
+var Kinds = []string{KindTrigger, KindProcessor, KindAction, KindOutput}
+
+// Plugin is a registered plugin type.
+type Plugin struct {
+	Kind   string   `json:"kind"`
+	Type   string   `json:"type"`
+	Fields []*Field `json:"fields"`
+
+	cfg reflect.Type
+}
+
+// Field is a plugin config field.
+type Field struct {
+	// config key, nested keys are separated by dots,
+	// [] stands for the items of a list and * for the values of a map.
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// fieldDoc is a config field comment and default value, extracted from the sources by gendocs.
+type fieldDoc struct {
+	Description string
+	Default     string
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Kind returns the plugin kind named k, singular or plural.
+func Kind(k string) (string, error) {
+	k = strings.TrimSuffix(strings.ToLower(k), "s")
+	for _, kind := range Kinds {
+		if k == kind {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown plugin kind %q", k)
+}
+
+// List returns the registered plugins of kind, all of them if kind is empty,
+// sorted by kind then type.
+func List(kind string) []*Plugin {
+	ps := make([]*Plugin, 0)
+	for _, k := range Kinds {
+		if kind != "" && kind != k {
+			continue
+		}
+		inits := initializers(k)
+		names := make([]string, 0, len(inits))
+		for name := range inits {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := &Plugin{Kind: k, Type: name, Fields: make([]*Field, 0)}
+			p.cfg = configType(inits[name]())
+			if p.cfg != nil {
+				p.Fields = describe(p.cfg, "", map[reflect.Type]bool{})
+			}
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+func initializers(kind string) map[string]func() interface{} {
+	inits := make(map[string]func() interface{})
+	switch kind {
+	case KindTrigger:
+		for name, in := range triggers.Triggers {
+			in := in
+			inits[name] = func() interface{} { return in() }
+		}
+	case KindProcessor:
+		for name, in := range processors.Processors {
+			in := in
+			inits[name] = func() interface{} { return in() }
+		}
+	case KindAction:
+		for name, in := range actions.Actions {
+			in := in
+			inits[name] = func() interface{} { return in() }
+		}
+	case KindOutput:
+		for name, in := range outputs.Outputs {
+			in := in
+			inits[name] = func() interface{} { return in() }
+		}
+	}
+	return inits
+}
+
+// configType returns the type of the config struct the plugin decodes its config to,
+// held in its cfg field.
+func configType(plugin interface{}) reflect.Type {
+	t := reflect.TypeOf(plugin)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, name := range []string{"cfg", "Cfg"} {
+		f, ok := t.FieldByName(name)
+		if !ok {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			return ft
+		}
+	}
+	return nil
+}
+
+// structField is a struct field decoded from the config key name.
+type structField struct {
+	name string
+	// struct declaring the field
+	owner reflect.Type
+	reflect.StructField
+}
+
+// structFields returns the fields of the struct t decoded by mapstructure,
+// the squashed embedded structs fields included.
+func structFields(t reflect.Type) []*structField {
+	fs := make([]*structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, opts := sf.Name, ""
+		if tag, ok := sf.Tag.Lookup("mapstructure"); ok {
+			name, opts = tag, ""
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				name, opts = tag[:idx], tag[idx+1:]
+			}
+		}
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "squash") {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fs = append(fs, structFields(ft)...)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		// mapstructure matches untagged field names case insensitively
+		fs = append(fs, &structField{name: strings.ToLower(name), owner: t, StructField: sf})
+	}
+	return fs
+}
+
+// describe returns the fields of the config struct t, and of its nested structs,
+// prefixing their names with prefix.
+// seen holds the structs being described, to stop on recursive types.
+func describe(t reflect.Type, prefix string, seen map[reflect.Type]bool) []*Field {
+	seen[t] = true
+	defer delete(seen, t)
+	fields := make([]*Field, 0)
+	for _, sf := range structFields(t) {
+		doc := lookupDoc(sf)
+		f := &Field{
+			Name:        prefix + sf.name,
+			Type:        typeName(sf.Type),
+			Default:     doc.Default,
+			Description: doc.Description,
+		}
+		fields = append(fields, f)
+		nested, sep := nestedStruct(sf.Type)
+		if nested != nil && !seen[nested] {
+			fields = append(fields, describe(nested, f.Name+sep, seen)...)
+		}
+	}
+	return fields
+}
+
+// nestedStruct returns the struct type of a config field holding a struct,
+// a list of structs or a map of structs, along with the separator of its fields keys.
+func nestedStruct(t reflect.Type) (reflect.Type, string) {
+	sep := ""
+	for {
+		switch t.Kind() {
+		case reflect.Ptr:
+			t = t.Elem()
+		case reflect.Slice, reflect.Array:
+			sep += "[]"
+			t = t.Elem()
+		case reflect.Map:
+			sep += ".*"
+			t = t.Elem()
+		case reflect.Struct:
+			return t, sep + "."
+		default:
+			return nil, ""
+		}
+	}
+}
+
+func lookupDoc(sf *structField) fieldDoc {
+	return docs[sf.owner.PkgPath()+"."+sf.owner.Name()][sf.Name]
+}
+
+func typeName(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case reflect.Interface:
+		return "any"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	}
+	return t.Kind().String()
+}
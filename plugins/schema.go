@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/karimra/ouroboros/config"
+)
+
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// sections are the config file sections holding plugins configs, by plugin kind.
+var sections = map[string]string{
+	"triggers":   KindTrigger,
+	"processors": KindProcessor,
+	"actions":    KindAction,
+	"outputs":    KindOutput,
+}
+
+// Schema returns the JSON Schema of the configuration file.
+// Each plugin config is matched to the schema of its type, using its type field.
+func Schema() map[string]interface{} {
+	props := map[string]interface{}{
+		"debug": map[string]interface{}{
+			"type":        "boolean",
+			"description": "debug mode",
+		},
+	}
+	for _, sf := range structFields(reflect.TypeOf(config.Config{})) {
+		if sf.name == "flags" {
+			continue
+		}
+		if kind, ok := sections[sf.name]; ok {
+			props[sf.name] = sectionSchema(kind)
+			continue
+		}
+		props[sf.name] = fieldSchema(sf, map[reflect.Type]bool{})
+	}
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      "orbrs configuration",
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+func sectionSchema(kind string) map[string]interface{} {
+	ps := List(kind)
+	types := make([]string, 0, len(ps))
+	conds := make([]interface{}, 0, len(ps))
+	for _, p := range ps {
+		types = append(types, p.Type)
+		if p.cfg == nil {
+			continue
+		}
+		conds = append(conds, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"type": map[string]interface{}{"const": p.Type},
+				},
+				"required": []string{"type"},
+			},
+			"then": structSchema(p.cfg, map[reflect.Type]bool{}),
+		})
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"description": kind + "s by name",
+		"additionalProperties": map[string]interface{}{
+			"type":     "object",
+			"required": []string{"type"},
+			"properties": map[string]interface{}{
+				"type": map[string]interface{}{
+					"type":        "string",
+					"description": kind + " type",
+					"enum":        types,
+				},
+			},
+			"allOf": conds,
+		},
+	}
+}
+
+// structSchema returns the schema of the config struct t.
+// seen holds the structs being described, to stop on recursive types.
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	seen[t] = true
+	defer delete(seen, t)
+	props := make(map[string]interface{})
+	for _, sf := range structFields(t) {
+		props[sf.name] = fieldSchema(sf, seen)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+}
+
+func fieldSchema(sf *structField, seen map[reflect.Type]bool) map[string]interface{} {
+	s := valueSchema(sf.Type, seen)
+	doc := lookupDoc(sf)
+	if doc.Description != "" {
+		s["description"] = doc.Description
+	}
+	if doc.Default != "" {
+		if v, ok := typedDefault(s["type"], doc.Default); ok {
+			s["default"] = v
+		}
+	}
+	return s
+}
+
+func valueSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	if t == durationType {
+		return map[string]interface{}{
+			"type":    "string",
+			"pattern": durationPattern,
+		}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return valueSchema(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		return structSchema(t, seen)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": valueSchema(t.Elem(), seen),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": valueSchema(t.Elem(), seen),
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	// interfaces accept any value
+	return map[string]interface{}{}
+}
+
+// typedDefault converts the default value def to the schema type typ.
+func typedDefault(typ interface{}, def string) (interface{}, bool) {
+	switch typ {
+	case "string":
+		return def, true
+	case "boolean":
+		v, err := strconv.ParseBool(def)
+		return v, err == nil
+	case "integer":
+		v, err := strconv.ParseInt(def, 10, 64)
+		return v, err == nil
+	case "number":
+		v, err := strconv.ParseFloat(def, 64)
+		return v, err == nil
+	}
+	return nil, false
+}
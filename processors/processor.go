@@ -29,6 +29,18 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
+// Dropped reports whether v, returned by a processor Apply, is an empty result
+// counted as a dropped event in the metrics.
+func Dropped(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
 func CreateProcessor(cfg map[string]interface{}) (Processor, error) {
 	if aType, ok := cfg["type"]; ok {
 		if pin, ok := Processors[aType.(string)]; ok {
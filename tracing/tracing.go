@@ -0,0 +1,273 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karimra/ouroboros/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	instrumentationName = "github.com/karimra/ouroboros"
+	protocolHTTP        = "http"
+	protocolGRPC        = "grpc"
+	defaultHTTPAddress  = "localhost:4318"
+	defaultGRPCAddress  = "localhost:4317"
+	defaultServiceName  = "orbrs"
+	defaultTimeout      = 10 * time.Second
+)
+
+// Config is the OTLP exporter configuration.
+type Config struct {
+	// OTLP collector address, host:port
+	Address string `mapstructure:"address,omitempty" json:"address,omitempty"`
+	// http or grpc
+	Protocol string `mapstructure:"protocol,omitempty" json:"protocol,omitempty"`
+	// plain text connection to the collector
+	Insecure bool              `mapstructure:"insecure,omitempty" json:"insecure,omitempty"`
+	TLS      *utils.TLSConfig  `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+	Headers  map[string]string `mapstructure:"headers,omitempty" json:"headers,omitempty"`
+	// export request timeout
+	Timeout     time.Duration `mapstructure:"timeout,omitempty" json:"timeout,omitempty"`
+	ServiceName string        `mapstructure:"service-name,omitempty" json:"service-name,omitempty"`
+	// fraction of the traces started by orbrs that are sampled, defaults to 1.
+	// The traces propagated by the events sources follow their sampling decision.
+	SampleRatio float64 `mapstructure:"sample-ratio,omitempty" json:"sample-ratio,omitempty"`
+}
+
+// Start installs the global tracer provider exporting spans to the collector configured by cfg,
+// and the W3C trace context and baggage propagators.
+// The returned function flushes the pending spans and stops the provider.
+func Start(ctx context.Context, cfg *Config) (func(context.Context) error, error) {
+	err := cfg.setDefaults()
+	if err != nil {
+		return nil, err
+	}
+	client, err := cfg.newClient()
+	if err != nil {
+		return nil, err
+	}
+	exp, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Validate checks the protocol and loads the TLS files of c.
+func (c *Config) Validate() error {
+	switch c.Protocol {
+	case "", protocolHTTP, protocolGRPC:
+	default:
+		return fmt.Errorf("unknown protocol %q", c.Protocol)
+	}
+	if c.TLS != nil && !c.Insecure {
+		_, err := c.TLS.NewTLS()
+		if err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	if c.Protocol == "" {
+		c.Protocol = protocolHTTP
+	}
+	if c.Address == "" {
+		c.Address = defaultHTTPAddress
+		if c.Protocol == protocolGRPC {
+			c.Address = defaultGRPCAddress
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = defaultServiceName
+	}
+	if c.SampleRatio <= 0 || c.SampleRatio > 1 {
+		c.SampleRatio = 1
+	}
+	return nil
+}
+
+func (c *Config) newClient() (otlptrace.Client, error) {
+	if c.Protocol == protocolGRPC {
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(c.Address),
+			otlptracegrpc.WithHeaders(c.Headers),
+			otlptracegrpc.WithTimeout(c.Timeout),
+		}
+		switch {
+		case c.Insecure:
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		case c.TLS != nil:
+			tlsCfg, err := c.TLS.NewTLS()
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+		}
+		return otlptracegrpc.NewClient(opts...), nil
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(c.Address),
+		otlptracehttp.WithHeaders(c.Headers),
+		otlptracehttp.WithTimeout(c.Timeout),
+	}
+	switch {
+	case c.Insecure:
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case c.TLS != nil:
+		tlsCfg, err := c.TLS.NewTLS()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsCfg))
+	}
+	return otlptracehttp.NewClient(opts...), nil
+}
+
+// Tracer returns the tracer creating the orbrs spans,
+// its spans are not recorded unless Start was called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End records err, if any, on span then ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Extract returns the span context propagated in the headers of an incoming message,
+// header names are matched case insensitively.
+func Extract(h map[string][]string) trace.SpanContext {
+	if len(h) == 0 {
+		return trace.SpanContext{}
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(h))
+	return trace.SpanContextFromContext(ctx)
+}
+
+// InjectHTTP sets the span context of ctx in the headers of an outgoing HTTP request.
+func InjectHTTP(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Do sends req with client in a client span, child of the span in ctx
+// or linked to the valid events span contexts, and propagates it in the request headers.
+// The request is sent without span if there is neither.
+func Do(ctx context.Context, client *http.Client, req *http.Request, events ...trace.SpanContext) (*http.Response, error) {
+	links := make([]trace.Link, 0, len(events))
+	for _, sc := range events {
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	if len(links) == 0 && !trace.SpanContextFromContext(ctx).IsValid() {
+		return client.Do(req)
+	}
+	ctx, span := Tracer().Start(ctx, "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.NetPeerNameKey.String(req.URL.Hostname()),
+		))
+	InjectHTTP(ctx, req.Header)
+	rsp, err := client.Do(req)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rsp.StatusCode))
+	if rsp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, rsp.Status)
+	}
+	span.End()
+	return rsp, nil
+}
+
+// Traced is an event queued to an output worker along with the span context of its write,
+// so that the requests sent by the worker continue the event trace.
+type Traced struct {
+	SpanContext trace.SpanContext
+	Data        interface{}
+}
+
+// Wrap returns d wrapped in a *Traced if ctx carries a valid span context, d otherwise.
+func Wrap(ctx context.Context, d interface{}) interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return d
+	}
+	return &Traced{SpanContext: sc, Data: d}
+}
+
+// Unwrap returns the event and span context wrapped in v by Wrap.
+func Unwrap(v interface{}) (interface{}, trace.SpanContext) {
+	if t, ok := v.(*Traced); ok {
+		return t.Data, t.SpanContext
+	}
+	return v, trace.SpanContext{}
+}
+
+// headerCarrier adapts message headers, keyed by their name as received,
+// to a propagation.TextMapCarrier.
+type headerCarrier map[string][]string
+
+func (h headerCarrier) Get(key string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = []string{value}
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -1,3 +1,11 @@
 package all
 
-import _ "github.com/karimra/ouroboros/triggers/nats_trigger"
+import (
+	_ "github.com/karimra/ouroboros/triggers/amqp_trigger"
+	_ "github.com/karimra/ouroboros/triggers/file_trigger"
+	_ "github.com/karimra/ouroboros/triggers/grpc_trigger"
+	_ "github.com/karimra/ouroboros/triggers/mqtt_trigger"
+	_ "github.com/karimra/ouroboros/triggers/nats_trigger"
+	_ "github.com/karimra/ouroboros/triggers/netconf_trigger"
+	_ "github.com/karimra/ouroboros/triggers/redis_trigger"
+)
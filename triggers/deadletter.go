@@ -0,0 +1,39 @@
+package triggers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/karimra/ouroboros/outputs"
+)
+
+// StageError is returned by a trigger pipeline when a processor or an action fails.
+type StageError struct {
+	// outputs.StageProcessor or outputs.StageAction
+	Stage string
+	Name  string
+	Err   error
+}
+
+func (e *StageError) Error() string { return fmt.Sprintf("%s %q failed: %v", e.Stage, e.Name, e.Err) }
+func (e *StageError) Unwrap() error { return e.Err }
+
+// IsProcessorError reports whether err is the failure of a processor,
+// processing the same event again would fail the same way.
+func IsProcessorError(err error) bool {
+	var serr *StageError
+	return errors.As(err, &serr) && serr.Stage == outputs.StageProcessor
+}
+
+// SendDeadLetter writes event ev that failed after attempts to the dead-letter output d,
+// with the stage and name of err if it is a *StageError.
+func SendDeadLetter(ctx context.Context, d *outputs.DeadLetter, ev interface{}, err error, attempts int, first time.Time) {
+	var serr *StageError
+	if errors.As(err, &serr) {
+		d.For(serr.Stage, serr.Name).SendRetried(ctx, ev, serr.Err, attempts, first)
+		return
+	}
+	d.SendRetried(ctx, ev, err, attempts, first)
+}
@@ -0,0 +1,490 @@
+package file_trigger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	triggerName            = "file"
+	loggingPrefix          = "file_trigger"
+	defaultPollInterval    = time.Second
+	defaultTimestampFormat = time.RFC3339Nano
+
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatYAML  = "yaml"
+)
+
+func init() {
+	triggers.Register(triggerName, func() triggers.Trigger {
+		return &FileTrigger{
+			cfg:     new(cfg),
+			offsets: make(map[string]int64),
+		}
+	})
+}
+
+// FileTrigger reads events from a file or a directory of files,
+// optionally tailing them for appended lines.
+type FileTrigger struct {
+	*triggers.Pipeline
+
+	cfg    *cfg
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+
+	offsets map[string]int64
+}
+
+type cfg struct {
+	// file or directory path
+	Path string `mapstructure:"path,omitempty" json:"path,omitempty"`
+	// json, jsonl or yaml, derived from the file extension if empty
+	Format string `mapstructure:"format,omitempty" json:"format,omitempty"`
+	// keep watching the file(s) for appended lines and new files
+	Tail         bool          `mapstructure:"tail,omitempty" json:"tail,omitempty"`
+	PollInterval time.Duration `mapstructure:"poll-interval,omitempty" json:"poll-interval,omitempty"`
+	// dot separated path to the event timestamp, used to replay events with their original timing
+	TimestampField string `mapstructure:"timestamp-field,omitempty" json:"timestamp-field,omitempty"`
+	// unix, unix-ms, unix-us, unix-ns or a Go time layout
+	TimestampFormat string `mapstructure:"timestamp-format,omitempty" json:"timestamp-format,omitempty"`
+	// 0: no delay between events, 1: original timing, >1: accelerated
+	ReplaySpeed float64 `mapstructure:"replay-speed,omitempty" json:"replay-speed,omitempty"`
+	Debug       bool    `mapstructure:"debug,omitempty" json:"debug,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
+}
+
+// Start //
+func (f *FileTrigger) Start(ctx context.Context, cfg interface{}, opts ...triggers.Option) error {
+	err := utils.DecodeConfig(cfg, f.cfg)
+	if err != nil {
+		return err
+	}
+	f.Pipeline = triggers.NewPipeline(&f.cfg.PipelineConfig)
+	err = f.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	f.ctx, f.cfn = context.WithCancel(ctx)
+	f.logger.Infof("trigger starting with config: %+v", f.cfg)
+	f.Pipeline.Start(f.ctx, f.logger)
+	go f.read(f.ctx)
+	return nil
+}
+
+// read feeds the events found under the configured path to the pipeline,
+// then polls for appended lines and new files if tail is enabled.
+func (f *FileTrigger) read(ctx context.Context) {
+	r := &replayer{speed: f.cfg.ReplaySpeed}
+	files, err := f.listFiles()
+	if err != nil {
+		f.logger.Errorf("failed to list files: %v", err)
+		return
+	}
+	for _, fn := range files {
+		err = f.readFile(ctx, fn, r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			f.logger.Errorf("failed to read file %q: %v", fn, err)
+		}
+	}
+	if !f.cfg.Tail {
+		f.logger.Infof("done reading %d file(s) from %q", len(files), f.cfg.Path)
+		return
+	}
+	// appended events are sent as they come
+	r.speed = 0
+	ticker := time.NewTicker(f.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			files, err = f.listFiles()
+			if err != nil {
+				f.logger.Errorf("failed to list files: %v", err)
+				continue
+			}
+			for _, fn := range files {
+				err = f.readFile(ctx, fn, r)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					f.logger.Errorf("failed to read file %q: %v", fn, err)
+				}
+			}
+		}
+	}
+}
+
+func (f *FileTrigger) listFiles() ([]string, error) {
+	fi, err := os.Stat(f.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{f.cfg.Path}, nil
+	}
+	entries, err := os.ReadDir(f.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		fn := filepath.Join(f.cfg.Path, e.Name())
+		if f.cfg.Format == "" && formatFromExt(fn) == "" {
+			continue
+		}
+		files = append(files, fn)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readFile sends the events of file fn that were not read yet.
+// JSON and YAML files are read once they decode successfully, JSONL files are read
+// from the last known offset.
+func (f *FileTrigger) readFile(ctx context.Context, fn string, r *replayer) error {
+	format := f.cfg.Format
+	if format == "" {
+		format = formatFromExt(fn)
+	}
+	offset, seen := f.offsets[fn]
+	if seen && format != formatJSONL {
+		return nil
+	}
+	fd, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	switch format {
+	case formatJSON, formatYAML:
+		var evs [][]byte
+		if format == formatJSON {
+			evs, err = decodeJSON(fd)
+		} else {
+			evs, err = decodeYAML(fd)
+		}
+		if err != nil {
+			// the file might still be being written, it is read again on the next poll
+			return err
+		}
+		f.offsets[fn] = 0
+		for _, ev := range evs {
+			err = f.send(ctx, ev, r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatJSONL:
+		fi, err := fd.Stat()
+		if err != nil {
+			return err
+		}
+		if fi.Size() < offset {
+			f.logger.Infof("file %q truncated, reading from the start", fn)
+			offset = 0
+		}
+		if fi.Size() == offset {
+			f.offsets[fn] = offset
+			return nil
+		}
+		_, err = fd.Seek(offset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		br := bufio.NewReader(fd)
+		for {
+			line, err := br.ReadBytes('\n')
+			if err == io.EOF {
+				// when tailing, a partial line might still be completed by the writer
+				if f.cfg.Tail || len(bytes.TrimSpace(line)) == 0 {
+					f.offsets[fn] = offset
+					return nil
+				}
+				f.offsets[fn] = offset + int64(len(line))
+				return f.send(ctx, bytes.TrimSpace(line), r)
+			}
+			if err != nil {
+				f.offsets[fn] = offset
+				return err
+			}
+			offset += int64(len(line))
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			err = f.send(ctx, line, r)
+			if err != nil {
+				f.offsets[fn] = offset
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func (f *FileTrigger) send(ctx context.Context, ev []byte, r *replayer) error {
+	if f.cfg.TimestampField != "" && r.speed > 0 {
+		ts, err := f.eventTime(ev)
+		if err != nil {
+			f.logger.Warnf("failed to get event timestamp: %v", err)
+		} else {
+			err = r.wait(ctx, ts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if f.cfg.Debug {
+		f.logger.Debugf("read event: %s", string(ev))
+	}
+	return f.Feed(ctx, &triggers.Event{Data: ev})
+}
+
+// Close //
+func (f *FileTrigger) Close() error {
+	f.cfn()
+	f.Pipeline.Close()
+	return nil
+}
+
+// SetLogger //
+func (f *FileTrigger) WithLogger(logger *log.Logger) {
+	if f.logger == nil {
+		f.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+// Validate //
+func (f *FileTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, f.cfg)
+	if err != nil {
+		return err
+	}
+	return f.setDefaults()
+}
+
+// helper functions
+
+func (f *FileTrigger) setDefaults() error {
+	if f.cfg.Path == "" {
+		return errors.New("missing path")
+	}
+	f.cfg.Format = strings.ToLower(f.cfg.Format)
+	switch f.cfg.Format {
+	case "", formatJSON, formatJSONL, formatYAML:
+	case "ndjson":
+		f.cfg.Format = formatJSONL
+	case "yml":
+		f.cfg.Format = formatYAML
+	default:
+		return fmt.Errorf("unknown format %q", f.cfg.Format)
+	}
+	if f.cfg.PollInterval <= 0 {
+		f.cfg.PollInterval = defaultPollInterval
+	}
+	if f.cfg.TimestampFormat == "" {
+		f.cfg.TimestampFormat = defaultTimestampFormat
+	}
+	if f.cfg.ReplaySpeed < 0 {
+		f.cfg.ReplaySpeed = 0
+	}
+	return nil
+}
+
+func (f *FileTrigger) eventTime(ev []byte) (time.Time, error) {
+	var v interface{}
+	err := json.Unmarshal(ev, &v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, k := range strings.Split(f.cfg.TimestampField, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return time.Time{}, fmt.Errorf("field %q not found", f.cfg.TimestampField)
+		}
+		if v, ok = m[k]; !ok {
+			return time.Time{}, fmt.Errorf("field %q not found", f.cfg.TimestampField)
+		}
+	}
+	return parseTime(v, f.cfg.TimestampFormat)
+}
+
+func parseTime(v interface{}, format string) (time.Time, error) {
+	var n float64
+	switch v := v.(type) {
+	case float64:
+		n = v
+	case string:
+		switch format {
+		case "unix", "unix-ms", "unix-us", "unix-ns":
+			var err error
+			n, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+		default:
+			return time.Parse(format, v)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unexpected timestamp type %T", v)
+	}
+	switch format {
+	case "unix":
+		return time.Unix(0, int64(n*float64(time.Second))), nil
+	case "unix-ms":
+		return time.Unix(0, int64(n*float64(time.Millisecond))), nil
+	case "unix-us":
+		return time.Unix(0, int64(n*float64(time.Microsecond))), nil
+	case "unix-ns":
+		return time.Unix(0, int64(n)), nil
+	}
+	return time.Time{}, fmt.Errorf("numeric timestamp with time layout %q", format)
+}
+
+func formatFromExt(fn string) string {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		return formatJSON
+	case ".jsonl", ".ndjson":
+		return formatJSONL
+	case ".yaml", ".yml":
+		return formatYAML
+	}
+	return ""
+}
+
+// decodeJSON returns the JSON values found in r,
+// top level arrays are flattened into individual events.
+func decodeJSON(r io.Reader) ([][]byte, error) {
+	evs := make([][]byte, 0)
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return evs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > 0 && raw[0] == '[' {
+			var items []json.RawMessage
+			err = json.Unmarshal(raw, &items)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				evs = append(evs, item)
+			}
+			continue
+		}
+		evs = append(evs, raw)
+	}
+}
+
+// decodeYAML returns the YAML documents found in r as JSON,
+// top level lists are flattened into individual events.
+func decodeYAML(r io.Reader) ([][]byte, error) {
+	evs := make([][]byte, 0)
+	dec := yaml.NewDecoder(r)
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return evs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+		items, ok := doc.([]interface{})
+		if !ok {
+			items = []interface{}{doc}
+		}
+		for _, item := range items {
+			b, err := json.Marshal(convert(item))
+			if err != nil {
+				return nil, err
+			}
+			evs = append(evs, b)
+		}
+	}
+}
+
+// convert turns the map[interface{}]interface{} produced
+// by the YAML decoder into JSON friendly maps.
+func convert(i interface{}) interface{} {
+	switch x := i.(type) {
+	case map[interface{}]interface{}:
+		nm := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			nm[fmt.Sprint(k)] = convert(v)
+		}
+		return nm
+	case []interface{}:
+		for i, v := range x {
+			x[i] = convert(v)
+		}
+	}
+	return i
+}
+
+// replayer paces events according to the delta between their timestamps.
+type replayer struct {
+	speed float64
+	last  time.Time
+}
+
+func (r *replayer) wait(ctx context.Context, ts time.Time) error {
+	defer func() { r.last = ts }()
+	if r.last.IsZero() || !ts.After(r.last) {
+		return nil
+	}
+	d := time.Duration(float64(ts.Sub(r.last)) / r.speed)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
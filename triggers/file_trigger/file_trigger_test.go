@@ -0,0 +1,194 @@
+package file_trigger
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+	log "github.com/sirupsen/logrus"
+)
+
+type recordAction struct {
+	events chan string
+}
+
+func (a *recordAction) Init(string, interface{}, ...actions.Option) error { return nil }
+func (a *recordAction) Name() string                                      { return "record" }
+func (a *recordAction) Do(_ context.Context, in interface{}, _ map[string]interface{}) (interface{}, error) {
+	a.events <- string(in.([]byte))
+	return in, nil
+}
+func (a *recordAction) WithLogger(*log.Logger)                         {}
+func (a *recordAction) WithProcessors(map[string]processors.Processor) {}
+func (a *recordAction) WithOutputs(map[string]outputs.Output)          {}
+
+// startTrigger starts a tailing trigger on path and returns the channel receiving its events.
+func startTrigger(t *testing.T, path string) <-chan string {
+	t.Helper()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	a := &recordAction{events: make(chan string, 10)}
+	f := &FileTrigger{cfg: new(cfg), offsets: make(map[string]int64)}
+	err := f.Start(context.Background(),
+		map[string]interface{}{
+			"path":          path,
+			"tail":          true,
+			"poll-interval": "20ms",
+			"actions":       []string{"record"},
+		},
+		triggers.WithLogger(logger),
+		triggers.WithActions(map[string]actions.Action{"record": a}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return a.events
+}
+
+func expectEvents(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Errorf("got event %s, want %s", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for event %s", w)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("unexpected event %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTailHalfWrittenJSON(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "events.json")
+	err := os.WriteFile(fn, []byte(`[{"a":1},{"a"`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := startTrigger(t, dir)
+	expectEvents(t, events)
+	// completed by the writer after the first poll
+	err = os.WriteFile(fn, []byte(`[{"a":1},{"a":2}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, `{"a":1}`, `{"a":2}`)
+}
+
+func TestTailJSONL(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "events.jsonl")
+	err := os.WriteFile(fn, []byte("{\"a\":1}\n{\"a\":"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := startTrigger(t, dir)
+	expectEvents(t, events, `{"a":1}`)
+	fd, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	_, err = fd.WriteString("2}\n\n{\"a\":3}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, events, `{"a":2}`, `{"a":3}`)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{name: "json object", format: formatJSON, in: `{"a":1}`, want: []string{`{"a":1}`}},
+		{name: "json array", format: formatJSON, in: `[{"a":1}, {"a":2}]`, want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "json stream", format: formatJSON, in: "{\"a\":1}\n{\"a\":2}", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "json truncated", format: formatJSON, in: `[{"a":1},{"a"`, wantErr: true},
+		{name: "yaml document", format: formatYAML, in: "a: 1\nb: [x]\n", want: []string{`{"a":1,"b":["x"]}`}},
+		{name: "yaml list", format: formatYAML, in: "- a: 1\n- a: 2\n", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "yaml documents", format: formatYAML, in: "a: 1\n---\n---\na: 2\n", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "yaml invalid", format: formatYAML, in: "a: [1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evs [][]byte
+			var err error
+			if tt.format == formatJSON {
+				evs, err = decodeJSON(strings.NewReader(tt.in))
+			} else {
+				evs, err = decodeYAML(strings.NewReader(tt.in))
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", evs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(evs))
+			for _, ev := range evs {
+				got = append(got, string(ev))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2022, 3, 1, 10, 0, 0, 500000000, time.UTC)
+	tests := []struct {
+		name    string
+		v       interface{}
+		format  string
+		wantErr bool
+	}{
+		{name: "rfc3339", v: "2022-03-01T10:00:00.5Z", format: time.RFC3339Nano},
+		{name: "unix", v: float64(want.UnixNano()) / 1e9, format: "unix"},
+		{name: "unix-ms string", v: "1646128800500", format: "unix-ms"},
+		{name: "unix-us", v: float64(want.UnixNano() / 1e3), format: "unix-us"},
+		{name: "unix-ns", v: float64(want.UnixNano()), format: "unix-ns"},
+		{name: "number with layout", v: float64(1), format: time.RFC3339, wantErr: true},
+		{name: "bad type", v: true, format: "unix", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.v, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := got.Sub(want); d < -time.Microsecond || d > time.Microsecond {
+				t.Errorf("got %s, want %s", got.UTC(), want)
+			}
+		})
+	}
+}
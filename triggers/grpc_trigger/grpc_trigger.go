@@ -0,0 +1,272 @@
+package grpc_trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/karimra/ouroboros/api/ingestpb"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	triggerName    = "grpc"
+	loggingPrefix  = "grpc_trigger"
+	defaultAddress = ":57500"
+)
+
+func init() {
+	triggers.Register(triggerName, func() triggers.Trigger {
+		return &GrpcTrigger{
+			cfg: new(cfg),
+		}
+	})
+}
+
+// GrpcTrigger serves the ingestpb.Ingest service,
+// each received event is sent through the pipeline.
+type GrpcTrigger struct {
+	ingestpb.UnimplementedIngestServer
+	*triggers.Pipeline
+
+	cfg    *cfg
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+
+	srv *grpc.Server
+}
+
+type cfg struct {
+	// listen address
+	Address string `mapstructure:"address,omitempty" json:"address,omitempty"`
+	// server certificate and key, clients certificates are verified if ca-file is set
+	TLS *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+	// ack events once queued instead of once the pipeline completes
+	AckOnReceipt   bool `mapstructure:"ack-on-receipt,omitempty" json:"ack-on-receipt,omitempty"`
+	MaxRecvMsgSize int  `mapstructure:"max-recv-msg-size,omitempty" json:"max-recv-msg-size,omitempty"`
+	Debug          bool `mapstructure:"debug,omitempty" json:"debug,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
+}
+
+// Start //
+func (g *GrpcTrigger) Start(ctx context.Context, cfg interface{}, opts ...triggers.Option) error {
+	err := utils.DecodeConfig(cfg, g.cfg)
+	if err != nil {
+		return err
+	}
+	g.Pipeline = triggers.NewPipeline(&g.cfg.PipelineConfig)
+	err = g.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	var srvOpts []grpc.ServerOption
+	if g.cfg.MaxRecvMsgSize > 0 {
+		srvOpts = append(srvOpts, grpc.MaxRecvMsgSize(g.cfg.MaxRecvMsgSize))
+	}
+	if g.cfg.TLS != nil {
+		tlsCfg, err := g.cfg.TLS.NewServerTLS()
+		if err != nil {
+			return err
+		}
+		srvOpts = append(srvOpts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	l, err := net.Listen("tcp", g.cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	g.ctx, g.cfn = context.WithCancel(ctx)
+	g.logger.Infof("trigger starting with config: %+v", g.cfg)
+	g.Pipeline.Start(g.ctx, g.logger)
+	g.srv = grpc.NewServer(srvOpts...)
+	ingestpb.RegisterIngestServer(g.srv, g)
+	go func() {
+		err := g.srv.Serve(l)
+		if err != nil {
+			g.logger.Errorf("gRPC server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Ingest //
+func (g *GrpcTrigger) Ingest(ctx context.Context, ev *ingestpb.Event) (*ingestpb.Ack, error) {
+	done, err := g.enqueue(ctx, ev)
+	if err != nil {
+		return nil, err
+	}
+	if done == nil {
+		return &ingestpb.Ack{Id: ev.GetId(), Ok: true}, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case ack := <-done:
+		return ack, nil
+	}
+}
+
+// IngestStream //
+func (g *GrpcTrigger) IngestStream(stream ingestpb.Ingest_IngestStreamServer) error {
+	ctx := stream.Context()
+	rsp := new(ingestpb.StreamAck)
+	pending := make([]chan *ingestpb.Ack, 0)
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rsp.Received++
+		done, err := g.enqueue(ctx, ev)
+		if err != nil {
+			return err
+		}
+		if done == nil {
+			rsp.Succeeded++
+			continue
+		}
+		pending = append(pending, done)
+	}
+	for _, done := range pending {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case ack := <-done:
+			if ack.Ok {
+				rsp.Succeeded++
+				continue
+			}
+			rsp.Failed = append(rsp.Failed, ack)
+		}
+	}
+	return stream.SendAndClose(rsp)
+}
+
+// enqueue decodes ev and feeds it to the pipeline,
+// the returned channel receives the pipeline result, it is nil if the trigger acks on receipt.
+func (g *GrpcTrigger) enqueue(ctx context.Context, ev *ingestpb.Event) (chan *ingestpb.Ack, error) {
+	if g.cfg.Debug {
+		g.logger.Debugf("received event: %v", ev)
+	}
+	m, err := toEvent(ev)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "event %q: %v", ev.GetId(), err)
+	}
+	tev := &triggers.Event{Data: m}
+	var done chan *ingestpb.Ack
+	if !g.cfg.AckOnReceipt {
+		done = make(chan *ingestpb.Ack, 1)
+		start := time.Now()
+		tev.Ack = func(rs interface{}, err error) {
+			if err != nil {
+				g.DeadLetter(g.ctx, m, err, 1, start)
+			}
+			done <- toAck(ev.GetId(), rs, err)
+		}
+	}
+	err = g.Feed(ctx, tev)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Error(codes.Unavailable, "trigger is shutting down")
+	}
+	return done, nil
+}
+
+func toEvent(ev *ingestpb.Event) (map[string]interface{}, error) {
+	m := map[string]interface{}{
+		"id":     ev.GetId(),
+		"source": ev.GetSource(),
+	}
+	if ev.GetTimestamp() != 0 {
+		m["timestamp"] = ev.GetTimestamp()
+	}
+	if len(ev.GetLabels()) > 0 {
+		labels := make(map[string]interface{}, len(ev.GetLabels()))
+		for k, v := range ev.GetLabels() {
+			labels[k] = v
+		}
+		m["labels"] = labels
+	}
+	if len(ev.GetPayload()) > 0 {
+		var payload interface{}
+		err := json.Unmarshal(ev.GetPayload(), &payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %v", err)
+		}
+		m["payload"] = payload
+	}
+	return m, nil
+}
+
+func toAck(id string, rs interface{}, err error) *ingestpb.Ack {
+	ack := &ingestpb.Ack{Id: id, Ok: err == nil}
+	if err != nil {
+		ack.Error = err.Error()
+	} else if rs != nil {
+		ack.Result, err = utils.ToBytes(rs)
+		if err != nil {
+			ack.Ok = false
+			ack.Error = fmt.Sprintf("failed to marshal result: %v", err)
+		}
+	}
+	return ack
+}
+
+// Close //
+func (g *GrpcTrigger) Close() error {
+	g.cfn()
+	if g.srv != nil {
+		g.srv.Stop()
+	}
+	g.Pipeline.Close()
+	return nil
+}
+
+// SetLogger //
+func (g *GrpcTrigger) WithLogger(logger *log.Logger) {
+	if g.logger == nil {
+		g.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+// Validate //
+func (g *GrpcTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, g.cfg)
+	if err != nil {
+		return err
+	}
+	return g.setDefaults()
+}
+
+// helper functions
+
+func (g *GrpcTrigger) setDefaults() error {
+	if g.cfg.Address == "" {
+		g.cfg.Address = defaultAddress
+	}
+	if g.cfg.MaxRecvMsgSize < 0 {
+		return errors.New("max-recv-msg-size must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package mqtt_trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	triggerName           = "mqtt"
+	loggingPrefix         = "mqtt_trigger"
+	defaultAddress        = "tcp://localhost:1883"
+	defaultTopic          = "orbrs/events/in"
+	defaultConnectTimeout = 10 * time.Second
+	mqttConnectWait       = 2 * time.Second
+)
+
+func init() {
+	triggers.Register(triggerName, func() triggers.Trigger {
+		return &MqttTrigger{
+			cfg: new(cfg),
+		}
+	})
+}
+
+// MqttTrigger //
+type MqttTrigger struct {
+	*triggers.Pipeline
+
+	cfg    *cfg
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+
+	client mqtt.Client
+	// set by the client reconnecting handler, accessed atomically
+	reconnecting int32
+}
+
+type cfg struct {
+	// client ID
+	Name     string `mapstructure:"name,omitempty" json:"name,omitempty"`
+	Address  string `mapstructure:"address,omitempty" json:"address,omitempty"`
+	Username string `mapstructure:"username,omitempty" json:"username,omitempty"`
+	Password string `mapstructure:"password,omitempty" json:"password,omitempty"`
+	// topic filters, wildcards allowed
+	Topics []string `mapstructure:"topics,omitempty" json:"topics,omitempty"`
+	QoS    byte     `mapstructure:"qos,omitempty" json:"qos,omitempty"`
+	// keep the subscriptions and queued messages across reconnects,
+	// requires a fixed name.
+	PersistentSession bool `mapstructure:"persistent-session,omitempty" json:"persistent-session,omitempty"`
+	// subscribe using $share/<shared-group>/<topic> to load balance
+	// messages between several orbrs instances.
+	SharedGroup     string           `mapstructure:"shared-group,omitempty" json:"shared-group,omitempty"`
+	TLS             *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+	ConnectTimeout  time.Duration    `mapstructure:"connect-timeout,omitempty" json:"connect-timeout,omitempty"`
+	ConnectTimeWait time.Duration    `mapstructure:"connect-time-wait,omitempty" json:"connect-time-wait,omitempty"`
+	Debug           bool             `mapstructure:"debug,omitempty" json:"debug,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
+}
+
+// Start //
+func (m *MqttTrigger) Start(ctx context.Context, cfg interface{}, opts ...triggers.Option) error {
+	err := utils.DecodeConfig(cfg, m.cfg)
+	if err != nil {
+		return err
+	}
+	m.Pipeline = triggers.NewPipeline(&m.cfg.PipelineConfig)
+	m.TrackConnections()
+	err = m.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	clientOpts, err := m.clientOpts()
+	if err != nil {
+		return err
+	}
+	m.ctx, m.cfn = context.WithCancel(ctx)
+	m.logger.Infof("trigger starting with config: %+v", m.cfg)
+	m.Pipeline.Start(m.ctx, m.logger)
+	m.client = mqtt.NewClient(clientOpts)
+	// the client keeps retrying in the background until it connects
+	m.client.Connect()
+	return nil
+}
+
+func (m *MqttTrigger) clientOpts() (*mqtt.ClientOptions, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(m.cfg.Address).
+		SetClientID(m.cfg.Name).
+		SetCleanSession(!m.cfg.PersistentSession).
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(m.cfg.ConnectTimeWait).
+		SetMaxReconnectInterval(m.cfg.ConnectTimeWait).
+		SetConnectTimeout(m.cfg.ConnectTimeout).
+		SetOnConnectHandler(m.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			m.logger.Errorf("connection to %s lost: %v", m.cfg.Address, err)
+			m.ConnectionDown()
+		}).
+		SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+			atomic.StoreInt32(&m.reconnecting, 1)
+		})
+	if m.cfg.Username != "" {
+		opts.SetUsername(m.cfg.Username)
+		opts.SetPassword(m.cfg.Password)
+	}
+	if m.cfg.TLS != nil {
+		tlsCfg, err := m.cfg.TLS.NewTLS()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsCfg)
+	}
+	return opts, nil
+}
+
+// subscribe is called on every (re)connection,
+// an existing persistent session keeps its subscriptions, subscribing again is harmless.
+func (m *MqttTrigger) subscribe(c mqtt.Client) {
+	m.logger.Infof("connected to %s", m.cfg.Address)
+	if atomic.CompareAndSwapInt32(&m.reconnecting, 1, 0) {
+		m.Reconnected()
+	} else {
+		m.ConnectionUp()
+	}
+	filters := make(map[string]byte, len(m.cfg.Topics))
+	for _, t := range m.cfg.Topics {
+		if m.cfg.SharedGroup != "" {
+			t = fmt.Sprintf("$share/%s/%s", m.cfg.SharedGroup, t)
+		}
+		filters[t] = m.cfg.QoS
+	}
+	token := c.SubscribeMultiple(filters, m.handleMsg)
+	if !token.WaitTimeout(m.cfg.ConnectTimeout) {
+		m.logger.Errorf("timeout subscribing to %v", m.cfg.Topics)
+		return
+	}
+	if err := token.Error(); err != nil {
+		m.logger.Errorf("failed to subscribe to %v: %v", m.cfg.Topics, err)
+		return
+	}
+	m.logger.Infof("subscribed to %v", m.cfg.Topics)
+}
+
+func (m *MqttTrigger) handleMsg(_ mqtt.Client, msg mqtt.Message) {
+	if len(msg.Payload()) == 0 {
+		return
+	}
+	if m.cfg.Debug {
+		m.logger.Debugf("received msg, topic=%s, qos=%d, len=%d, data=%s", msg.Topic(), msg.Qos(), len(msg.Payload()), string(msg.Payload()))
+	}
+	err := m.Feed(m.ctx, &triggers.Event{Data: msg.Payload()})
+	if err != nil {
+		m.logger.Errorf("failed to queue msg from %q: %v", msg.Topic(), err)
+	}
+}
+
+// Close //
+func (m *MqttTrigger) Close() error {
+	m.cfn()
+	if m.client != nil {
+		m.client.Disconnect(250)
+	}
+	m.Pipeline.Close()
+	return nil
+}
+
+// SetLogger //
+func (m *MqttTrigger) WithLogger(logger *log.Logger) {
+	if m.logger == nil {
+		m.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+// Validate //
+func (m *MqttTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, m.cfg)
+	if err != nil {
+		return err
+	}
+	return m.setDefaults()
+}
+
+// helper functions
+
+func (m *MqttTrigger) setDefaults() error {
+	if m.cfg.Name == "" {
+		if m.cfg.PersistentSession {
+			return errors.New("persistent-session requires a name")
+		}
+		m.cfg.Name = "orbrs-" + uuid.New().String()
+	}
+	if m.cfg.Address == "" {
+		m.cfg.Address = defaultAddress
+	}
+	if !strings.Contains(m.cfg.Address, "://") {
+		if m.cfg.TLS != nil {
+			m.cfg.Address = "ssl://" + m.cfg.Address
+		} else {
+			m.cfg.Address = "tcp://" + m.cfg.Address
+		}
+	}
+	if len(m.cfg.Topics) == 0 {
+		m.cfg.Topics = []string{defaultTopic}
+	}
+	if m.cfg.QoS > 2 {
+		return fmt.Errorf("invalid qos %d", m.cfg.QoS)
+	}
+	if m.cfg.ConnectTimeout <= 0 {
+		m.cfg.ConnectTimeout = defaultConnectTimeout
+	}
+	if m.cfg.ConnectTimeWait <= 0 {
+		m.cfg.ConnectTimeWait = mqttConnectWait
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package nats_trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karimra/ouroboros/tracing"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	jsModePush           = "push"
+	jsModePull           = "pull"
+	defaultJSMode        = jsModePull
+	defaultJSAckWait     = 30 * time.Second
+	defaultJSNakDelay    = 5 * time.Second
+	defaultJSPullBatch   = 10
+	defaultJSPullMaxWait = 5 * time.Second
+
+	deadLetterSubjectHeader   = "Orbrs-Subject"
+	deadLetterErrorHeader     = "Orbrs-Error"
+	deadLetterDeliveredHeader = "Orbrs-Num-Delivered"
+	deadLetterStreamHeader    = "Orbrs-Stream"
+	deadLetterSequenceHeader  = "Orbrs-Stream-Sequence"
+)
+
+type jsCfg struct {
+	Enabled bool `mapstructure:"enabled,omitempty" json:"enabled,omitempty"`
+	// stream to bind the consumer to, looked up by subject if empty
+	Stream string `mapstructure:"stream,omitempty" json:"stream,omitempty"`
+	// create the stream with the trigger subject if it does not exist
+	CreateStream bool `mapstructure:"create-stream,omitempty" json:"create-stream,omitempty"`
+	// durable consumer name, defaults to the trigger queue
+	Durable string `mapstructure:"durable,omitempty" json:"durable,omitempty"`
+	// push or pull
+	Mode string `mapstructure:"mode,omitempty" json:"mode,omitempty"`
+	// all, new or last
+	DeliverPolicy string        `mapstructure:"deliver-policy,omitempty" json:"deliver-policy,omitempty"`
+	AckWait       time.Duration `mapstructure:"ack-wait,omitempty" json:"ack-wait,omitempty"`
+	MaxDeliver    int           `mapstructure:"max-deliver,omitempty" json:"max-deliver,omitempty"`
+	MaxAckPending int           `mapstructure:"max-ack-pending,omitempty" json:"max-ack-pending,omitempty"`
+	// delay before a message is redelivered after an action failure
+	NakDelay time.Duration `mapstructure:"nak-delay,omitempty" json:"nak-delay,omitempty"`
+	// subject messages are published to after max-deliver failed attempts
+	DeadLetterSubject string        `mapstructure:"dead-letter-subject,omitempty" json:"dead-letter-subject,omitempty"`
+	PullBatch         int           `mapstructure:"pull-batch,omitempty" json:"pull-batch,omitempty"`
+	PullMaxWait       time.Duration `mapstructure:"pull-max-wait,omitempty" json:"pull-max-wait,omitempty"`
+}
+
+func (n *NatsTrigger) setJetStreamDefaults() error {
+	if n.cfg.JetStream == nil {
+		n.cfg.JetStream = new(jsCfg)
+	}
+	if !n.cfg.JetStream.Enabled {
+		return nil
+	}
+	// messages failing an action are redelivered, the outputs only see the successful runs
+	n.cfg.AbortOnFailure = n.cfg.JetStream.Enabled
+	if n.cfg.JetStream.Durable == "" {
+		n.cfg.JetStream.Durable = n.cfg.Queue
+	}
+	if strings.ContainsAny(n.cfg.JetStream.Durable, ".*> ") {
+		return fmt.Errorf("invalid durable name %q", n.cfg.JetStream.Durable)
+	}
+	n.cfg.JetStream.Mode = strings.ToLower(n.cfg.JetStream.Mode)
+	switch n.cfg.JetStream.Mode {
+	case "":
+		n.cfg.JetStream.Mode = defaultJSMode
+	case jsModePush, jsModePull:
+	default:
+		return fmt.Errorf("unknown JetStream mode %q", n.cfg.JetStream.Mode)
+	}
+	switch n.cfg.JetStream.DeliverPolicy {
+	case "", "all", "new", "last":
+	default:
+		return fmt.Errorf("unknown JetStream deliver policy %q", n.cfg.JetStream.DeliverPolicy)
+	}
+	if n.cfg.JetStream.CreateStream && n.cfg.JetStream.Stream == "" {
+		return errors.New("create-stream requires a stream name")
+	}
+	if n.cfg.JetStream.AckWait <= 0 {
+		n.cfg.JetStream.AckWait = defaultJSAckWait
+	}
+	if n.cfg.JetStream.NakDelay <= 0 {
+		n.cfg.JetStream.NakDelay = defaultJSNakDelay
+	}
+	if n.cfg.JetStream.PullBatch <= 0 {
+		n.cfg.JetStream.PullBatch = defaultJSPullBatch
+	}
+	if n.cfg.JetStream.PullMaxWait <= 0 {
+		n.cfg.JetStream.PullMaxWait = defaultJSPullMaxWait
+	}
+	return nil
+}
+
+// consumeJetStream subscribes to the trigger subject using a durable JetStream consumer.
+// It only returns when ctx is done or the subscription fails,
+// once the messages it fed to the pipeline are settled so nc can be closed.
+func (n *NatsTrigger) consumeJetStream(ctx context.Context, nc *nats.Conn, workerLogPrefix string) error {
+	inflight := new(sync.WaitGroup)
+	defer n.drain(inflight, workerLogPrefix)
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+	err = n.ensureStream(js)
+	if err != nil {
+		return err
+	}
+	// the subscriptions are not unsubscribed on return
+	// since that would delete the durable consumer.
+	switch n.cfg.JetStream.Mode {
+	case jsModePush:
+		msgChan := make(chan *nats.Msg, n.cfg.BufferSize)
+		opts := append(n.subOpts(), nats.Durable(n.cfg.JetStream.Durable))
+		_, err = js.ChanQueueSubscribe(n.cfg.Subject, n.cfg.Queue, msgChan, opts...)
+		if err != nil {
+			return err
+		}
+		n.logger.Infof("%s subscribed to %q using JetStream push consumer %q", workerLogPrefix, n.cfg.Subject, n.cfg.JetStream.Durable)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case m, ok := <-msgChan:
+				if !ok {
+					return errors.New("channel closed")
+				}
+				n.handleJetStreamMsg(ctx, nc, m, inflight)
+			}
+		}
+	default:
+		sub, err := js.PullSubscribe(n.cfg.Subject, n.cfg.JetStream.Durable, n.subOpts()...)
+		if err != nil {
+			return err
+		}
+		n.logger.Infof("%s subscribed to %q using JetStream pull consumer %q", workerLogPrefix, n.cfg.Subject, n.cfg.JetStream.Durable)
+		for {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			msgs, err := sub.Fetch(n.cfg.JetStream.PullBatch, nats.MaxWait(n.cfg.JetStream.PullMaxWait))
+			if err != nil {
+				if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+					continue
+				}
+				return err
+			}
+			for _, m := range msgs {
+				n.handleJetStreamMsg(ctx, nc, m, inflight)
+			}
+		}
+	}
+}
+
+// drain waits for the pipeline to settle the messages in inflight, at most ack-wait
+// after which the server redelivers them anyway.
+func (n *NatsTrigger) drain(inflight *sync.WaitGroup, workerLogPrefix string) {
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(n.cfg.JetStream.AckWait):
+		n.logger.Warnf("%s timed out waiting for the pipeline to settle its messages, they will be redelivered", workerLogPrefix)
+	}
+}
+
+func (n *NatsTrigger) ensureStream(js nats.JetStreamContext) error {
+	if !n.cfg.JetStream.CreateStream {
+		return nil
+	}
+	_, err := js.StreamInfo(n.cfg.JetStream.Stream)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+	n.logger.Infof("creating stream %q with subject %q", n.cfg.JetStream.Stream, n.cfg.Subject)
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     n.cfg.JetStream.Stream,
+		Subjects: []string{n.cfg.Subject},
+	})
+	return err
+}
+
+func (n *NatsTrigger) subOpts() []nats.SubOpt {
+	opts := []nats.SubOpt{
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.AckWait(n.cfg.JetStream.AckWait),
+	}
+	if n.cfg.JetStream.Stream != "" {
+		opts = append(opts, nats.BindStream(n.cfg.JetStream.Stream))
+	}
+	if n.cfg.JetStream.MaxDeliver > 0 {
+		opts = append(opts, nats.MaxDeliver(n.cfg.JetStream.MaxDeliver))
+	}
+	if n.cfg.JetStream.MaxAckPending > 0 {
+		opts = append(opts, nats.MaxAckPending(n.cfg.JetStream.MaxAckPending))
+	}
+	switch n.cfg.JetStream.DeliverPolicy {
+	case "new":
+		opts = append(opts, nats.DeliverNew())
+	case "last":
+		opts = append(opts, nats.DeliverLast())
+	default:
+		opts = append(opts, nats.DeliverAll())
+	}
+	return opts
+}
+
+// handleJetStreamMsg feeds the message to the pipeline, it is acknowledged once the pipeline completes.
+// inflight tracks the fed messages until they are settled.
+func (n *NatsTrigger) handleJetStreamMsg(ctx context.Context, nc *nats.Conn, m *nats.Msg, inflight *sync.WaitGroup) {
+	if len(m.Data) == 0 {
+		n.ack(m)
+		return
+	}
+	if n.cfg.Debug {
+		n.logger.Debugf("received JetStream msg, subject=%s, len=%d, data=%s", m.Subject, len(m.Data), string(m.Data))
+	}
+	inflight.Add(1)
+	err := n.Feed(ctx, &triggers.Event{
+		Data:   m.Data,
+		Parent: tracing.Extract(m.Header),
+		Ack: func(_ interface{}, err error) {
+			defer inflight.Done()
+			n.settleJetStreamMsg(ctx, nc, m, err)
+		},
+	})
+	if err != nil {
+		inflight.Done()
+	}
+}
+
+// settleJetStreamMsg acknowledges the message given the pipeline error.
+// Messages failing a processor are dead-lettered right away,
+// messages failing an action are redelivered after nak-delay until max-deliver is reached.
+func (n *NatsTrigger) settleJetStreamMsg(ctx context.Context, nc *nats.Conn, m *nats.Msg, err error) {
+	if err == nil {
+		n.ack(m)
+		return
+	}
+	if ctx.Err() != nil {
+		// shutting down, let the server redeliver it
+		return
+	}
+	var numDelivered uint64
+	if meta, merr := m.Metadata(); merr == nil {
+		numDelivered = meta.NumDelivered
+	}
+	if triggers.IsProcessorError(err) ||
+		(n.cfg.JetStream.MaxDeliver > 0 && numDelivered >= uint64(n.cfg.JetStream.MaxDeliver)) {
+		n.deadLetter(ctx, nc, m, err)
+		if terr := m.Term(); terr != nil {
+			n.logger.Errorf("failed to terminate msg: %v", terr)
+		}
+		return
+	}
+	n.logger.Infof("msg delivery %d failed, redelivering in %s", numDelivered, n.cfg.JetStream.NakDelay)
+	if nerr := m.NakWithDelay(n.cfg.JetStream.NakDelay); nerr != nil {
+		n.logger.Errorf("failed to nak msg: %v", nerr)
+	}
+}
+
+func (n *NatsTrigger) ack(m *nats.Msg) {
+	if err := m.Ack(); err != nil {
+		n.logger.Errorf("failed to ack msg: %v", err)
+	}
+}
+
+// deadLetter publishes the failed message to the dead-letter subject, if configured,
+// with the failure details in its headers, and writes it to the dead-letter output.
+func (n *NatsTrigger) deadLetter(ctx context.Context, nc *nats.Conn, m *nats.Msg, err error) {
+	attempts, first := 1, time.Now()
+	if meta, merr := m.Metadata(); merr == nil {
+		attempts, first = int(meta.NumDelivered), meta.Timestamp
+	}
+	n.DeadLetter(ctx, m.Data, err, attempts, first)
+	if n.cfg.JetStream.DeadLetterSubject == "" {
+		n.logger.Errorf("dropping msg from subject %q: %v", m.Subject, err)
+		return
+	}
+	dm := nats.NewMsg(n.cfg.JetStream.DeadLetterSubject)
+	dm.Data = m.Data
+	dm.Header.Set(deadLetterSubjectHeader, m.Subject)
+	dm.Header.Set(deadLetterErrorHeader, err.Error())
+	if meta, merr := m.Metadata(); merr == nil {
+		dm.Header.Set(deadLetterDeliveredHeader, strconv.FormatUint(meta.NumDelivered, 10))
+		dm.Header.Set(deadLetterStreamHeader, meta.Stream)
+		dm.Header.Set(deadLetterSequenceHeader, strconv.FormatUint(meta.Sequence.Stream, 10))
+	}
+	if perr := nc.PublishMsg(dm); perr != nil {
+		n.logger.Errorf("failed to publish msg to dead-letter subject %q: %v", n.cfg.JetStream.DeadLetterSubject, perr)
+		return
+	}
+	n.logger.Infof("msg from subject %q sent to dead-letter subject %q: %v", m.Subject, n.cfg.JetStream.DeadLetterSubject, err)
+}
@@ -0,0 +1,273 @@
+package nats_trigger
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	testStream  = "EVENTS"
+	testSubject = "orbrs.test.events"
+	testDurable = "orbrs-test"
+)
+
+type fakeAction struct {
+	do func(context.Context, interface{}) (interface{}, error)
+}
+
+func (a *fakeAction) Init(string, interface{}, ...actions.Option) error { return nil }
+func (a *fakeAction) Name() string                                      { return "fake" }
+func (a *fakeAction) Do(ctx context.Context, in interface{}, _ map[string]interface{}) (interface{}, error) {
+	return a.do(ctx, in)
+}
+func (a *fakeAction) WithLogger(*log.Logger)                         {}
+func (a *fakeAction) WithProcessors(map[string]processors.Processor) {}
+func (a *fakeAction) WithOutputs(map[string]outputs.Output)          {}
+
+// runServer starts an embedded JetStream enabled server and returns its address.
+func runServer(t *testing.T) string {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s.Addr().String()
+}
+
+func connect(t *testing.T, addr string) nats.JetStreamContext {
+	t.Helper()
+	nc, err := nats.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+// startTrigger starts a trigger on testSubject running a single action, extra is merged into its config.
+func startTrigger(t *testing.T, addr string, extra map[string]interface{}, a *fakeAction) *NatsTrigger {
+	t.Helper()
+	c := map[string]interface{}{
+		"address": addr,
+		"subject": testSubject,
+		"actions": []string{"fake"},
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	n := &NatsTrigger{cfg: new(cfg), wg: new(sync.WaitGroup)}
+	err := n.Start(context.Background(), c,
+		triggers.WithLogger(logger),
+		triggers.WithActions(map[string]actions.Action{"fake": a}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// jetStreamConfig returns the config of a pull consumer on testStream, js is merged into it.
+func jetStreamConfig(js map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"enabled":       true,
+		"stream":        testStream,
+		"create-stream": true,
+		"durable":       testDurable,
+		"pull-max-wait": "100ms",
+	}
+	for k, v := range js {
+		c[k] = v
+	}
+	return map[string]interface{}{"jetstream": c}
+}
+
+func publish(t *testing.T, js nats.JetStreamContext, data string) {
+	t.Helper()
+	// the stream is created by the trigger
+	var err error
+	for i := 0; i < 50; i++ {
+		_, err = js.Publish(testSubject, []byte(data))
+		if err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal(err)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func consumerInfo(t *testing.T, js nats.JetStreamContext) *nats.ConsumerInfo {
+	t.Helper()
+	ci, err := js.ConsumerInfo(testStream, testDurable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ci
+}
+
+func TestJetStreamAckAfterPipeline(t *testing.T) {
+	addr := runServer(t)
+	js := connect(t, addr)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	n := startTrigger(t, addr, jetStreamConfig(nil), &fakeAction{do: func(_ context.Context, in interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return in, nil
+	}})
+	publish(t, js, `{"a":1}`)
+	<-started
+	if ci := consumerInfo(t, js); ci.NumAckPending != 1 {
+		t.Errorf("got %d pending acks while the action runs, want 1", ci.NumAckPending)
+	}
+	// closing the trigger waits for the message to be settled
+	closed := make(chan struct{})
+	go func() {
+		n.Close()
+		close(closed)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	<-closed
+	waitFor(t, "the message to be acknowledged", func() bool {
+		ci := consumerInfo(t, js)
+		return ci.AckFloor.Stream == 1 && ci.NumAckPending == 0
+	})
+}
+
+func TestJetStreamNakOnFailure(t *testing.T) {
+	addr := runServer(t)
+	js := connect(t, addr)
+	m := new(sync.Mutex)
+	calls := 0
+	n := startTrigger(t, addr, jetStreamConfig(map[string]interface{}{"nak-delay": "100ms"}), &fakeAction{do: func(_ context.Context, in interface{}) (interface{}, error) {
+		m.Lock()
+		defer m.Unlock()
+		calls++
+		if calls == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return in, nil
+	}})
+	defer n.Close()
+	publish(t, js, `{"a":1}`)
+	waitFor(t, "the message to be redelivered and acknowledged", func() bool {
+		ci := consumerInfo(t, js)
+		return ci.AckFloor.Stream == 1 && ci.NumAckPending == 0
+	})
+	m.Lock()
+	defer m.Unlock()
+	if calls != 2 {
+		t.Errorf("action called %d times, want 2", calls)
+	}
+}
+
+func TestJetStreamDeadLetter(t *testing.T) {
+	addr := runServer(t)
+	js := connect(t, addr)
+	nc, err := nats.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	dl, err := nc.SubscribeSync("orbrs.test.dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := startTrigger(t, addr, jetStreamConfig(map[string]interface{}{
+		"nak-delay":           "100ms",
+		"max-deliver":         2,
+		"dead-letter-subject": "orbrs.test.dead",
+	}), &fakeAction{do: func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.New("unavailable")
+	}})
+	defer n.Close()
+	publish(t, js, `{"a":1}`)
+	dm, err := dl.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dm.Data) != `{"a":1}` {
+		t.Errorf("got dead-letter data %s", dm.Data)
+	}
+	if got := dm.Header.Get(deadLetterDeliveredHeader); got != "2" {
+		t.Errorf("got %s header %q, want 2", deadLetterDeliveredHeader, got)
+	}
+	if got := dm.Header.Get(deadLetterErrorHeader); !strings.HasSuffix(got, "unavailable") {
+		t.Errorf("got %s header %q, want the action error", deadLetterErrorHeader, got)
+	}
+}
+
+func TestJetStreamDurableResume(t *testing.T) {
+	addr := runServer(t)
+	js := connect(t, addr)
+	received := make(chan string, 10)
+	a := &fakeAction{do: func(_ context.Context, in interface{}) (interface{}, error) {
+		received <- string(in.([]byte))
+		return in, nil
+	}}
+	n := startTrigger(t, addr, jetStreamConfig(nil), a)
+	publish(t, js, `{"seq":1}`)
+	if got := <-received; got != `{"seq":1}` {
+		t.Fatalf("got %s, want seq 1", got)
+	}
+	n.Close()
+	// published while no trigger is running
+	publish(t, js, `{"seq":2}`)
+	n = startTrigger(t, addr, jetStreamConfig(nil), a)
+	defer n.Close()
+	select {
+	case got := <-received:
+		if got != `{"seq":2}` {
+			t.Fatalf("got %s after restart, want seq 2", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message published while stopped")
+	}
+	select {
+	case got := <-received:
+		t.Errorf("unexpected redelivery of %s", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
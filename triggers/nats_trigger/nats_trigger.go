@@ -2,15 +2,14 @@ package nats_trigger
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/karimra/ouroboros/actions"
-	"github.com/karimra/ouroboros/outputs"
-	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
 	"github.com/karimra/ouroboros/triggers"
 	"github.com/karimra/ouroboros/utils"
 	"github.com/nats-io/nats.go"
@@ -24,8 +23,7 @@ const (
 	defaultAddress          = "localhost:4222"
 	natsConnectWait         = 2 * time.Second
 	defaultSubject          = "orbrs.events.in"
-	defaultNumWorkers       = 1
-	defaultBufferSize       = 100
+	defaultReplyTimeout     = 10 * time.Second
 )
 
 func init() {
@@ -39,15 +37,14 @@ func init() {
 
 // NatsTrigger //
 type NatsTrigger struct {
+	*triggers.Pipeline
+
 	cfg    *cfg
 	ctx    context.Context
 	cfn    context.CancelFunc
 	logger *log.Entry
 
-	wg      *sync.WaitGroup
-	procs   []processors.Processor
-	actions []actions.Action
-	outputs []outputs.Output
+	wg *sync.WaitGroup
 }
 
 type cfg struct {
@@ -59,11 +56,13 @@ type cfg struct {
 	Password        string        `mapstructure:"password,omitempty" json:"password,omitempty"`
 	ConnectTimeWait time.Duration `mapstructure:"connect-time-wait,omitempty" json:"connect-time-wait,omitempty"`
 	Debug           bool          `mapstructure:"debug,omitempty" json:"debug,omitempty"`
-	NumWorkers      int           `mapstructure:"num-workers,omitempty" json:"num-workers,omitempty"`
-	BufferSize      int           `mapstructure:"buffer-size,omitempty" json:"buffer-size,omitempty"`
-	Processors      []string      `mapstructure:"processors,omitempty" json:"processors,omitempty"`
-	Actions         []string      `mapstructure:"actions,omitempty" json:"actions,omitempty"`
-	Outputs         []string      `mapstructure:"outputs,omitempty" json:"outputs,omitempty"`
+	JetStream       *jsCfg        `mapstructure:"jetstream,omitempty" json:"jetstream,omitempty"`
+	// respond to messages carrying a reply subject with the pipeline result,
+	// or its error if a processor fails or an action fails with abort-on-failure set
+	Reply        bool          `mapstructure:"reply,omitempty" json:"reply,omitempty"`
+	ReplyTimeout time.Duration `mapstructure:"reply-timeout,omitempty" json:"reply-timeout,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
 }
 
 // Start //
@@ -72,6 +71,8 @@ func (n *NatsTrigger) Start(ctx context.Context, cfg interface{}, opts ...trigge
 	if err != nil {
 		return err
 	}
+	n.Pipeline = triggers.NewPipeline(&n.cfg.PipelineConfig)
+	n.TrackConnections()
 	err = n.setDefaults()
 	if err != nil {
 		return err
@@ -81,16 +82,19 @@ func (n *NatsTrigger) Start(ctx context.Context, cfg interface{}, opts ...trigge
 	}
 
 	n.ctx, n.cfn = context.WithCancel(ctx)
-	// start outputs
 	n.logger.Infof("trigger starting with config: %+v", n.cfg)
+	// the pipeline outlives the workers on Close so the JetStream messages
+	// it holds are acknowledged before their connection is closed.
+	n.Pipeline.Start(ctx, n.logger)
 	n.wg.Add(n.cfg.NumWorkers)
 	for i := 0; i < n.cfg.NumWorkers; i++ {
-		go n.worker(ctx, i)
+		go n.worker(n.ctx, i)
 	}
 	return nil
 }
 
 func (n *NatsTrigger) worker(ctx context.Context, idx int) {
+	defer n.wg.Done()
 	var nc *nats.Conn
 	var err error
 	var msgChan chan *nats.Msg
@@ -101,11 +105,24 @@ func (n *NatsTrigger) worker(ctx context.Context, idx int) {
 START:
 	nc, err = n.createNATSConn(&wcfg)
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		n.logger.Errorf("%s failed to create NATS connection: %v", workerLogPrefix, err)
 		time.Sleep(n.cfg.ConnectTimeWait)
 		goto START
 	}
 	defer nc.Close()
+	if n.cfg.JetStream.Enabled {
+		err = n.consumeJetStream(ctx, nc, workerLogPrefix)
+		if err != nil && ctx.Err() == nil {
+			n.logger.Errorf("%s JetStream consumer failed: %v", workerLogPrefix, err)
+			time.Sleep(n.cfg.ConnectTimeWait)
+			nc.Close()
+			goto START
+		}
+		return
+	}
 	msgChan = make(chan *nats.Msg, n.cfg.BufferSize)
 	sub, err := nc.ChanQueueSubscribe(n.cfg.Subject, n.cfg.Queue, msgChan)
 	if err != nil {
@@ -116,7 +133,6 @@ START:
 	}
 	defer close(msgChan)
 	defer sub.Unsubscribe()
-OUTER:
 	for {
 		select {
 		case <-ctx.Done():
@@ -135,48 +151,70 @@ OUTER:
 			if n.cfg.Debug {
 				n.logger.Debugf("received msg, subject=%s, queue=%s, len=%d, data=%s", m.Subject, m.Sub.Queue, len(m.Data), string(m.Data))
 			}
-
-			var data interface{}
-			data = m.Data
-			for _, p := range n.procs {
-				data, err = p.Apply(data)
-				if err != nil {
-					n.logger.Errorf("failed to apply processor: %v", err)
-					continue OUTER
-				}
+			if n.cfg.Reply && m.Reply != "" {
+				n.feedAndRespond(ctx, m)
+				continue
 			}
-
-			var rs interface{}
-			var err error
-			env := make(map[string]interface{})
-			rs = data
-			for _, a := range n.actions {
-				n.logger.Infof("applying action: %+v", a)
-				rs, err = a.Do(ctx, rs, env)
-				if err != nil {
-					n.logger.Printf("action failed: %v", err)
-				}
-				env[a.Name()] = rs
-				n.logger.Infof("applied action %q: result: %v", a.Name(), rs)
-				n.logger.Infof("action %q new trigger env: %+v", a.Name(), env)
+			err = n.Feed(ctx, &triggers.Event{Data: m.Data, Parent: tracing.Extract(m.Header)})
+			if err != nil {
+				return
 			}
-			for _, o := range n.outputs {
-				n.logger.Infof("sending result to output: %v", o)
-				err = o.Write(ctx, rs)
-				if err != nil {
-					n.logger.Errorf("failed to marshal actions result: %v", err)
-					// TODO:
-					continue
-				}
+		}
+	}
+}
+
+// feedAndRespond feeds the message to the pipeline with a reply-timeout deadline counted from its arrival,
+// then responds with the final result or with the error that interrupted the pipeline.
+func (n *NatsTrigger) feedAndRespond(ctx context.Context, m *nats.Msg) {
+	start := time.Now()
+	fctx, cancel := context.WithTimeout(ctx, n.cfg.ReplyTimeout)
+	defer cancel()
+	err := n.Feed(fctx, &triggers.Event{
+		Data:    m.Data,
+		Timeout: n.cfg.ReplyTimeout,
+		Parent:  tracing.Extract(m.Header),
+		Ack: func(rs interface{}, err error) {
+			if err != nil {
+				n.DeadLetter(ctx, m.Data, err, 1, start)
 			}
+			n.respond(m, rs, err)
+		},
+	})
+	if err != nil {
+		n.logger.Errorf("failed to queue msg from %q: %v", m.Subject, err)
+		n.respond(m, nil, err)
+	}
+}
+
+// respond replies to m with rs, or with a JSON error object if err is set.
+// A nil result, e.g. an event dropped by a processor, gets an empty reply.
+func (n *NatsTrigger) respond(m *nats.Msg, rs interface{}, err error) {
+	var b []byte
+	switch {
+	case err != nil:
+		b, _ = json.Marshal(&replyError{Error: err.Error()})
+	case rs != nil:
+		b, err = utils.ToBytes(rs)
+		if err != nil {
+			n.logger.Errorf("failed to marshal result: %v", err)
+			b, _ = json.Marshal(&replyError{Error: fmt.Sprintf("failed to marshal result: %v", err)})
 		}
 	}
+	err = m.Respond(b)
+	if err != nil {
+		n.logger.Errorf("failed to respond to %q: %v", m.Reply, err)
+	}
+}
+
+type replyError struct {
+	Error string `json:"error,omitempty"`
 }
 
 // Close //
 func (n *NatsTrigger) Close() error {
 	n.cfn()
 	n.wg.Wait()
+	n.Pipeline.Close()
 	return nil
 }
 
@@ -187,65 +225,6 @@ func (n *NatsTrigger) WithLogger(logger *log.Logger) {
 	}
 }
 
-func (n *NatsTrigger) WithActions(acts, procs, outs map[string]map[string]interface{}, l *log.Logger) {
-	for _, name := range n.cfg.Actions {
-		if aCfg, ok := acts[name]; ok {
-			n.logger.Infof("initializing action %q", name)
-			a, err := actions.CreateAction(aCfg)
-			if err != nil {
-				n.logger.Errorf("failed to initialize action %q: %v", name, err)
-				continue
-			}
-			err = a.Init(name, aCfg,
-				actions.WithLogger(l),
-				actions.WithProcessors(procs),
-				actions.WithOutputs(outs),
-			)
-			if err != nil {
-				n.logger.Errorf("failed to init action %q: %v", a.Name(), err)
-				continue
-			}
-			n.actions = append(n.actions, a)
-			continue
-		}
-		n.logger.Warnf("action %q not found", name)
-	}
-}
-
-func (n *NatsTrigger) WithProcessors(procs map[string]map[string]interface{}, l *log.Logger) {
-	for _, name := range n.cfg.Processors {
-		if pCfg, ok := procs[name]; ok {
-			n.logger.Infof("initializing processor %q", name)
-			p, err := processors.CreateProcessor(pCfg)
-			if err != nil {
-				n.logger.Errorf("failed to initialize processor %q: %v", name, err)
-				continue
-			}
-			p.Init(pCfg, processors.WithLogger(l))
-			n.procs = append(n.procs, p)
-			continue
-		}
-		n.logger.Warnf("processor %q not found", name)
-	}
-}
-
-func (n *NatsTrigger) WithOutputs(ctx context.Context, outs map[string]map[string]interface{}, procs map[string]map[string]interface{}, l *log.Logger) {
-	for _, name := range n.cfg.Outputs {
-		if pCfg, ok := outs[name]; ok {
-			n.logger.Infof("initializing output %q", name)
-			p, err := outputs.CreateOutput(pCfg)
-			if err != nil {
-				n.logger.Errorf("failed to initialize output %q: %v", name, err)
-				continue
-			}
-			p.Init(ctx, pCfg, outputs.WithLogger(l), outputs.WithProcessors(procs, l))
-			n.outputs = append(n.outputs, p)
-			continue
-		}
-		n.logger.Warnf("output %q not found", name)
-	}
-}
-
 // func (n *NatsTrigger) SetName(name string) {
 // 	sb := strings.Builder{}
 // 	if name != "" {
@@ -257,6 +236,15 @@ func (n *NatsTrigger) WithOutputs(ctx context.Context, outs map[string]map[strin
 // 	n.Cfg.Name = sb.String()
 // }
 
+// Validate //
+func (n *NatsTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, n.cfg)
+	if err != nil {
+		return err
+	}
+	return n.setDefaults()
+}
+
 // helper functions
 
 func (n *NatsTrigger) setDefaults() error {
@@ -275,13 +263,10 @@ func (n *NatsTrigger) setDefaults() error {
 	if n.cfg.Queue == "" {
 		n.cfg.Queue = n.cfg.Name
 	}
-	if n.cfg.NumWorkers <= 0 {
-		n.cfg.NumWorkers = defaultNumWorkers
+	if n.cfg.ReplyTimeout <= 0 {
+		n.cfg.ReplyTimeout = defaultReplyTimeout
 	}
-	if n.cfg.BufferSize <= 0 {
-		n.cfg.BufferSize = defaultBufferSize
-	}
-	return nil
+	return n.setJetStreamDefaults()
 }
 
 func (n *NatsTrigger) createNATSConn(c *cfg) (*nats.Conn, error) {
@@ -295,6 +280,11 @@ func (n *NatsTrigger) createNATSConn(c *cfg) (*nats.Conn, error) {
 		}),
 		nats.DisconnectHandler(func(c *nats.Conn) {
 			n.logger.Println("Disconnected from NATS")
+			n.ConnectionDown()
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			n.logger.Println("Reconnected to NATS")
+			n.Reconnected()
 		}),
 		nats.ClosedHandler(func(c *nats.Conn) {
 			n.logger.Println("NATS connection is closed")
@@ -307,6 +297,7 @@ func (n *NatsTrigger) createNATSConn(c *cfg) (*nats.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	n.ConnectionUp()
 	return nc, nil
 }
 
@@ -0,0 +1,82 @@
+package nats_trigger
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestReply(t *testing.T) {
+	addr := runServer(t)
+	nc, err := nats.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	n := startTrigger(t, addr, map[string]interface{}{"reply": true, "abort-on-failure": true}, &fakeAction{do: func(_ context.Context, in interface{}) (interface{}, error) {
+		switch string(in.([]byte)) {
+		case "fail":
+			return nil, errors.New("boom")
+		case "drop":
+			return nil, nil
+		}
+		return map[string]interface{}{"ok": true}, nil
+	}})
+	defer n.Close()
+	tests := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{name: "result", req: "ok", want: `{"ok":true}`},
+		{name: "action error", req: "fail", want: `{"error":"action \"fake\" failed: boom"}`},
+		{name: "no result", req: "drop", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rsp *nats.Msg
+			waitFor(t, "a reply", func() bool {
+				// the trigger subscribes asynchronously
+				rsp, err = nc.Request(testSubject, []byte(tt.req), time.Second)
+				return err == nil
+			})
+			if string(rsp.Data) != tt.want {
+				t.Errorf("got reply %q, want %q", rsp.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyTimeoutIncludesQueueing(t *testing.T) {
+	addr := runServer(t)
+	nc, err := nats.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	n := startTrigger(t, addr, map[string]interface{}{
+		"reply":         true,
+		"reply-timeout": "200ms",
+	}, &fakeAction{do: func(_ context.Context, in interface{}) (interface{}, error) {
+		return in, nil
+	}})
+	defer n.Close()
+	waitFor(t, "the subscription", func() bool {
+		_, err = nc.Request(testSubject, []byte("ok"), time.Second)
+		return err == nil
+	})
+	// queued past the reply timeout
+	n.Pause()
+	time.AfterFunc(400*time.Millisecond, n.Resume)
+	rsp, err := nc.Request(testSubject, []byte("ok"), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rsp.Data), context.DeadlineExceeded.Error()) {
+		t.Errorf("got reply %q, want a deadline exceeded error", rsp.Data)
+	}
+}
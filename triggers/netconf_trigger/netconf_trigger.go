@@ -0,0 +1,323 @@
+package netconf_trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	triggerName      = "netconf"
+	loggingPrefix    = "netconf_trigger"
+	defaultPort      = "830"
+	defaultStream    = "NETCONF"
+	defaultTimeout   = 10 * time.Second
+	netconfRetryWait = 10 * time.Second
+	// bytes
+	defaultMaxMessageSize = 16 * 1024 * 1024
+)
+
+func init() {
+	triggers.Register(triggerName, func() triggers.Trigger {
+		return &NetconfTrigger{
+			cfg: new(cfg),
+		}
+	})
+}
+
+// NetconfTrigger subscribes to RFC 5277 notification streams
+// and sends each received notification through the pipeline.
+type NetconfTrigger struct {
+	*triggers.Pipeline
+
+	cfg    *cfg
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+}
+
+type cfg struct {
+	// default credentials, overridable per target
+	Username   string `mapstructure:"username,omitempty" json:"username,omitempty"`
+	Password   string `mapstructure:"password,omitempty" json:"password,omitempty"`
+	PrivateKey string `mapstructure:"private-key,omitempty" json:"private-key,omitempty"`
+	// verify the devices host keys against this file
+	KnownHostsFile string `mapstructure:"known-hosts-file,omitempty" json:"known-hosts-file,omitempty"`
+	// skip host key verification, used if known-hosts-file is not set
+	SkipVerify bool         `mapstructure:"skip-verify,omitempty" json:"skip-verify,omitempty"`
+	Targets    []*targetCfg `mapstructure:"targets,omitempty" json:"targets,omitempty"`
+	// one subscription is created per stream
+	Streams []string `mapstructure:"streams,omitempty" json:"streams,omitempty"`
+	// subtree filter, inner XML of the <filter> element
+	Filter string `mapstructure:"filter,omitempty" json:"filter,omitempty"`
+	// replay notifications starting from this date-time, if supported by the device
+	StartTime string        `mapstructure:"start-time,omitempty" json:"start-time,omitempty"`
+	Timeout   time.Duration `mapstructure:"timeout,omitempty" json:"timeout,omitempty"`
+	RetryWait time.Duration `mapstructure:"retry-wait,omitempty" json:"retry-wait,omitempty"`
+	// size in bytes of the largest message read from a device,
+	// the session is closed and retried if it is exceeded.
+	MaxMessageSize int  `mapstructure:"max-message-size,omitempty" json:"max-message-size,omitempty"`
+	Debug          bool `mapstructure:"debug,omitempty" json:"debug,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
+}
+
+type targetCfg struct {
+	// device name added to the events, defaults to the address
+	Name       string `mapstructure:"name,omitempty" json:"name,omitempty"`
+	Address    string `mapstructure:"address,omitempty" json:"address,omitempty"`
+	Username   string `mapstructure:"username,omitempty" json:"username,omitempty"`
+	Password   string `mapstructure:"password,omitempty" json:"password,omitempty"`
+	PrivateKey string `mapstructure:"private-key,omitempty" json:"private-key,omitempty"`
+}
+
+// Start //
+func (n *NetconfTrigger) Start(ctx context.Context, cfg interface{}, opts ...triggers.Option) error {
+	err := utils.DecodeConfig(cfg, n.cfg)
+	if err != nil {
+		return err
+	}
+	n.Pipeline = triggers.NewPipeline(&n.cfg.PipelineConfig)
+	n.TrackConnections()
+	err = n.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	hostKeyCallback, err := n.hostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	n.ctx, n.cfn = context.WithCancel(ctx)
+	n.logger.Infof("trigger starting with config: %+v", n.cfg)
+	n.Pipeline.Start(n.ctx, n.logger)
+	for _, t := range n.cfg.Targets {
+		sshCfg, err := n.sshConfig(t, hostKeyCallback)
+		if err != nil {
+			n.logger.Errorf("target %q: %v", t.Name, err)
+			continue
+		}
+		for _, stream := range n.cfg.Streams {
+			go n.subscribe(n.ctx, t, stream, sshCfg)
+		}
+	}
+	return nil
+}
+
+// subscribe keeps a NETCONF session subscribed to stream on target t until ctx is done.
+func (n *NetconfTrigger) subscribe(ctx context.Context, t *targetCfg, stream string, sshCfg *ssh.ClientConfig) {
+	logPrefix := fmt.Sprintf("target=%s, stream=%s:", t.Name, stream)
+	for {
+		err := n.runSession(ctx, t, stream, sshCfg)
+		if ctx.Err() != nil {
+			return
+		}
+		n.logger.Errorf("%s session failed: %v, retrying in %s", logPrefix, err, n.cfg.RetryWait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(n.cfg.RetryWait):
+		}
+	}
+}
+
+func (n *NetconfTrigger) runSession(ctx context.Context, t *targetCfg, stream string, sshCfg *ssh.ClientConfig) error {
+	d := &net.Dialer{Timeout: n.cfg.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", t.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// unblock the reads below once ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// the SSH handshake, the hello exchange and the create-subscription reply
+	// must all complete within timeout, a silent device does not block the session.
+	err = conn.SetDeadline(time.Now().Add(n.cfg.Timeout))
+	if err != nil {
+		return err
+	}
+	s, err := newSession(conn, t.Address, sshCfg, n.cfg.MaxMessageSize)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.subscribe(stream, n.cfg.Filter, n.cfg.StartTime)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	n.logger.Infof("target=%s, stream=%s: subscribed", t.Name, stream)
+	n.ConnectionUp()
+	defer n.ConnectionDown()
+	for {
+		b, err := s.readMsg()
+		if err != nil {
+			return err
+		}
+		if n.cfg.Debug {
+			n.logger.Debugf("target=%s, stream=%s: received msg: %s", t.Name, stream, string(b))
+		}
+		ev, err := toEvent(b)
+		if err != nil {
+			n.logger.Errorf("target=%s, stream=%s: failed to decode msg: %v", t.Name, stream, err)
+			continue
+		}
+		if ev == nil {
+			continue
+		}
+		ev["device"] = t.Name
+		ev["address"] = t.Address
+		ev["stream"] = stream
+		err = n.Feed(ctx, &triggers.Event{Data: ev})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// toEvent converts a <notification> message into an event map,
+// other messages are ignored. Repeated elements become lists, like in xmlNode.value.
+func toEvent(b []byte) (map[string]interface{}, error) {
+	root, err := decodeXML(b)
+	if err != nil {
+		return nil, err
+	}
+	if root.name != "notification" {
+		return nil, nil
+	}
+	ev := make(map[string]interface{})
+	content := make(map[string]interface{})
+	for _, c := range root.children {
+		if c.name == "eventTime" {
+			ev["event-time"] = c.value()
+			continue
+		}
+		addValue(content, c.name, c.value())
+	}
+	ev["notification"] = content
+	return ev, nil
+}
+
+// Close //
+func (n *NetconfTrigger) Close() error {
+	n.cfn()
+	n.Pipeline.Close()
+	return nil
+}
+
+// SetLogger //
+func (n *NetconfTrigger) WithLogger(logger *log.Logger) {
+	if n.logger == nil {
+		n.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+// Validate //
+func (n *NetconfTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, n.cfg)
+	if err != nil {
+		return err
+	}
+	return n.setDefaults()
+}
+
+// helper functions
+
+func (n *NetconfTrigger) setDefaults() error {
+	if len(n.cfg.Targets) == 0 {
+		return errors.New("missing targets")
+	}
+	for i, t := range n.cfg.Targets {
+		if t.Address == "" {
+			return fmt.Errorf("target %d: missing address", i)
+		}
+		if _, _, err := net.SplitHostPort(t.Address); err != nil {
+			t.Address = net.JoinHostPort(t.Address, defaultPort)
+		}
+		if t.Name == "" {
+			t.Name = t.Address
+		}
+		if t.Username == "" {
+			t.Username = n.cfg.Username
+		}
+		if t.Password == "" {
+			t.Password = n.cfg.Password
+		}
+		if t.PrivateKey == "" {
+			t.PrivateKey = n.cfg.PrivateKey
+		}
+	}
+	if len(n.cfg.Streams) == 0 {
+		n.cfg.Streams = []string{defaultStream}
+	}
+	if n.cfg.KnownHostsFile == "" && !n.cfg.SkipVerify {
+		return errors.New("either known-hosts-file or skip-verify must be set")
+	}
+	if n.cfg.Timeout <= 0 {
+		n.cfg.Timeout = defaultTimeout
+	}
+	if n.cfg.RetryWait <= 0 {
+		n.cfg.RetryWait = netconfRetryWait
+	}
+	if n.cfg.MaxMessageSize <= 0 {
+		n.cfg.MaxMessageSize = defaultMaxMessageSize
+	}
+	return nil
+}
+
+func (n *NetconfTrigger) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if n.cfg.KnownHostsFile != "" {
+		return knownhosts.New(n.cfg.KnownHostsFile)
+	}
+	return ssh.InsecureIgnoreHostKey(), nil
+}
+
+func (n *NetconfTrigger) sshConfig(t *targetCfg, hkc ssh.HostKeyCallback) (*ssh.ClientConfig, error) {
+	auth := make([]ssh.AuthMethod, 0, 2)
+	if t.PrivateKey != "" {
+		b, err := os.ReadFile(t.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if t.Password != "" {
+		auth = append(auth, ssh.Password(t.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("missing password or private-key")
+	}
+	return &ssh.ClientConfig{
+		User:            t.Username,
+		Auth:            auth,
+		HostKeyCallback: hkc,
+	}, nil
+}
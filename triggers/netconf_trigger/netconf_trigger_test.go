@@ -0,0 +1,115 @@
+package netconf_trigger
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestToEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]interface{}
+	}{
+		{
+			name: "not a notification",
+			in:   `<rpc-reply><ok/></rpc-reply>`,
+		},
+		{
+			name: "notification",
+			in: `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">
+  <eventTime>2022-03-01T10:00:00Z</eventTime>
+  <link-down><if-name>ge-0/0/1</if-name></link-down>
+</notification>`,
+			want: map[string]interface{}{
+				"event-time": "2022-03-01T10:00:00Z",
+				"notification": map[string]interface{}{
+					"link-down": map[string]interface{}{"if-name": "ge-0/0/1"},
+				},
+			},
+		},
+		{
+			name: "repeated elements",
+			in: `<notification>
+  <eventTime>2022-03-01T10:00:00Z</eventTime>
+  <alarm><id>1</id></alarm>
+  <alarm><id>2</id><tag>a</tag><tag>b</tag></alarm>
+  <alarm><id>3</id></alarm>
+</notification>`,
+			want: map[string]interface{}{
+				"event-time": "2022-03-01T10:00:00Z",
+				"notification": map[string]interface{}{
+					"alarm": []interface{}{
+						map[string]interface{}{"id": "1"},
+						map[string]interface{}{"id": "2", "tag": []interface{}{"a", "b"}},
+						map[string]interface{}{"id": "3"},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toEvent([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("got %v, want no event", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSessionSilentDevice(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accepts the connection and never answers
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		ioutil.ReadAll(c)
+	}()
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	n := &NetconfTrigger{
+		cfg:    &cfg{Timeout: 200 * time.Millisecond},
+		logger: log.NewEntry(logger),
+	}
+	sshCfg := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("admin")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- n.runSession(context.Background(), &targetCfg{Name: "r1", Address: l.Addr().String()}, defaultStream, sshCfg)
+	}()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("expected a timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not timed out")
+	}
+}
@@ -0,0 +1,243 @@
+package netconf_trigger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	capBase10        = "urn:ietf:params:netconf:base:1.0"
+	capBase11        = "urn:ietf:params:netconf:base:1.1"
+	capNotification  = "urn:ietf:params:netconf:capability:notification:1.0"
+	nsNotification   = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+	endOfMessage     = "]]>]]>"
+	maxChunkSize     = 4294967295
+	helloMsg         = `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>` + capBase10 + `</capability><capability>` + capBase11 + `</capability><capability>` + capNotification + `</capability></capabilities></hello>`
+	createSubMsgTmpl = `<rpc message-id="%d" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><create-subscription xmlns="` + nsNotification + `">%s</create-subscription></rpc>`
+)
+
+// session is a NETCONF over SSH session, RFC 6241 and RFC 6242.
+type session struct {
+	client  *ssh.Client
+	sshSess *ssh.Session
+	w       io.WriteCloser
+	r       *bufio.Reader
+	// chunked framing, used once both peers advertised base:1.1
+	chunked   bool
+	messageID int
+	// size in bytes of the largest message accepted
+	maxMsgSize int
+}
+
+// newSession starts a NETCONF session over conn and exchanges the hello messages,
+// messages larger than maxMsgSize bytes fail the session.
+func newSession(conn net.Conn, address string, sshCfg *ssh.ClientConfig, maxMsgSize int) (*session, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, sshCfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{client: ssh.NewClient(c, chans, reqs), maxMsgSize: maxMsgSize}
+	s.sshSess, err = s.client.NewSession()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.w, err = s.sshSess.StdinPipe()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	r, err := s.sshSess.StdoutPipe()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.r = bufio.NewReader(r)
+	err = s.sshSess.RequestSubsystem("netconf")
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	err = s.hello()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) hello() error {
+	err := s.writeMsg([]byte(helloMsg))
+	if err != nil {
+		return err
+	}
+	b, err := s.readMsg()
+	if err != nil {
+		return err
+	}
+	h := new(struct {
+		Capabilities []string `xml:"capabilities>capability"`
+	})
+	err = xml.Unmarshal(b, h)
+	if err != nil {
+		return fmt.Errorf("failed to decode server hello: %v", err)
+	}
+	notif := false
+	for _, c := range h.Capabilities {
+		c = strings.TrimSpace(c)
+		switch {
+		case c == capBase11:
+			s.chunked = true
+		case strings.HasPrefix(c, capNotification):
+			notif = true
+		}
+	}
+	if !notif {
+		return errors.New("server does not support the notification capability")
+	}
+	return nil
+}
+
+// subscribe sends a create-subscription RPC and waits for its reply.
+func (s *session) subscribe(stream, filter, startTime string) error {
+	sb := new(strings.Builder)
+	if stream != "" {
+		sb.WriteString("<stream>")
+		xml.EscapeText(sb, []byte(stream))
+		sb.WriteString("</stream>")
+	}
+	if filter != "" {
+		sb.WriteString(`<filter type="subtree">`)
+		sb.WriteString(filter)
+		sb.WriteString("</filter>")
+	}
+	if startTime != "" {
+		sb.WriteString("<startTime>")
+		xml.EscapeText(sb, []byte(startTime))
+		sb.WriteString("</startTime>")
+	}
+	s.messageID++
+	err := s.writeMsg([]byte(fmt.Sprintf(createSubMsgTmpl, s.messageID, sb.String())))
+	if err != nil {
+		return err
+	}
+	b, err := s.readMsg()
+	if err != nil {
+		return err
+	}
+	reply := new(struct {
+		XMLName xml.Name
+		OK      *struct{} `xml:"ok"`
+		Errors  []struct {
+			Tag     string `xml:"error-tag"`
+			Message string `xml:"error-message"`
+		} `xml:"rpc-error"`
+	})
+	err = xml.Unmarshal(b, reply)
+	if err != nil {
+		return fmt.Errorf("failed to decode create-subscription reply: %v", err)
+	}
+	if reply.XMLName.Local != "rpc-reply" {
+		return fmt.Errorf("unexpected message %q waiting for create-subscription reply", reply.XMLName.Local)
+	}
+	if len(reply.Errors) > 0 {
+		errs := make([]string, 0, len(reply.Errors))
+		for _, e := range reply.Errors {
+			errs = append(errs, strings.TrimSpace(e.Tag+": "+e.Message))
+		}
+		return fmt.Errorf("create-subscription failed: %s", strings.Join(errs, ", "))
+	}
+	if reply.OK == nil {
+		return errors.New("create-subscription reply missing ok")
+	}
+	return nil
+}
+
+func (s *session) writeMsg(b []byte) error {
+	var err error
+	if s.chunked {
+		_, err = fmt.Fprintf(s.w, "\n#%d\n%s\n##\n", len(b), b)
+	} else {
+		_, err = fmt.Fprintf(s.w, "%s%s", b, endOfMessage)
+	}
+	return err
+}
+
+func (s *session) readMsg() ([]byte, error) {
+	if s.chunked {
+		return s.readChunked()
+	}
+	return s.readDelimited()
+}
+
+func (s *session) readDelimited() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(b)
+		if b == '>' && bytes.HasSuffix(buf.Bytes(), []byte(endOfMessage)) {
+			return buf.Bytes()[:buf.Len()-len(endOfMessage)], nil
+		}
+		if buf.Len() >= s.maxMsgSize+len(endOfMessage) {
+			return nil, s.errTooLarge()
+		}
+	}
+}
+
+func (s *session) readChunked() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for {
+		// each chunk starts with \n#<size>\n, the message ends with \n##\n
+		hdr, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if hdr == "\n" {
+			hdr, err = s.r.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+		}
+		hdr = strings.TrimSuffix(hdr, "\n")
+		if hdr == "##" {
+			return buf.Bytes(), nil
+		}
+		if !strings.HasPrefix(hdr, "#") {
+			return nil, fmt.Errorf("invalid chunk header %q", hdr)
+		}
+		size, err := strconv.ParseUint(hdr[1:], 10, 32)
+		if err != nil || size == 0 || size > maxChunkSize {
+			return nil, fmt.Errorf("invalid chunk size %q", hdr[1:])
+		}
+		if uint64(buf.Len())+size > uint64(s.maxMsgSize) {
+			return nil, s.errTooLarge()
+		}
+		_, err = io.CopyN(buf, s.r, int64(size))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *session) errTooLarge() error {
+	return fmt.Errorf("message larger than max-message-size %d bytes", s.maxMsgSize)
+}
+
+func (s *session) Close() error {
+	if s.sshSess != nil {
+		s.sshSess.Close()
+	}
+	return s.client.Close()
+}
@@ -0,0 +1,50 @@
+package netconf_trigger
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadMsg(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunked bool
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "delimited", in: "<a>1</a>]]>]]>", want: "<a>1</a>"},
+		{name: "delimited max size", in: "0123456789]]>]]>", want: "0123456789"},
+		{name: "delimited too large", in: "0123456789a]]>]]>", wantErr: true},
+		{name: "delimited unterminated", in: "<a>1</a>", wantErr: true},
+		{name: "chunked", chunked: true, in: "\n#3\n<a>\n#5\n1</a>\n##\n", want: "<a>1</a>"},
+		{name: "chunked max size", chunked: true, in: "\n#4\n0123\n#6\n456789\n##\n", want: "0123456789"},
+		{name: "chunked too large", chunked: true, in: "\n#4\n0123\n#7\n456789a\n##\n", wantErr: true},
+		{name: "chunked invalid header", chunked: true, in: "\n3\n<a>\n##\n", wantErr: true},
+		{name: "chunked invalid size", chunked: true, in: "\n#0\n\n##\n", wantErr: true},
+		{name: "chunked short chunk", chunked: true, in: "\n#9\n<a>\n##\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{
+				r:          bufio.NewReader(strings.NewReader(tt.in)),
+				chunked:    tt.chunked,
+				maxMsgSize: 10,
+			}
+			b, err := s.readMsg()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
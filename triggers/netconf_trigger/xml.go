@@ -0,0 +1,82 @@
+package netconf_trigger
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// xmlNode is an XML element decoded into a generic tree.
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+}
+
+// decodeXML returns the root element of b.
+func decodeXML(b []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: tok.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty XML document")
+	}
+	return root, nil
+}
+
+// value converts the node into a map keyed by the children element names,
+// repeated elements become lists and leaves become their trimmed text.
+func (n *xmlNode) value() interface{} {
+	if len(n.children) == 0 {
+		return strings.TrimSpace(n.text)
+	}
+	m := make(map[string]interface{}, len(n.children))
+	for _, c := range n.children {
+		addValue(m, c.name, c.value())
+	}
+	return m
+}
+
+// addValue sets m[name] to v, or appends v to the list of values if name is repeated.
+func addValue(m map[string]interface{}, name string, v interface{}) {
+	existing, ok := m[name]
+	if !ok {
+		m[name] = v
+		return
+	}
+	if l, ok := existing.([]interface{}); ok {
+		m[name] = append(l, v)
+		return
+	}
+	m[name] = []interface{}{existing, v}
+}
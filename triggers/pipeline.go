@@ -0,0 +1,534 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultNumWorkers = 1
+	defaultBufferSize = 100
+)
+
+// PipelineConfig is the part of a trigger config common to all triggers,
+// embedded in each trigger config with `mapstructure:",squash"`.
+type PipelineConfig struct {
+	NumWorkers int      `mapstructure:"num-workers,omitempty" json:"num-workers,omitempty"`
+	BufferSize int      `mapstructure:"buffer-size,omitempty" json:"buffer-size,omitempty"`
+	Processors []string `mapstructure:"processors,omitempty" json:"processors,omitempty"`
+	Actions    []string `mapstructure:"actions,omitempty" json:"actions,omitempty"`
+	Outputs    []string `mapstructure:"outputs,omitempty" json:"outputs,omitempty"`
+	// output receiving the events failing a processor, an action or an output
+	DeadLetter string `mapstructure:"dead-letter,omitempty" json:"dead-letter,omitempty"`
+	// stop at the first failing action, skipping the next actions and the outputs,
+	// and report the event as failed to the trigger.
+	// By default the failure is written to the dead-letter output and the pipeline goes on.
+	// Always set in the NATS trigger JetStream mode.
+	AbortOnFailure bool `mapstructure:"abort-on-failure,omitempty" json:"abort-on-failure,omitempty"`
+}
+
+// Event is a decoded event fed to a Pipeline.
+type Event struct {
+	Data interface{}
+	// called once the pipeline completes with the actions result or the error that interrupted it.
+	// Events without Ack are written to the dead-letter output when the pipeline fails.
+	Ack func(rs interface{}, err error)
+	// deadline of the pipeline run counted from Feed, including the time queued, none if zero
+	Timeout time.Duration
+	// trace context propagated by the event source, the pipeline run span is its child if valid
+	Parent trace.SpanContext
+
+	received time.Time
+}
+
+// Pipeline runs the events fed by a trigger through its processors, actions and outputs
+// using a pool of workers. Triggers embed it and only implement the events intake.
+type Pipeline struct {
+	// accessed atomically, kept first for 64-bit alignment on 32-bit platforms
+	conns      int64
+	received   uint64
+	processed  uint64
+	failed     uint64
+	dropped    uint64
+	reconnects uint64
+
+	cfg    *PipelineConfig
+	name   string
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+
+	evChan chan *Event
+	wg     *sync.WaitGroup
+	gate   *gate
+	// set if the trigger tracks its intake connections
+	connTracked int32
+	history     *history
+
+	// shared instances, looked up by name on Start
+	allProcs   map[string]processors.Processor
+	allActions map[string]actions.Action
+	allOutputs map[string]outputs.Output
+
+	procs   []processors.Processor
+	actions []actions.Action
+	outputs []outputs.Output
+
+	// names reported to the dead-letter output
+	procNames        []string
+	outNames         []string
+	deadLetterOutput *outputs.DeadLetter
+}
+
+// NewPipeline returns a Pipeline configured by cfg, setting its defaults.
+// It should be created as soon as the trigger config is decoded,
+// the trigger options then set its processors, actions and outputs.
+func NewPipeline(cfg *PipelineConfig) *Pipeline {
+	if cfg.NumWorkers <= 0 {
+		cfg.NumWorkers = defaultNumWorkers
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	return &Pipeline{
+		cfg:     cfg,
+		wg:      new(sync.WaitGroup),
+		gate:    &gate{ch: make(chan struct{})},
+		history: new(history),
+	}
+}
+
+// Start looks up the configured processors, actions and outputs
+// then starts the pipeline workers, which run until ctx is done or Close is called.
+func (p *Pipeline) Start(ctx context.Context, logger *log.Entry) {
+	p.logger = logger
+	p.resolve()
+	p.ctx, p.cfn = context.WithCancel(ctx)
+	p.evChan = make(chan *Event, p.cfg.BufferSize)
+	p.wg.Add(p.cfg.NumWorkers)
+	for i := 0; i < p.cfg.NumWorkers; i++ {
+		go p.worker(p.ctx, i)
+	}
+}
+
+// Feed queues ev for the pipeline workers.
+// It blocks until ev is queued, ctx is done or the pipeline is closed,
+// events that could not be queued are counted as failed.
+func (p *Pipeline) Feed(ctx context.Context, ev *Event) error {
+	ev.received = time.Now()
+	atomic.AddUint64(&p.received, 1)
+	select {
+	case <-ctx.Done():
+		atomic.AddUint64(&p.failed, 1)
+		return ctx.Err()
+	case <-p.ctx.Done():
+		atomic.AddUint64(&p.failed, 1)
+		return errors.New("pipeline closed")
+	case p.evChan <- ev:
+		return nil
+	}
+}
+
+// Process runs data through the processors, actions and outputs.
+// It stops at the first failing processor and returns a *StageError,
+// so does a failing action if abort-on-failure is set.
+// Other action failures and output failures are written to the dead-letter output.
+func (p *Pipeline) Process(ctx context.Context, data interface{}) (interface{}, error) {
+	return p.record(ctx, data, false)
+}
+
+// Inject runs a test event through the pipeline like Process,
+// the run is flagged as injected in the pipeline history.
+func (p *Pipeline) Inject(ctx context.Context, data interface{}) (interface{}, error) {
+	atomic.AddUint64(&p.received, 1)
+	return p.record(ctx, data, true)
+}
+
+func (p *Pipeline) record(ctx context.Context, data interface{}, injected bool) (interface{}, error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "pipeline "+p.name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("orbrs.trigger", p.name),
+			attribute.Bool("orbrs.injected", injected),
+		))
+	rs, env, err := p.process(ctx, data)
+	tracing.End(span, err)
+	atomic.AddUint64(&p.processed, 1)
+	if err != nil {
+		atomic.AddUint64(&p.failed, 1)
+	}
+	if p.history.enabled() {
+		r := &Run{
+			Time:     start,
+			Duration: time.Since(start).String(),
+			Event:    toJSON(data),
+			Injected: injected,
+		}
+		if len(env) > 0 {
+			r.Actions = toJSON(env)
+		}
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Result = toJSON(rs)
+		}
+		p.history.add(r)
+	}
+	return rs, err
+}
+
+// process returns the actions result and the results of each action by name.
+func (p *Pipeline) process(ctx context.Context, data interface{}) (interface{}, map[string]interface{}, error) {
+	var err error
+	ev := data
+	dropped := false
+	for i, proc := range p.procs {
+		_, span := tracing.Tracer().Start(ctx, "processor "+p.procNames[i])
+		data, err = proc.Apply(data)
+		tracing.End(span, err)
+		if err != nil {
+			p.logger.Errorf("failed to apply processor: %v", err)
+			return nil, nil, &StageError{Stage: outputs.StageProcessor, Name: p.procNames[i], Err: err}
+		}
+		// counted only, the empty result still goes through the actions and outputs
+		if !dropped && processors.Dropped(data) {
+			dropped = true
+			p.logger.Debugf("event dropped by processor %q", p.procNames[i])
+			atomic.AddUint64(&p.dropped, 1)
+			trace.SpanFromContext(ctx).AddEvent("dropped", trace.WithAttributes(attribute.String("orbrs.processor", p.procNames[i])))
+		}
+	}
+
+	var rs interface{}
+	env := make(map[string]interface{})
+	rs = data
+	for _, a := range p.actions {
+		p.logger.Infof("applying action: %+v", a)
+		actx, span := tracing.Tracer().Start(ctx, "action "+a.Name())
+		rs, err = a.Do(actx, rs, env)
+		tracing.End(span, err)
+		if err != nil {
+			p.logger.Printf("action %q failed: %v", a.Name(), err)
+			if p.cfg.AbortOnFailure {
+				return nil, env, &StageError{Stage: outputs.StageAction, Name: a.Name(), Err: err}
+			}
+			p.deadLetterOutput.For(outputs.StageAction, a.Name()).Send(ctx, ev, err)
+		}
+		env[a.Name()] = rs
+		p.logger.Infof("applied action %q: result: %v", a.Name(), rs)
+	}
+	for i, o := range p.outputs {
+		p.logger.Infof("sending result to output: %v", o)
+		octx, span := tracing.Tracer().Start(ctx, "output "+p.outNames[i], trace.WithSpanKind(trace.SpanKindProducer))
+		err = o.Write(octx, rs)
+		tracing.End(span, err)
+		if err != nil {
+			p.logger.Errorf("failed to write actions result to output: %v", err)
+			p.deadLetterOutput.For(outputs.StageOutput, p.outNames[i]).Send(ctx, rs, err)
+			continue
+		}
+	}
+	return rs, env, nil
+}
+
+// DeadLetter writes data, that failed with err after attempts since first,
+// to the dead-letter output.
+func (p *Pipeline) DeadLetter(ctx context.Context, data interface{}, err error, attempts int, first time.Time) {
+	SendDeadLetter(ctx, p.deadLetterOutput, data, err, attempts, first)
+}
+
+// Pause stops the workers from taking queued events until Resume is called,
+// the intake blocks once the buffer is full.
+func (p *Pipeline) Pause() {
+	p.gate.set(true)
+}
+
+// Resume restarts the workers of a paused pipeline.
+func (p *Pipeline) Resume() {
+	p.gate.set(false)
+}
+
+// TrackConnections is called by the triggers reporting the state of their intake connections
+// in the pipeline Status, using ConnectionUp and ConnectionDown.
+func (p *Pipeline) TrackConnections() {
+	atomic.StoreInt32(&p.connTracked, 1)
+}
+
+// ConnectionUp and ConnectionDown count the open intake connections of the trigger.
+func (p *Pipeline) ConnectionUp() {
+	atomic.AddInt64(&p.conns, 1)
+}
+
+// Reconnected is called instead of ConnectionUp when a lost intake connection is restored.
+func (p *Pipeline) Reconnected() {
+	atomic.AddUint64(&p.reconnects, 1)
+	atomic.AddInt64(&p.conns, 1)
+}
+
+func (p *Pipeline) ConnectionDown() {
+	atomic.AddInt64(&p.conns, -1)
+}
+
+// Status is the live state of a Pipeline.
+type Status struct {
+	Paused     bool `json:"paused"`
+	Workers    int  `json:"workers"`
+	BufferSize int  `json:"buffer-size"`
+	QueueDepth int  `json:"queue-depth"`
+	// only set for the triggers tracking their connections
+	Connected   *bool  `json:"connected,omitempty"`
+	Connections int64  `json:"connections,omitempty"`
+	Reconnects  uint64 `json:"reconnects,omitempty"`
+	Received    uint64 `json:"received"`
+	Processed   uint64 `json:"processed"`
+	Failed      uint64 `json:"failed"`
+	// events a processor returned an empty result for
+	Dropped uint64 `json:"dropped"`
+}
+
+func (p *Pipeline) Status() *Status {
+	paused, _ := p.gate.get()
+	st := &Status{
+		Paused:     paused,
+		Workers:    p.cfg.NumWorkers,
+		BufferSize: p.cfg.BufferSize,
+		QueueDepth: len(p.evChan),
+		Received:   atomic.LoadUint64(&p.received),
+		Processed:  atomic.LoadUint64(&p.processed),
+		Failed:     atomic.LoadUint64(&p.failed),
+		Dropped:    atomic.LoadUint64(&p.dropped),
+	}
+	if atomic.LoadInt32(&p.connTracked) == 1 {
+		st.Connections = atomic.LoadInt64(&p.conns)
+		st.Reconnects = atomic.LoadUint64(&p.reconnects)
+		connected := st.Connections > 0
+		st.Connected = &connected
+	}
+	return st
+}
+
+// Run is a pipeline run kept in the pipeline history.
+type Run struct {
+	Time     time.Time       `json:"time"`
+	Duration string          `json:"duration"`
+	Event    json.RawMessage `json:"event,omitempty"`
+	// results of the actions by name
+	Actions  json.RawMessage `json:"actions,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Injected bool            `json:"injected,omitempty"`
+}
+
+// KeepHistory keeps the last size runs of the pipeline, none if size is zero.
+func (p *Pipeline) KeepHistory(size int) {
+	p.history.setSize(size)
+}
+
+// History returns the last runs of the pipeline, oldest first.
+func (p *Pipeline) History() []*Run {
+	return p.history.list()
+}
+
+// Close stops the pipeline workers, the queued events are dropped.
+func (p *Pipeline) Close() {
+	if p.cfn != nil {
+		p.cfn()
+	}
+	p.wg.Wait()
+}
+
+// WithName sets the trigger name reported in the pipeline traces.
+func (p *Pipeline) WithName(name string) {
+	p.name = name
+}
+
+func (p *Pipeline) WithActions(acts map[string]actions.Action) {
+	p.allActions = acts
+}
+
+func (p *Pipeline) WithProcessors(procs map[string]processors.Processor) {
+	p.allProcs = procs
+}
+
+func (p *Pipeline) WithOutputs(outs map[string]outputs.Output) {
+	p.allOutputs = outs
+}
+
+func (p *Pipeline) resolve() {
+	for _, name := range p.cfg.Processors {
+		if proc, ok := p.allProcs[name]; ok {
+			p.procs = append(p.procs, proc)
+			p.procNames = append(p.procNames, name)
+			continue
+		}
+		p.logger.Warnf("processor %q not found", name)
+	}
+	for _, name := range p.cfg.Actions {
+		if act, ok := p.allActions[name]; ok {
+			p.actions = append(p.actions, act)
+			continue
+		}
+		p.logger.Warnf("action %q not found", name)
+	}
+	for _, name := range p.cfg.Outputs {
+		if o, ok := p.allOutputs[name]; ok {
+			p.outputs = append(p.outputs, o)
+			p.outNames = append(p.outNames, name)
+			continue
+		}
+		p.logger.Warnf("output %q not found", name)
+	}
+	if p.cfg.DeadLetter != "" {
+		o, ok := p.allOutputs[p.cfg.DeadLetter]
+		if !ok {
+			p.logger.Warnf("dead-letter output %q not found", p.cfg.DeadLetter)
+			return
+		}
+		p.deadLetterOutput = outputs.NewDeadLetter(o, p.logger)
+	}
+}
+
+func (p *Pipeline) worker(ctx context.Context, idx int) {
+	defer p.wg.Done()
+	workerLogPrefix := fmt.Sprintf("pipeline-worker-%d", idx)
+	p.logger.Printf("%s starting", workerLogPrefix)
+	for {
+		paused, changed := p.gate.get()
+		if paused {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case ev := <-p.evChan:
+			p.run(ctx, ev)
+		}
+	}
+}
+
+func (p *Pipeline) run(ctx context.Context, ev *Event) {
+	pctx := ctx
+	if ev.Parent.IsValid() {
+		pctx = trace.ContextWithRemoteSpanContext(pctx, ev.Parent)
+	}
+	if ev.Timeout > 0 {
+		var cancel context.CancelFunc
+		pctx, cancel = context.WithDeadline(pctx, ev.received.Add(ev.Timeout))
+		defer cancel()
+	}
+	rs, err := p.Process(pctx, ev.Data)
+	if err == nil && pctx.Err() != nil {
+		err = pctx.Err()
+	}
+	if ev.Ack != nil {
+		ev.Ack(rs, err)
+		return
+	}
+	if err != nil && ctx.Err() == nil {
+		p.DeadLetter(ctx, ev.Data, err, 1, ev.received)
+	}
+}
+
+// gate holds the paused state of a pipeline,
+// ch is closed and replaced on each state change.
+type gate struct {
+	m      sync.Mutex
+	paused bool
+	ch     chan struct{}
+}
+
+func (g *gate) get() (bool, <-chan struct{}) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.paused, g.ch
+}
+
+func (g *gate) set(paused bool) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if g.paused == paused {
+		return
+	}
+	g.paused = paused
+	close(g.ch)
+	g.ch = make(chan struct{})
+}
+
+type history struct {
+	m    sync.Mutex
+	size int
+	runs []*Run
+}
+
+func (h *history) setSize(size int) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.size = size
+	if len(h.runs) > size {
+		h.runs = h.runs[len(h.runs)-size:]
+	}
+}
+
+func (h *history) enabled() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.size > 0
+}
+
+func (h *history) add(r *Run) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	// disabled since the enabled check
+	if h.size == 0 {
+		return
+	}
+	if len(h.runs) < h.size {
+		h.runs = append(h.runs, r)
+		return
+	}
+	copy(h.runs, h.runs[1:])
+	h.runs[len(h.runs)-1] = r
+}
+
+func (h *history) list() []*Run {
+	h.m.Lock()
+	defer h.m.Unlock()
+	runs := make([]*Run, len(h.runs))
+	copy(runs, h.runs)
+	return runs
+}
+
+// toJSON keeps JSON events readable in the pipeline history.
+func toJSON(v interface{}) json.RawMessage {
+	if b, ok := v.([]byte); ok && json.Valid(b) {
+		return b
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	return b
+}
@@ -0,0 +1,315 @@
+package triggers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
+	"github.com/karimra/ouroboros/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeProc struct {
+	apply func(interface{}) (interface{}, error)
+}
+
+func (p *fakeProc) Init(interface{}, ...processors.Option) error { return nil }
+func (p *fakeProc) Apply(in interface{}) (interface{}, error)    { return p.apply(in) }
+func (p *fakeProc) WithLogger(*log.Logger)                       {}
+
+type fakeAction struct {
+	name string
+	do   func(context.Context, interface{}, map[string]interface{}) (interface{}, error)
+}
+
+func (a *fakeAction) Init(string, interface{}, ...actions.Option) error { return nil }
+func (a *fakeAction) Name() string                                      { return a.name }
+func (a *fakeAction) Do(ctx context.Context, in interface{}, env map[string]interface{}) (interface{}, error) {
+	return a.do(ctx, in, env)
+}
+func (a *fakeAction) WithLogger(*log.Logger)                         {}
+func (a *fakeAction) WithProcessors(map[string]processors.Processor) {}
+func (a *fakeAction) WithOutputs(map[string]outputs.Output)          {}
+
+type fakeOutput struct {
+	m      sync.Mutex
+	err    error
+	writes []interface{}
+}
+
+func (o *fakeOutput) Init(context.Context, interface{}, ...outputs.Option) error { return nil }
+func (o *fakeOutput) Write(_ context.Context, d interface{}) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.writes = append(o.writes, d)
+	return o.err
+}
+func (o *fakeOutput) Close() error                                   { return nil }
+func (o *fakeOutput) WithLogger(*log.Logger)                         {}
+func (o *fakeOutput) WithProcessors(map[string]processors.Processor) {}
+func (o *fakeOutput) WithDeadLetter(*outputs.DeadLetter)             {}
+
+func (o *fakeOutput) written() []interface{} {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return append([]interface{}(nil), o.writes...)
+}
+
+func testLogger() *log.Entry {
+	l := log.New()
+	l.SetOutput(ioutil.Discard)
+	return log.NewEntry(l)
+}
+
+// newTestPipeline returns a started pipeline running procs, acts and outs, in that order.
+func newTestPipeline(t *testing.T, cfg *PipelineConfig, procs map[string]processors.Processor, acts map[string]actions.Action, outs map[string]outputs.Output) *Pipeline {
+	t.Helper()
+	p := NewPipeline(cfg)
+	p.WithName("test")
+	p.WithProcessors(procs)
+	p.WithActions(acts)
+	p.WithOutputs(outs)
+	p.Start(context.Background(), testLogger())
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestPipelineContinuesEventTrace(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	parent := tracing.Extract(map[string][]string{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	if !parent.IsValid() {
+		t.Fatal("traceparent header not extracted")
+	}
+	var actionSpan trace.SpanContext
+	act := &fakeAction{name: "act", do: func(ctx context.Context, in interface{}, _ map[string]interface{}) (interface{}, error) {
+		actionSpan = trace.SpanContextFromContext(ctx)
+		return in, nil
+	}}
+	p := newTestPipeline(t, &PipelineConfig{Actions: []string{"act"}}, nil,
+		map[string]actions.Action{"act": act}, nil)
+
+	done := make(chan error, 1)
+	err := p.Feed(context.Background(), &Event{
+		Data:    "event",
+		Parent:  parent,
+		Timeout: time.Second,
+		Ack:     func(_ interface{}, err error) { done <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not processed")
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, s := range exp.GetSpans() {
+		spans[s.Name] = s
+	}
+	run, ok := spans["pipeline test"]
+	if !ok {
+		t.Fatalf("pipeline span not recorded, got %v", spans)
+	}
+	if run.Parent.TraceID() != parent.TraceID() || run.Parent.SpanID() != parent.SpanID() {
+		t.Errorf("pipeline span parent = %s/%s, want %s/%s",
+			run.Parent.TraceID(), run.Parent.SpanID(), parent.TraceID(), parent.SpanID())
+	}
+	as, ok := spans["action act"]
+	if !ok {
+		t.Fatal("action span not recorded")
+	}
+	if as.Parent.SpanID() != run.SpanContext.SpanID() {
+		t.Errorf("action span is not a child of the pipeline span")
+	}
+	if actionSpan.TraceID() != parent.TraceID() {
+		t.Errorf("action context trace = %s, want %s", actionSpan.TraceID(), parent.TraceID())
+	}
+}
+
+func TestPipelineProcess(t *testing.T) {
+	double := func(in interface{}) (interface{}, error) { return in.(int) * 2, nil }
+	drop := func(interface{}) (interface{}, error) { return nil, nil }
+	failProc := func(interface{}) (interface{}, error) { return nil, errors.New("bad input") }
+	inc := func(_ context.Context, in interface{}, _ map[string]interface{}) (interface{}, error) {
+		if in == nil {
+			return 0, nil
+		}
+		return in.(int) + 1, nil
+	}
+	failAct := func(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("unavailable")
+	}
+	tests := []struct {
+		name    string
+		abort   bool
+		procs   []func(interface{}) (interface{}, error)
+		acts    []func(context.Context, interface{}, map[string]interface{}) (interface{}, error)
+		outErrs []error
+
+		wantRs          interface{}
+		wantEnv         map[string]interface{}
+		wantErr         string
+		wantWrites      []int
+		wantDeadLetters int
+		wantDropped     uint64
+	}{
+		{
+			name:    "no stages",
+			wantRs:  1,
+			wantEnv: map[string]interface{}{},
+		},
+		{
+			name:       "processors then actions",
+			procs:      []func(interface{}) (interface{}, error){double, double},
+			acts:       []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc, inc},
+			outErrs:    []error{nil},
+			wantRs:     6,
+			wantEnv:    map[string]interface{}{"act0": 5, "act1": 6},
+			wantWrites: []int{1},
+		},
+		{
+			name:       "processor error",
+			procs:      []func(interface{}) (interface{}, error){double, failProc, double},
+			acts:       []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc},
+			outErrs:    []error{nil},
+			wantErr:    `processor "proc1" failed: bad input`,
+			wantWrites: []int{0},
+		},
+		{
+			name:            "action error",
+			acts:            []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc, failAct, inc},
+			outErrs:         []error{nil},
+			wantRs:          0,
+			wantEnv:         map[string]interface{}{"act0": 2, "act1": nil, "act2": 0},
+			wantWrites:      []int{1},
+			wantDeadLetters: 1,
+		},
+		{
+			name:       "action error with abort",
+			abort:      true,
+			acts:       []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc, failAct, inc},
+			outErrs:    []error{nil},
+			wantEnv:    map[string]interface{}{"act0": 2},
+			wantErr:    `action "act1" failed: unavailable`,
+			wantWrites: []int{0},
+		},
+		{
+			name:            "output error",
+			acts:            []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc},
+			outErrs:         []error{errors.New("disk full"), nil},
+			wantRs:          2,
+			wantEnv:         map[string]interface{}{"act0": 2},
+			wantWrites:      []int{1, 1},
+			wantDeadLetters: 1,
+		},
+		{
+			name:        "dropped",
+			procs:       []func(interface{}) (interface{}, error){drop, drop},
+			acts:        []func(context.Context, interface{}, map[string]interface{}) (interface{}, error){inc},
+			outErrs:     []error{nil},
+			wantRs:      0,
+			wantEnv:     map[string]interface{}{"act0": 0},
+			wantWrites:  []int{1},
+			wantDropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &PipelineConfig{DeadLetter: "dead-letter", AbortOnFailure: tt.abort}
+			procs := make(map[string]processors.Processor)
+			for i, f := range tt.procs {
+				name := fmt.Sprintf("proc%d", i)
+				procs[name] = &fakeProc{apply: f}
+				cfg.Processors = append(cfg.Processors, name)
+			}
+			acts := make(map[string]actions.Action)
+			for i, f := range tt.acts {
+				name := fmt.Sprintf("act%d", i)
+				acts[name] = &fakeAction{name: name, do: f}
+				cfg.Actions = append(cfg.Actions, name)
+			}
+			dl := new(fakeOutput)
+			outs := map[string]outputs.Output{"dead-letter": dl}
+			fouts := make([]*fakeOutput, len(tt.outErrs))
+			for i, err := range tt.outErrs {
+				name := fmt.Sprintf("out%d", i)
+				fouts[i] = &fakeOutput{err: err}
+				outs[name] = fouts[i]
+				cfg.Outputs = append(cfg.Outputs, name)
+			}
+			p := newTestPipeline(t, cfg, procs, acts, outs)
+
+			rs, env, err := p.process(context.Background(), 1)
+			if tt.wantErr != "" {
+				var serr *StageError
+				if !errors.As(err, &serr) || err.Error() != tt.wantErr {
+					t.Errorf("got error %v, want StageError %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rs, tt.wantRs) {
+				t.Errorf("got result %v, want %v", rs, tt.wantRs)
+			}
+			if len(env) > 0 || tt.wantEnv != nil {
+				if !reflect.DeepEqual(env, tt.wantEnv) {
+					t.Errorf("got env %v, want %v", env, tt.wantEnv)
+				}
+			}
+			for i, o := range fouts {
+				if got := len(o.written()); got != tt.wantWrites[i] {
+					t.Errorf("output %d got %d writes, want %d", i, got, tt.wantWrites[i])
+				}
+			}
+			if got := len(dl.written()); got != tt.wantDeadLetters {
+				t.Errorf("got %d dead letters, want %d", got, tt.wantDeadLetters)
+			}
+			if got := p.Status().Dropped; got != tt.wantDropped {
+				t.Errorf("got %d dropped, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := new(history)
+	h.setSize(2)
+	for i := 0; i < 3; i++ {
+		h.add(&Run{Event: toJSON(i)})
+	}
+	runs := h.list()
+	if len(runs) != 2 || string(runs[0].Event) != "1" || string(runs[1].Event) != "2" {
+		t.Errorf("got %d runs, want the last 2", len(runs))
+	}
+	// disabled between the enabled check and add
+	h.setSize(0)
+	h.add(&Run{Event: toJSON(3)})
+	if runs := h.list(); len(runs) != 0 {
+		t.Errorf("got %d runs after disabling the history", len(runs))
+	}
+}
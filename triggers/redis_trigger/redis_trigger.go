@@ -0,0 +1,551 @@
+package redis_trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/karimra/ouroboros/triggers"
+	"github.com/karimra/ouroboros/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	triggerName          = "redis"
+	loggingPrefix        = "redis_trigger"
+	defaultAddress       = "localhost:6379"
+	defaultStream        = "orbrs.events.in"
+	defaultGroup         = "orbrs"
+	defaultStartID       = "$"
+	defaultDataField     = "data"
+	defaultBlock         = 5 * time.Second
+	defaultClaimMinIdle  = time.Minute
+	defaultClaimInterval = 30 * time.Second
+	redisConnectWait     = 2 * time.Second
+
+	deadLetterStreamField     = "orbrs-stream"
+	deadLetterIDField         = "orbrs-id"
+	deadLetterErrorField      = "orbrs-error"
+	deadLetterDeliveriesField = "orbrs-deliveries"
+)
+
+func init() {
+	triggers.Register(triggerName, func() triggers.Trigger {
+		return &RedisTrigger{
+			cfg:      new(cfg),
+			wg:       new(sync.WaitGroup),
+			inflight: make(map[string]struct{}),
+		}
+	})
+}
+
+// RedisTrigger consumes Redis streams as part of a consumer group.
+type RedisTrigger struct {
+	*triggers.Pipeline
+
+	cfg    *cfg
+	ctx    context.Context
+	cfn    context.CancelFunc
+	logger *log.Entry
+
+	client *redis.Client
+	wg     *sync.WaitGroup
+
+	// entries fed to the pipeline and not settled yet, keyed by stream and ID,
+	// they are not reclaimed while queued locally.
+	m        sync.Mutex
+	inflight map[string]struct{}
+}
+
+type cfg struct {
+	Address  string           `mapstructure:"address,omitempty" json:"address,omitempty"`
+	Username string           `mapstructure:"username,omitempty" json:"username,omitempty"`
+	Password string           `mapstructure:"password,omitempty" json:"password,omitempty"`
+	DB       int              `mapstructure:"db,omitempty" json:"db,omitempty"`
+	TLS      *utils.TLSConfig `mapstructure:"tls,omitempty" json:"tls,omitempty"`
+	Streams  []string         `mapstructure:"streams,omitempty" json:"streams,omitempty"`
+	Group    string           `mapstructure:"group,omitempty" json:"group,omitempty"`
+	// consumer name prefix, suffixed with the worker index.
+	// Defaults to the hostname so the entries left pending are resumed after a restart,
+	// instances sharing a host need distinct names.
+	Consumer string `mapstructure:"consumer,omitempty" json:"consumer,omitempty"`
+	// ID the group starts reading from when it is created: $ or 0
+	StartID string `mapstructure:"start-id,omitempty" json:"start-id,omitempty"`
+	// entry field holding the event, the whole entry is used if it is missing
+	DataField string        `mapstructure:"data-field,omitempty" json:"data-field,omitempty"`
+	Block     time.Duration `mapstructure:"block,omitempty" json:"block,omitempty"`
+	// pending entries idle for longer than claim-min-idle are claimed and processed again,
+	// disabled if negative
+	ClaimMinIdle  time.Duration `mapstructure:"claim-min-idle,omitempty" json:"claim-min-idle,omitempty"`
+	ClaimInterval time.Duration `mapstructure:"claim-interval,omitempty" json:"claim-interval,omitempty"`
+	// entries delivered max-deliver times are moved to the dead-letter stream
+	MaxDeliver       int64         `mapstructure:"max-deliver,omitempty" json:"max-deliver,omitempty"`
+	DeadLetterStream string        `mapstructure:"dead-letter-stream,omitempty" json:"dead-letter-stream,omitempty"`
+	ConnectTimeWait  time.Duration `mapstructure:"connect-time-wait,omitempty" json:"connect-time-wait,omitempty"`
+	Debug            bool          `mapstructure:"debug,omitempty" json:"debug,omitempty"`
+
+	triggers.PipelineConfig `mapstructure:",squash"`
+}
+
+// Start //
+func (r *RedisTrigger) Start(ctx context.Context, cfg interface{}, opts ...triggers.Option) error {
+	err := utils.DecodeConfig(cfg, r.cfg)
+	if err != nil {
+		return err
+	}
+	r.Pipeline = triggers.NewPipeline(&r.cfg.PipelineConfig)
+	err = r.setDefaults()
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	redisOpts := &redis.Options{
+		Addr:     r.cfg.Address,
+		Username: r.cfg.Username,
+		Password: r.cfg.Password,
+		DB:       r.cfg.DB,
+	}
+	if r.cfg.TLS != nil {
+		redisOpts.TLSConfig, err = r.cfg.TLS.NewTLS()
+		if err != nil {
+			return err
+		}
+	}
+	r.client = redis.NewClient(redisOpts)
+
+	r.ctx, r.cfn = context.WithCancel(ctx)
+	r.logger.Infof("trigger starting with config: %+v", r.cfg)
+	r.Pipeline.Start(r.ctx, r.logger)
+	r.wg.Add(r.cfg.NumWorkers)
+	for i := 0; i < r.cfg.NumWorkers; i++ {
+		go r.worker(r.ctx, i)
+	}
+	if r.cfg.ClaimMinIdle > 0 {
+		r.wg.Add(1)
+		go r.reclaim(r.ctx)
+	}
+	return nil
+}
+
+func (r *RedisTrigger) worker(ctx context.Context, idx int) {
+	defer r.wg.Done()
+	workerLogPrefix := fmt.Sprintf("worker-%d", idx)
+	r.logger.Printf("%s starting", workerLogPrefix)
+	consumer := fmt.Sprintf("%s-%d", r.cfg.Consumer, idx)
+	streams := make([]string, 0, 2*len(r.cfg.Streams))
+	streams = append(streams, r.cfg.Streams...)
+	for range r.cfg.Streams {
+		streams = append(streams, ">")
+	}
+START:
+	err := r.createGroups(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Errorf("%s failed to create consumer group: %v", workerLogPrefix, err)
+		time.Sleep(r.cfg.ConnectTimeWait)
+		goto START
+	}
+	err = r.resumePending(ctx, consumer)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Errorf("%s failed to read pending entries: %v", workerLogPrefix, err)
+		time.Sleep(r.cfg.ConnectTimeWait)
+		goto START
+	}
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		res, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    r.cfg.Group,
+			Consumer: consumer,
+			Streams:  streams,
+			Count:    int64(r.cfg.BufferSize),
+			Block:    r.cfg.Block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Errorf("%s failed to read from streams: %v", workerLogPrefix, err)
+			time.Sleep(r.cfg.ConnectTimeWait)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				goto START
+			}
+			continue
+		}
+		for _, s := range res {
+			for _, msg := range s.Messages {
+				r.handleMsg(ctx, s.Stream, msg, 1)
+			}
+		}
+	}
+}
+
+// resumePending feeds the entries delivered to consumer that are still pending,
+// left by a previous run that failed or stopped before acknowledging them.
+// Entries delivered more than max-deliver times are dead-lettered instead.
+func (r *RedisTrigger) resumePending(ctx context.Context, consumer string) error {
+	for _, s := range r.cfg.Streams {
+		id := "0"
+		for {
+			res, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    r.cfg.Group,
+				Consumer: consumer,
+				Streams:  []string{s, id},
+				Count:    int64(r.cfg.BufferSize),
+			}).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if len(res) == 0 || len(res[0].Messages) == 0 {
+				break
+			}
+			msgs := res[0].Messages
+			id = msgs[len(msgs)-1].ID
+			// reading the consumer history counts as a delivery
+			deliveries, err := r.deliveries(ctx, s, consumer, msgs[0].ID, id, len(msgs))
+			if err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				if len(msg.Values) == 0 {
+					// deleted from the stream while pending
+					r.ack(ctx, s, msg.ID)
+					continue
+				}
+				if r.isInflight(s, msg.ID) {
+					continue
+				}
+				n, ok := deliveries[msg.ID]
+				if !ok {
+					n = 1
+				}
+				if r.cfg.MaxDeliver > 0 && n > r.cfg.MaxDeliver {
+					r.deadLetter(ctx, s, msg, n-1, errors.New("max-deliver reached"))
+					r.ack(ctx, s, msg.ID)
+					continue
+				}
+				r.handleMsg(ctx, s, msg, n)
+			}
+		}
+	}
+	return nil
+}
+
+// deliveries returns the delivery counts of the entries pending for consumer between IDs start and end.
+func (r *RedisTrigger) deliveries(ctx context.Context, stream, consumer, start, end string, count int) (map[string]int64, error) {
+	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   stream,
+		Group:    r.cfg.Group,
+		Start:    start,
+		End:      end,
+		Count:    int64(count),
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+	return deliveries, nil
+}
+
+// createGroups creates the consumer group on each stream,
+// creating the streams if needed.
+func (r *RedisTrigger) createGroups(ctx context.Context) error {
+	for _, s := range r.cfg.Streams {
+		err := r.client.XGroupCreateMkStream(ctx, s, r.cfg.Group, r.cfg.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+// reclaim periodically claims the entries left pending by failed or crashed consumers.
+func (r *RedisTrigger) reclaim(ctx context.Context) {
+	defer r.wg.Done()
+	consumer := r.cfg.Consumer + "-reclaim"
+	ticker := time.NewTicker(r.cfg.ClaimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, s := range r.cfg.Streams {
+				err := r.reclaimStream(ctx, s, consumer)
+				if err != nil && ctx.Err() == nil {
+					r.logger.Errorf("failed to reclaim pending entries of stream %q: %v", s, err)
+				}
+			}
+		}
+	}
+}
+
+// reclaimStream claims the pending entries of stream idle for longer than claim-min-idle,
+// going through the pending entries list in pages of buffer-size entries.
+func (r *RedisTrigger) reclaimStream(ctx context.Context, stream, consumer string) error {
+	start := "-"
+	for ctx.Err() == nil {
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  r.cfg.Group,
+			Start:  start,
+			End:    "+",
+			Count:  int64(r.cfg.BufferSize),
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		err = r.claim(ctx, stream, consumer, pending)
+		if err != nil {
+			return err
+		}
+		if len(pending) < r.cfg.BufferSize {
+			return nil
+		}
+		start = nextID(pending[len(pending)-1].ID)
+	}
+	return ctx.Err()
+}
+
+// claim claims the idle entries of pending and feeds them to the pipeline,
+// the entries delivered more than max-deliver times are dead-lettered instead.
+func (r *RedisTrigger) claim(ctx context.Context, stream, consumer string, pending []redis.XPendingExt) error {
+	retries := make(map[string]int64)
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Idle < r.cfg.ClaimMinIdle || r.isInflight(stream, p.ID) {
+			continue
+		}
+		ids = append(ids, p.ID)
+		retries[p.ID] = p.RetryCount
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	msgs, err := r.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    r.cfg.Group,
+		Consumer: consumer,
+		MinIdle:  r.cfg.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	r.logger.Infof("claimed %d pending entries from stream %q", len(msgs), stream)
+	for _, msg := range msgs {
+		// the claim counts as a delivery
+		deliveries := retries[msg.ID] + 1
+		if r.cfg.MaxDeliver > 0 && deliveries > r.cfg.MaxDeliver {
+			r.deadLetter(ctx, stream, msg, retries[msg.ID], errors.New("max-deliver reached"))
+			r.ack(ctx, stream, msg.ID)
+			continue
+		}
+		r.handleMsg(ctx, stream, msg, deliveries)
+	}
+	return nil
+}
+
+// handleMsg feeds the entry to the pipeline, it is acknowledged once the pipeline succeeds.
+func (r *RedisTrigger) handleMsg(ctx context.Context, stream string, msg redis.XMessage, deliveries int64) {
+	if r.cfg.Debug {
+		r.logger.Debugf("received entry, stream=%s, id=%s, values=%v", stream, msg.ID, msg.Values)
+	}
+	key := stream + "/" + msg.ID
+	r.m.Lock()
+	r.inflight[key] = struct{}{}
+	r.m.Unlock()
+	done := func() {
+		r.m.Lock()
+		delete(r.inflight, key)
+		r.m.Unlock()
+	}
+	err := r.Feed(ctx, &triggers.Event{
+		Data: r.msgData(msg),
+		Ack: func(_ interface{}, err error) {
+			defer done()
+			r.settleMsg(ctx, stream, msg, deliveries, err)
+		},
+	})
+	if err != nil {
+		done()
+	}
+}
+
+func (r *RedisTrigger) isInflight(stream, id string) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	_, ok := r.inflight[stream+"/"+id]
+	return ok
+}
+
+// settleMsg acknowledges the entry given the pipeline error.
+// Entries failing a processor are dead-lettered right away,
+// entries failing an action with abort-on-failure set stay pending until they are reclaimed.
+func (r *RedisTrigger) settleMsg(ctx context.Context, stream string, msg redis.XMessage, deliveries int64, err error) {
+	if err == nil {
+		r.ack(ctx, stream, msg.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if triggers.IsProcessorError(err) {
+		r.deadLetter(ctx, stream, msg, deliveries, err)
+		r.ack(ctx, stream, msg.ID)
+		return
+	}
+	r.logger.Infof("entry %s from stream %q left pending: %v", msg.ID, stream, err)
+}
+
+func (r *RedisTrigger) msgData(msg redis.XMessage) interface{} {
+	if v, ok := msg.Values[r.cfg.DataField]; ok {
+		if s, ok := v.(string); ok {
+			return []byte(s)
+		}
+	}
+	return msg.Values
+}
+
+// nextID returns the stream ID following id, used to page through ID ranges with inclusive bounds.
+func nextID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) == 2 {
+		if seq, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+			return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+		}
+	}
+	// exclusive range start, since Redis 6.2
+	return "(" + id
+}
+
+// entryTime returns the time a stream entry was added, from the milliseconds part of its ID.
+func entryTime(id string) time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func (r *RedisTrigger) ack(ctx context.Context, stream, id string) {
+	err := r.client.XAck(ctx, stream, r.cfg.Group, id).Err()
+	if err != nil {
+		r.logger.Errorf("failed to ack entry %s from stream %q: %v", id, stream, err)
+	}
+}
+
+// deadLetter adds the failed entry to the dead-letter stream, if configured,
+// with the failure details in additional fields, and writes it to the dead-letter output.
+func (r *RedisTrigger) deadLetter(ctx context.Context, stream string, msg redis.XMessage, deliveries int64, err error) {
+	r.DeadLetter(ctx, r.msgData(msg), err, int(deliveries), entryTime(msg.ID))
+	if r.cfg.DeadLetterStream == "" {
+		r.logger.Errorf("dropping entry %s from stream %q: %v", msg.ID, stream, err)
+		return
+	}
+	values := make(map[string]interface{}, len(msg.Values)+4)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[deadLetterStreamField] = stream
+	values[deadLetterIDField] = msg.ID
+	values[deadLetterErrorField] = err.Error()
+	values[deadLetterDeliveriesField] = deliveries
+	aerr := r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.cfg.DeadLetterStream,
+		Values: values,
+	}).Err()
+	if aerr != nil {
+		r.logger.Errorf("failed to add entry %s to dead-letter stream %q: %v", msg.ID, r.cfg.DeadLetterStream, aerr)
+		return
+	}
+	r.logger.Infof("entry %s from stream %q sent to dead-letter stream %q: %v", msg.ID, stream, r.cfg.DeadLetterStream, err)
+}
+
+// Close //
+func (r *RedisTrigger) Close() error {
+	r.cfn()
+	r.wg.Wait()
+	r.Pipeline.Close()
+	return r.client.Close()
+}
+
+// SetLogger //
+func (r *RedisTrigger) WithLogger(logger *log.Logger) {
+	if r.logger == nil {
+		r.logger = logger.WithField("plugin", loggingPrefix)
+	}
+}
+
+// Validate //
+func (r *RedisTrigger) Validate(cfg interface{}) error {
+	err := utils.DecodeConfig(cfg, r.cfg)
+	if err != nil {
+		return err
+	}
+	return r.setDefaults()
+}
+
+// helper functions
+
+func (r *RedisTrigger) setDefaults() error {
+	if r.cfg.Address == "" {
+		r.cfg.Address = defaultAddress
+	}
+	if len(r.cfg.Streams) == 0 {
+		r.cfg.Streams = []string{defaultStream}
+	}
+	if r.cfg.Group == "" {
+		r.cfg.Group = defaultGroup
+	}
+	if r.cfg.Consumer == "" {
+		r.cfg.Consumer = "orbrs-" + uuid.New().String()
+		if h, err := os.Hostname(); err == nil && h != "" {
+			r.cfg.Consumer = "orbrs-" + h
+		}
+	}
+	if r.cfg.StartID == "" {
+		r.cfg.StartID = defaultStartID
+	}
+	if r.cfg.DataField == "" {
+		r.cfg.DataField = defaultDataField
+	}
+	if r.cfg.Block <= 0 {
+		r.cfg.Block = defaultBlock
+	}
+	if r.cfg.ClaimMinIdle == 0 {
+		r.cfg.ClaimMinIdle = defaultClaimMinIdle
+	}
+	if r.cfg.ClaimInterval <= 0 {
+		r.cfg.ClaimInterval = defaultClaimInterval
+	}
+	if r.cfg.ConnectTimeWait <= 0 {
+		r.cfg.ConnectTimeWait = redisConnectWait
+	}
+	return nil
+}
@@ -3,20 +3,30 @@ package triggers
 import (
 	"context"
 
+	"github.com/karimra/ouroboros/actions"
+	"github.com/karimra/ouroboros/outputs"
+	"github.com/karimra/ouroboros/processors"
 	log "github.com/sirupsen/logrus"
 )
 
 type Trigger interface {
 	Start(context.Context, interface{}, ...Option) error
 
-	WithActions(map[string]map[string]interface{}, map[string]map[string]interface{}, map[string]map[string]interface{}, *log.Logger)
+	WithName(string)
+	WithActions(map[string]actions.Action)
 	WithLogger(*log.Logger)
-	WithProcessors(map[string]map[string]interface{}, *log.Logger)
-	WithOutputs(context.Context, map[string]map[string]interface{}, map[string]map[string]interface{}, *log.Logger)
+	WithProcessors(map[string]processors.Processor)
+	WithOutputs(map[string]outputs.Output)
 
 	Close() error
 }
 
+// Validator is implemented by the triggers able to check a configuration
+// without starting, Validate is called on a new instance.
+type Validator interface {
+	Validate(cfg interface{}) error
+}
+
 type Initializer func() Trigger
 
 var Triggers = map[string]Initializer{}
@@ -27,9 +37,15 @@ func Register(name string, initFn Initializer) {
 
 type Option func(Trigger)
 
-func WithActions(acts, procs, outs map[string]map[string]interface{}, l *log.Logger) Option {
+func WithName(name string) Option {
+	return func(i Trigger) {
+		i.WithName(name)
+	}
+}
+
+func WithActions(acts map[string]actions.Action) Option {
 	return func(i Trigger) {
-		i.WithActions(acts, procs, outs, l)
+		i.WithActions(acts)
 	}
 }
 
@@ -39,14 +55,14 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
-func WithProcessors(procs map[string]map[string]interface{}, l *log.Logger) Option {
+func WithProcessors(procs map[string]processors.Processor) Option {
 	return func(i Trigger) {
-		i.WithProcessors(procs, l)
+		i.WithProcessors(procs)
 	}
 }
 
-func WithOutputs(ctx context.Context, outs, procs map[string]map[string]interface{}, l *log.Logger) Option {
+func WithOutputs(outs map[string]outputs.Output) Option {
 	return func(i Trigger) {
-		i.WithOutputs(ctx, outs, procs, l)
+		i.WithOutputs(outs)
 	}
 }
@@ -0,0 +1,24 @@
+package utils
+
+import "encoding/json"
+
+// ToBytes returns data as is if it is a []byte, JSON encoded otherwise.
+func ToBytes(data interface{}) ([]byte, error) {
+	switch data := data.(type) {
+	case []uint8:
+		return data, nil
+	default:
+		return json.Marshal(data)
+	}
+}
+
+// TemplateData decodes JSON bytes so their fields can be used in templates.
+func TemplateData(data interface{}) interface{} {
+	if b, ok := data.([]byte); ok {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err == nil {
+			return v
+		}
+	}
+	return data
+}
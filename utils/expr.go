@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+)
+
+// Expr is either a Go template or a jq expression,
+// strings containing "{{" are parsed as templates.
+type Expr struct {
+	tpl *template.Template
+	jq  *gojq.Code
+}
+
+// NewExpr parses s, funcs are added to the template functions.
+func NewExpr(name, s string, funcs template.FuncMap) (*Expr, error) {
+	var err error
+	e := new(Expr)
+	if strings.Contains(s, "{{") {
+		e.tpl, err = template.New(name).Funcs(funcs).Parse(s)
+		return e, err
+	}
+	q, err := gojq.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	e.jq, err = gojq.Compile(q)
+	return e, err
+}
+
+// Eval returns the template output or the first jq result,
+// nil if the jq expression has no result.
+func (e *Expr) Eval(ev interface{}) (interface{}, error) {
+	if e.tpl != nil {
+		buf := new(bytes.Buffer)
+		err := e.tpl.Execute(buf, ev)
+		if err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+	iter := e.jq.Run(ev)
+	r, ok := iter.Next()
+	if !ok {
+		return nil, nil
+	}
+	if err, ok := r.(error); ok {
+		return nil, err
+	}
+	return r, nil
+}
+
+// EvalString is Eval with the result formatted as a string,
+// empty if there is none.
+func (e *Expr) EvalString(ev interface{}) (string, error) {
+	r, err := e.Eval(ev)
+	if err != nil {
+		return "", err
+	}
+	switch r := r.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return r, nil
+	case float64:
+		return strconv.FormatFloat(r, 'f', -1, 64), nil
+	default:
+		return fmt.Sprint(r), nil
+	}
+}
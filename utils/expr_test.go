@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestExpr(t *testing.T) {
+	ev := map[string]interface{}{
+		"name": "e1",
+		"n":    1.5,
+		"up":   true,
+		"tags": []interface{}{"a"},
+	}
+	funcs := template.FuncMap{"upper": strings.ToUpper}
+	tests := []struct {
+		name    string
+		s       string
+		want    interface{}
+		wantStr string
+		wantErr bool
+	}{
+		{name: "template", s: "if-{{.name}}", want: "if-e1", wantStr: "if-e1"},
+		{name: "template funcs", s: "{{upper .name}}", want: "E1", wantStr: "E1"},
+		{name: "jq string", s: " .name ", want: "e1", wantStr: "e1"},
+		{name: "jq number", s: ".n", want: 1.5, wantStr: "1.5"},
+		{name: "jq bool", s: ".up", want: true, wantStr: "true"},
+		{name: "jq null", s: ".missing", want: nil, wantStr: ""},
+		{name: "jq no result", s: "empty", want: nil, wantStr: ""},
+		{name: "jq error", s: ".name.x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewExpr(tt.name, tt.s, funcs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.Eval(ev)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval got %#v, want %#v", got, tt.want)
+			}
+			s, err := e.EvalString(ev)
+			if err != nil || s != tt.wantStr {
+				t.Errorf("EvalString got %q, %v, want %q", s, err, tt.wantStr)
+			}
+		})
+	}
+	for _, s := range []string{"{{.name", ".a | ]"} {
+		if _, err := NewExpr("bad", s, nil); err == nil {
+			t.Errorf("NewExpr(%q) expected an error", s)
+		}
+	}
+}